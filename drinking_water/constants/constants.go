@@ -1,6 +0,0 @@
-package constants
-
-const (
-	ChangesetComment = "Adding a new Drinking Water node"
-	CreatedBy        = "FountainMap.com Editor"
-)
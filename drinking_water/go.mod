@@ -1,11 +0,0 @@
-module drinking_water
-
-go 1.22.2
-
-require (
-	github.com/gorilla/sessions v1.2.2
-	github.com/joho/godotenv v1.5.1
-	golang.org/x/oauth2 v0.20.0
-)
-
-require github.com/gorilla/securecookie v1.1.2 // indirect
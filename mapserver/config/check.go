@@ -0,0 +1,173 @@
+// config/check.go
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validate checks the settings once they are all read. Settings only used by
+// the other mode are left alone.
+func (c *Config) validate() Problems {
+	var p Problems
+	required := []struct {
+		value, name string
+	}{
+		{c.ClientID, "clientID (CLIENT_ID)"},
+		{c.ClientSecret, "clientSecret (CLIENT_SECRET)"},
+		{c.RedirectURI, "redirectURI (REDIRECT_URI)"},
+		{c.AuthURL, "authURL (AUTH_URL)"},
+		{c.TokenURL, "tokenURL (TOKEN_URL)"},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			p = append(p, r.name+" is required")
+		}
+	}
+	urls := []struct {
+		value, name string
+	}{
+		{c.RedirectURI, "redirectURI (REDIRECT_URI)"},
+		{c.AuthURL, "authURL (AUTH_URL)"},
+		{c.TokenURL, "tokenURL (TOKEN_URL)"},
+		{c.OSMAPIBase, "osmAPIBase (OSM_API_BASE)"},
+	}
+	for _, mirror := range c.OverpassURLs {
+		urls = append(urls, struct{ value, name string }{mirror, "overpassURLs (OVERPASS_URL)"})
+	}
+	for _, u := range urls {
+		if u.value != "" && !isHTTPURL(u.value) {
+			p = append(p, fmt.Sprintf("%s must be an http or https URL, got %q", u.name, u.value))
+		}
+	}
+	if len(c.OverpassURLs) == 0 {
+		p = append(p, "overpassURLs (OVERPASS_URL) needs at least one mirror")
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		p = append(p, fmt.Sprintf("port (PORT) must be a number from 1 to 65535, got %q", c.Port))
+	}
+	p = append(p, positive(c.MaxChangesetElements, "maxChangesetElements (MAX_CHANGESET_ELEMENTS)")...)
+	p = append(p, duration(c.OverpassTimeout, "overpassTimeout (OVERPASS_TIMEOUT)")...)
+	if c.DrainDelay < 0 {
+		p = append(p, fmt.Sprintf("drainDelay (DRAIN_DELAY) must not be negative, got %s", c.DrainDelay))
+	}
+
+	if c.ExtractFile != "" {
+		if _, err := os.Stat(c.ExtractFile); err != nil {
+			p = append(p, fmt.Sprintf("extractFile (EXTRACT_FILE): %v", err))
+		}
+	}
+
+	theme := c.Theme()
+	if theme == nil {
+		return p
+	}
+	if _, err := os.Stat(filepath.Join(theme.Static, "map.html")); err != nil {
+		p = append(p, fmt.Sprintf("static of the theme: %v", err))
+	}
+	switch theme.Mode {
+	case ModeBBox:
+		p = append(p, positive(c.DataWorkers, "dataWorkers (DATA_WORKERS)")...)
+		p = append(p, duration(c.CategoryTimeout, "layerTimeout (CATEGORY_TIMEOUT)")...)
+		p = append(p, duration(c.TileCacheTTL, "tileCacheTTL (TILE_CACHE_TTL)")...)
+		p = append(p, positive(c.TileCacheMaxMB, "tileCacheMaxMB (TILE_CACHE_MAX_MB)")...)
+		if c.DiffSource != "" {
+			p = append(p, "diffSource (DIFF_SOURCE) only works in dataset mode")
+		}
+	case ModeDataset:
+		p = append(p, duration(c.RefreshInterval, "refreshInterval (REFRESH_INTERVAL)")...)
+		if c.RefreshMaxDrop < 1 || c.RefreshMaxDrop > 100 {
+			p = append(p, fmt.Sprintf("refreshMaxDrop (REFRESH_MAX_DROP) is a percentage from 1 to 100, got %d", c.RefreshMaxDrop))
+		}
+		if c.SnapshotDir == "" {
+			p = append(p, "snapshotDir (SNAPSHOT_DIR) is required")
+		}
+		p = append(p, positive(c.SnapshotKeep, "snapshotKeep (SNAPSHOT_KEEP)")...)
+		if c.DiffSource != "" {
+			p = append(p, duration(c.DiffInterval, "diffInterval (DIFF_INTERVAL)")...)
+		}
+	}
+	return p
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func positive(n int, name string) Problems {
+	if n <= 0 {
+		return Problems{fmt.Sprintf("%s must be positive, got %d", name, n)}
+	}
+	return nil
+}
+
+// duration checks a duration; none of them makes sense below a second, which
+// usually means a unit was mistyped.
+func duration(d time.Duration, name string) Problems {
+	switch {
+	case d <= 0:
+		return Problems{fmt.Sprintf("%s must be positive, got %s", name, d)}
+	case d < time.Second:
+		return Problems{fmt.Sprintf("%s must be at least 1s, got %s", name, d)}
+	}
+	return nil
+}
+
+// Summary writes the settings in effect, with the secrets left out, for
+// "mapserver config check".
+func (c *Config) Summary(w io.Writer) {
+	theme := c.Theme()
+	file := c.File
+	if file == "" {
+		file = "none, environment only"
+	}
+	fmt.Fprintf(w, "config file:     %s\n", file)
+	fmt.Fprintf(w, "theme:           %s (%s)\n", theme.Name, c.ThemeFile)
+	fmt.Fprintf(w, "mode:            %s, %s elements\n", theme.Mode, theme.Elements)
+	fmt.Fprintf(w, "port:            %s\n", c.Port)
+	fmt.Fprintf(w, "static:          %s\n", theme.Static)
+	fmt.Fprintf(w, "client ID:       %s\n", c.ClientID)
+	fmt.Fprintf(w, "client secret:   %s\n", redact(c.ClientSecret))
+	fmt.Fprintf(w, "redirect URI:    %s\n", c.RedirectURI)
+	fmt.Fprintf(w, "OSM API:         %s\n", c.OSMAPIBase)
+	fmt.Fprintf(w, "Overpass:        %s, timeout %s\n", strings.Join(c.OverpassURLs, ", "), c.OverpassTimeout)
+	fmt.Fprintf(w, "log level:       %s\n", c.LogLevel)
+	fmt.Fprintf(w, "drain delay:     %s\n", c.DrainDelay)
+	fmt.Fprintf(w, "changeset:       %q, created_by %q, at most %d elements\n", theme.ChangesetComment, theme.CreatedBy, c.MaxChangesetElements)
+	if c.ExtractFile != "" {
+		fmt.Fprintf(w, "extract:         %s\n", c.ExtractFile)
+	}
+	switch theme.Mode {
+	case ModeBBox:
+		fmt.Fprintf(w, "data workers:    %d, %s per layer\n", c.DataWorkers, c.CategoryTimeout)
+		fmt.Fprintf(w, "tile cache:      %s, %d MB\n", c.TileCacheTTL, c.TileCacheMaxMB)
+		if len(theme.Layers) > 0 {
+			ids := make([]string, len(theme.Layers))
+			for i, l := range theme.Layers {
+				ids[i] = l.ID
+			}
+			fmt.Fprintf(w, "layers:          %s\n", strings.Join(ids, ", "))
+		}
+	case ModeDataset:
+		fmt.Fprintf(w, "refresh:         every %s, losing at most %d%%\n", c.RefreshInterval, c.RefreshMaxDrop)
+		fmt.Fprintf(w, "snapshots:       %s, keeping %d\n", c.SnapshotDir, c.SnapshotKeep)
+		if c.DiffSource != "" {
+			fmt.Fprintf(w, "diffs:           %s every %s within %s\n", c.DiffSource, c.DiffInterval, c.DiffBBox)
+		}
+	}
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "(set, not shown)"
+}
@@ -0,0 +1,207 @@
+// config/config.go
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"osmkit/changeset"
+	"osmkit/overpass"
+	"osmkit/overpassql"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of the deployment, read from the config file and
+// then from the environment, which wins. The comment of each setting names
+// its environment variable. The theme of the site is held apart, see Theme.
+type Config struct {
+	ThemeFile string `yaml:"theme"` // THEME
+	Port      string `yaml:"port"`  // PORT, defaults to the port of the theme
+
+	ClientID     string `yaml:"clientID"`     // CLIENT_ID
+	ClientSecret string `yaml:"clientSecret"` // CLIENT_SECRET
+	RedirectURI  string `yaml:"redirectURI"`  // REDIRECT_URI, or REDIRECT_URI_BASE + REDIRECT_URI_CALLBACK
+	AuthURL      string `yaml:"authURL"`      // AUTH_URL
+	TokenURL     string `yaml:"tokenURL"`     // TOKEN_URL
+
+	OSMAPIBase      string        `yaml:"osmAPIBase"`      // OSM_API_BASE, e.g. https://master.apis.dev.openstreetmap.org/api/0.6
+	OverpassURLs    []string      `yaml:"overpassURLs"`    // OVERPASS_URL, mirrors tried in order
+	OverpassTimeout time.Duration `yaml:"overpassTimeout"` // OVERPASS_TIMEOUT
+	// Larger saves are split over several changesets
+	MaxChangesetElements int `yaml:"maxChangesetElements"` // MAX_CHANGESET_ELEMENTS
+
+	// bbox mode
+	DataWorkers     int           `yaml:"dataWorkers"`  // DATA_WORKERS, Overpass queries run at once by /data
+	CategoryTimeout time.Duration `yaml:"layerTimeout"` // CATEGORY_TIMEOUT, deadline of each /data layer
+	// Map tiles of /data are cached this long, up to TileCacheMaxMB
+	TileCacheTTL   time.Duration `yaml:"tileCacheTTL"`   // TILE_CACHE_TTL
+	TileCacheMaxMB int           `yaml:"tileCacheMaxMB"` // TILE_CACHE_MAX_MB
+
+	// dataset mode
+	RefreshInterval time.Duration   `yaml:"refreshInterval"` // REFRESH_INTERVAL, how often the nodes are fetched again
+	RefreshMaxDrop  int             `yaml:"refreshMaxDrop"`  // REFRESH_MAX_DROP, percentage of nodes a refresh may lose
+	SnapshotDir     string          `yaml:"snapshotDir"`     // SNAPSHOT_DIR, where fetched nodes are saved for warm starts
+	SnapshotKeep    int             `yaml:"snapshotKeep"`    // SNAPSHOT_KEEP, number of snapshots kept
+	DiffSource      string          `yaml:"diffSource"`      // DIFF_SOURCE, replication feed URL or directory, empty to only refresh
+	DiffInterval    time.Duration   `yaml:"diffInterval"`    // DIFF_INTERVAL
+	DiffBBox        overpassql.BBox `yaml:"diffBBox"`        // DIFF_BBOX, area outside of which diffed nodes are dropped
+
+	// .osm.pbf or .osm file read instead of querying Overpass
+	ExtractFile string `yaml:"extractFile"` // EXTRACT_FILE
+
+	LogLevel slog.Level `yaml:"logLevel"` // LOG_LEVEL, debug, info, warn or error
+
+	// How long /readyz fails before a shutdown stops taking connections, for
+	// load balancers to notice
+	DrainDelay time.Duration `yaml:"drainDelay"` // DRAIN_DELAY
+
+	// File is the config file the settings were read from, empty if none.
+	File string `yaml:"-"`
+
+	theme atomic.Pointer[Theme]
+}
+
+// Problems lists everything wrong with a configuration, one line each.
+type Problems []string
+
+func (p Problems) Error() string {
+	return strings.Join(p, "\n")
+}
+
+// romaniaBBox is south,west,north,east of Romania, a little generous.
+const romaniaBBox = "43.6,20.2,48.3,29.8"
+
+// defaultOverpassURLs are the public Overpass instances, main one first.
+const defaultOverpassURLs = "https://overpass-api.de/api/interpreter,https://overpass.kumi.systems/api/interpreter"
+
+// defaults returns the settings used when neither the config file nor the
+// environment sets them.
+func defaults() *Config {
+	diffBBox, _ := overpassql.ParseBBox(romaniaBBox)
+	return &Config{
+		OSMAPIBase:           "https://api.openstreetmap.org/api/0.6",
+		OverpassURLs:         overpass.ParseMirrors(defaultOverpassURLs),
+		OverpassTimeout:      60 * time.Second,
+		MaxChangesetElements: changeset.DefaultMaxElements,
+		DataWorkers:          3,
+		CategoryTimeout:      25 * time.Second,
+		TileCacheTTL:         300 * time.Second,
+		TileCacheMaxMB:       64,
+		RefreshInterval:      60 * time.Minute,
+		RefreshMaxDrop:       20,
+		SnapshotDir:          "snapshots",
+		SnapshotKeep:         48,
+		DiffInterval:         60 * time.Second,
+		DiffBBox:             diffBBox,
+		DrainDelay:           5 * time.Second,
+	}
+}
+
+// Load reads the configuration: the defaults, then the config file, then the
+// environment, with the .env file of the working directory loaded into it
+// when there is one. configFile defaults to $CONFIG and may be empty; a
+// non-empty themeFile wins over $THEME and the theme of the config file.
+// Every problem found is returned at once, as Problems.
+func Load(configFile, themeFile string) (*Config, error) {
+	var problems Problems
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		problems = append(problems, fmt.Sprintf(".env: %v", err))
+	}
+
+	cfg := defaults()
+	if configFile == "" {
+		configFile = os.Getenv("CONFIG")
+	}
+	if configFile != "" {
+		if err := readFile(cfg, configFile); err != nil {
+			return nil, Problems{err.Error()}
+		}
+		cfg.File = configFile
+	}
+
+	problems = append(problems, overrideFromEnv(cfg)...)
+	if themeFile != "" {
+		cfg.ThemeFile = themeFile
+	}
+	cfg.OSMAPIBase = strings.TrimSuffix(cfg.OSMAPIBase, "/")
+
+	theme, err := LoadTheme(cfg.ThemeFile)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("theme (THEME): %v", err))
+	} else {
+		if cfg.Port == "" {
+			cfg.Port = theme.Port
+		}
+		cfg.theme.Store(theme)
+	}
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return cfg, nil
+}
+
+// LoadConfig is Load for main, which cannot go on without a configuration.
+func LoadConfig(configFile, themeFile string) *Config {
+	cfg, err := Load(configFile, themeFile)
+	if err != nil {
+		slog.Error("Invalid configuration", "problems", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// readFile reads a YAML config file over cfg. Unknown keys are refused, so a
+// typo does not silently leave the default in place.
+func readFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Theme returns the theme of the site. Reload replaces it as a whole, so a
+// request should read it once and hold on to it.
+func (c *Config) Theme() *Theme {
+	return c.theme.Load()
+}
+
+// Reload reads the theme file again and swaps it in if it is valid. The mode
+// and elements decide the routes, so a theme changing them is refused; the
+// port and static directory are kept as they were, with a warning, until the
+// next restart. It returns the previous theme.
+func (c *Config) Reload() (*Theme, error) {
+	old := c.Theme()
+	theme, err := LoadTheme(c.ThemeFile)
+	if err != nil {
+		return nil, err
+	}
+	if theme.Mode != old.Mode || theme.Elements != old.Elements {
+		return nil, fmt.Errorf("the theme now has %s mode with %s elements instead of %s mode with %s elements, restart to apply it",
+			theme.Mode, theme.Elements, old.Mode, old.Elements)
+	}
+	if theme.Port != old.Port {
+		slog.Warn("The port of the theme changed, restart to apply it", "port", theme.Port)
+		theme.Port = old.Port
+	}
+	if theme.Static != old.Static {
+		slog.Warn("The static directory of the theme changed, restart to apply it", "static", theme.Static)
+		theme.Static = old.Static
+	}
+	c.theme.Store(theme)
+	return old, nil
+}
@@ -0,0 +1,309 @@
+// config/config_test.go
+package config
+
+import (
+	"errors"
+	"os"
+	"osmkit/overpassql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envKeys are the variables the configuration reads.
+var envKeys = []string{
+	"CONFIG", "THEME", "PORT", "CLIENT_ID", "CLIENT_SECRET", "REDIRECT_URI", "REDIRECT_URI_BASE",
+	"REDIRECT_URI_CALLBACK", "AUTH_URL", "TOKEN_URL", "OSM_API_BASE", "OVERPASS_URL", "OVERPASS_TIMEOUT",
+	"MAX_CHANGESET_ELEMENTS", "DATA_WORKERS", "CATEGORY_TIMEOUT", "TILE_CACHE_TTL", "TILE_CACHE_MAX_MB",
+	"REFRESH_INTERVAL", "REFRESH_MAX_DROP", "SNAPSHOT_DIR", "SNAPSHOT_KEEP", "DIFF_SOURCE", "DIFF_INTERVAL",
+	"DIFF_BBOX", "EXTRACT_FILE", "DRAIN_DELAY",
+}
+
+// setEnv empties every variable of the configuration, then sets the
+// required ones and env.
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, key := range envKeys {
+		t.Setenv(key, "")
+	}
+	required := map[string]string{
+		"CLIENT_ID":     "id",
+		"CLIENT_SECRET": "secret",
+		"REDIRECT_URI":  "http://127.0.0.1:8080/callback",
+		"AUTH_URL":      "https://www.openstreetmap.org/oauth2/authorize",
+		"TOKEN_URL":     "https://www.openstreetmap.org/oauth2/token",
+	}
+	for key, value := range required {
+		t.Setenv(key, value)
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+}
+
+// writeFile writes a file into dir and returns its path.
+func writeFile(t *testing.T, dir, name, text string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	setEnv(t, map[string]string{"OVERPASS_TIMEOUT": "30", "DIFF_BBOX": "44,25,45,27"})
+	file := writeFile(t, t.TempDir(), "config.yaml", `
+port: "9000"
+clientID: from-file
+overpassTimeout: 2m
+refreshInterval: 15m
+snapshotKeep: 5
+diffBBox: 43.6,20.2,48.3,29.8
+`)
+	cfg, err := Load(file, "../themes/water.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The environment wins over the file, which wins over the defaults
+	if cfg.ClientID != "id" || cfg.OverpassTimeout != 30*time.Second || cfg.DiffBBox != (overpassql.BBox{South: 44, West: 25, North: 45, East: 27}) {
+		t.Errorf("got client %q, timeout %s, diff bbox %s, want the environment", cfg.ClientID, cfg.OverpassTimeout, cfg.DiffBBox)
+	}
+	if cfg.Port != "9000" || cfg.RefreshInterval != 15*time.Minute || cfg.SnapshotKeep != 5 {
+		t.Errorf("got port %s, refresh %s, keep %d, want the file", cfg.Port, cfg.RefreshInterval, cfg.SnapshotKeep)
+	}
+	if cfg.RefreshMaxDrop != 20 || cfg.DataWorkers != 3 || len(cfg.OverpassURLs) != 2 {
+		t.Errorf("got max drop %d, workers %d, mirrors %v, want the defaults", cfg.RefreshMaxDrop, cfg.DataWorkers, cfg.OverpassURLs)
+	}
+	if cfg.File != file || cfg.ThemeFile != "../themes/water.yaml" || cfg.Theme().Mode != ModeDataset {
+		t.Errorf("got file %s, theme %s %+v", cfg.File, cfg.ThemeFile, cfg.Theme())
+	}
+}
+
+func TestLoadEnvOnly(t *testing.T) {
+	setEnv(t, map[string]string{"THEME": "../themes/toilet.yaml", "OSM_API_BASE": "https://api.example.org/api/0.6/"})
+	cfg, err := Load("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.File != "" || cfg.Theme().Name != "Public Toilet Map" || cfg.Port != "8080" || cfg.OSMAPIBase != "https://api.example.org/api/0.6" {
+		t.Errorf("got file %q, theme %q, port %s, API %s", cfg.File, cfg.Theme().Name, cfg.Port, cfg.OSMAPIBase)
+	}
+}
+
+func TestLoadProblems(t *testing.T) {
+	setEnv(t, map[string]string{"CLIENT_ID": "", "DATA_WORKERS": "three", "OVERPASS_URL": "ftp://example.org"})
+	_, err := Load("", "../themes/toilet.yaml")
+	var problems Problems
+	if !errors.As(err, &problems) {
+		t.Fatalf("got error %v, want Problems", err)
+	}
+	// Every problem is reported at once
+	for _, want := range []string{"clientID (CLIENT_ID) is required", "DATA_WORKERS must be a whole number", "overpassURLs (OVERPASS_URL) must be an http or https URL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("problems %q do not mention %q", problems, want)
+		}
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	setEnv(t, nil)
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"missing", filepath.Join(dir, "missing.yaml")},
+		{"unknown key", writeFile(t, dir, "typo.yaml", "clientId: id\n")},
+		{"bad duration", writeFile(t, dir, "duration.yaml", "overpassTimeout: a minute\n")},
+		{"bad bbox", writeFile(t, dir, "bbox.yaml", "diffBBox: 43.6,20.2\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cfg, err := Load(tt.file, "../themes/water.yaml"); err == nil {
+				t.Errorf("got %+v, want an error", cfg)
+			}
+		})
+	}
+}
+
+func TestOverrideFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(cfg *Config) bool
+		problem string
+	}{
+		{
+			name:  "seconds",
+			env:   map[string]string{"TILE_CACHE_TTL": "90"},
+			check: func(cfg *Config) bool { return cfg.TileCacheTTL == 90*time.Second },
+		},
+		{
+			name:  "minutes",
+			env:   map[string]string{"REFRESH_INTERVAL": "90"},
+			check: func(cfg *Config) bool { return cfg.RefreshInterval == 90*time.Minute },
+		},
+		{
+			name: "mirrors",
+			env:  map[string]string{"OVERPASS_URL": "https://a.example.org/api/interpreter, https://b.example.org/api/interpreter"},
+			check: func(cfg *Config) bool {
+				return len(cfg.OverpassURLs) == 2 && cfg.OverpassURLs[1] == "https://b.example.org/api/interpreter"
+			},
+		},
+		{
+			name:  "redirect URI of the toilet map",
+			env:   map[string]string{"REDIRECT_URI": "", "REDIRECT_URI_BASE": "https://toiletmap.example.org", "REDIRECT_URI_CALLBACK": "/callback"},
+			check: func(cfg *Config) bool { return cfg.RedirectURI == "https://toiletmap.example.org/callback" },
+		},
+		{
+			name:  "redirect URI wins over its parts",
+			env:   map[string]string{"REDIRECT_URI_BASE": "https://toiletmap.example.org", "REDIRECT_URI_CALLBACK": "/callback"},
+			check: func(cfg *Config) bool { return cfg.RedirectURI == "http://127.0.0.1:8080/callback" },
+		},
+		{
+			name:  "drain delay",
+			env:   map[string]string{"DRAIN_DELAY": "10"},
+			check: func(cfg *Config) bool { return cfg.DrainDelay == 10*time.Second },
+		},
+		{
+			name:  "unset keeps the default",
+			env:   nil,
+			check: func(cfg *Config) bool { return cfg.SnapshotDir == "snapshots" && cfg.DiffInterval == time.Minute },
+		},
+		{name: "bad number", env: map[string]string{"SNAPSHOT_KEEP": "many"}, problem: "SNAPSHOT_KEEP must be a whole number"},
+		{name: "duration with a unit", env: map[string]string{"DIFF_INTERVAL": "60s"}, problem: "DIFF_INTERVAL must be a whole number of seconds"},
+		{name: "bad bbox", env: map[string]string{"DIFF_BBOX": "romania"}, problem: "DIFF_BBOX"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			cfg := defaults()
+			problems := overrideFromEnv(cfg)
+			if tt.problem != "" {
+				if len(problems) != 1 || !strings.Contains(problems[0], tt.problem) {
+					t.Errorf("got problems %q, want %q", problems, tt.problem)
+				}
+				return
+			}
+			if len(problems) > 0 {
+				t.Fatalf("got problems %q", problems)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("got %+v", cfg)
+			}
+		})
+	}
+}
+
+// validConfig returns a configuration serving theme that passes validate.
+func validConfig(t *testing.T, theme string) *Config {
+	t.Helper()
+	loaded, err := LoadTheme(theme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := defaults()
+	cfg.Port = "8080"
+	cfg.ClientID, cfg.ClientSecret = "id", "secret"
+	cfg.RedirectURI = "http://127.0.0.1:8080/callback"
+	cfg.AuthURL = "https://www.openstreetmap.org/oauth2/authorize"
+	cfg.TokenURL = "https://www.openstreetmap.org/oauth2/token"
+	cfg.theme.Store(loaded)
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		theme   string
+		change  func(cfg *Config)
+		problem string // empty when valid
+	}{
+		{"dataset", "../themes/water.yaml", func(cfg *Config) {}, ""},
+		{"bbox", "../themes/toilet.yaml", func(cfg *Config) {}, ""},
+		{"no client secret", "../themes/water.yaml", func(cfg *Config) { cfg.ClientSecret = "" }, "clientSecret (CLIENT_SECRET) is required"},
+		{"relative token URL", "../themes/water.yaml", func(cfg *Config) { cfg.TokenURL = "/oauth2/token" }, "tokenURL (TOKEN_URL) must be an http or https URL"},
+		{"no mirrors", "../themes/water.yaml", func(cfg *Config) { cfg.OverpassURLs = nil }, "needs at least one mirror"},
+		{"port out of range", "../themes/water.yaml", func(cfg *Config) { cfg.Port = "80800" }, "port (PORT) must be a number from 1 to 65535"},
+		{"timeout without a unit", "../themes/water.yaml", func(cfg *Config) { cfg.OverpassTimeout = 60 }, "must be at least 1s"},
+		{"missing extract", "../themes/water.yaml", func(cfg *Config) { cfg.ExtractFile = "missing.osm.pbf" }, "extractFile (EXTRACT_FILE)"},
+		{"max drop over 100", "../themes/water.yaml", func(cfg *Config) { cfg.RefreshMaxDrop = 120 }, "refreshMaxDrop (REFRESH_MAX_DROP) is a percentage"},
+		{"no snapshot dir", "../themes/water.yaml", func(cfg *Config) { cfg.SnapshotDir = "" }, "snapshotDir (SNAPSHOT_DIR) is required"},
+		{"diff interval", "../themes/water.yaml", func(cfg *Config) { cfg.DiffSource, cfg.DiffInterval = "diffs", 0 }, "diffInterval (DIFF_INTERVAL) must be positive"},
+		{"diffs in bbox mode", "../themes/toilet.yaml", func(cfg *Config) { cfg.DiffSource = "diffs" }, "only works in dataset mode"},
+		{"no workers", "../themes/toilet.yaml", func(cfg *Config) { cfg.DataWorkers = 0 }, "dataWorkers (DATA_WORKERS) must be positive"},
+		{"negative drain delay", "../themes/toilet.yaml", func(cfg *Config) { cfg.DrainDelay = -time.Second }, "drainDelay (DRAIN_DELAY) must not be negative"},
+		// Settings of the other mode are not checked
+		{"dataset settings in bbox mode", "../themes/toilet.yaml", func(cfg *Config) { cfg.SnapshotDir = "" }, ""},
+		{"bbox settings in dataset mode", "../themes/water.yaml", func(cfg *Config) { cfg.DataWorkers = 0 }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t, tt.theme)
+			tt.change(cfg)
+			problems := cfg.validate()
+			if tt.problem == "" {
+				if len(problems) > 0 {
+					t.Errorf("got problems %q, want none", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || !strings.Contains(problems[0], tt.problem) {
+				t.Errorf("got problems %q, want %q", problems, tt.problem)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	static, err := filepath.Abs("../static/toilet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := "name: test\nmode: bbox\nelements: node\nstatic: " + static + "\n"
+	path := writeFile(t, dir, "theme.yaml", header+"layers: [{id: toilets, filter: 'node[\"amenity\"=\"toilets\"]'}]\n")
+	setEnv(t, nil)
+	cfg, err := Load("", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := cfg.Theme()
+
+	writeFile(t, dir, "theme.yaml", header+"port: \"9000\"\neditableTags: [fee]\nlayers: [{id: fuel, filter: 'node[\"amenity\"=\"fuel\"]'}]\n")
+	old, err := cfg.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	theme := cfg.Theme()
+	if old != first || theme.Layers[0].ID != "fuel" || theme.Editable("name") {
+		t.Errorf("got %+v after the reload, want the fuel layer with only fee editable", theme)
+	}
+	// The port needs a restart
+	if theme.Port != "8080" {
+		t.Errorf("port = %s, want the one the server listens on", theme.Port)
+	}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"invalid", header + "layers: [{id: fuel}]\n"},
+		{"not YAML", "layers: [\n"},
+		{"other mode", "name: test\nmode: dataset\nelements: node\nquery: '[out:json];node[amenity=fuel];out;'\n"},
+		{"other elements", "name: test\nmode: bbox\nelements: way\nquery: '[out:json];way[highway]({{bbox}});out geom;'\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeFile(t, dir, "theme.yaml", tt.text)
+			if _, err := cfg.Reload(); err == nil {
+				t.Fatal("got no error")
+			}
+			if cfg.Theme() != theme {
+				t.Errorf("the theme was replaced by %+v", cfg.Theme())
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// config/env.go
+package config
+
+import (
+	"fmt"
+	"os"
+	"osmkit/overpass"
+	"osmkit/overpassql"
+	"strconv"
+	"time"
+)
+
+// overrideFromEnv sets what the environment sets over cfg. Durations are
+// whole numbers in the unit each variable always had.
+func overrideFromEnv(cfg *Config) Problems {
+	var e envReader
+	e.str(&cfg.ThemeFile, "THEME")
+	e.str(&cfg.Port, "PORT")
+
+	e.str(&cfg.ClientID, "CLIENT_ID")
+	e.str(&cfg.ClientSecret, "CLIENT_SECRET")
+	e.str(&cfg.RedirectURI, "REDIRECT_URI")
+	if base := os.Getenv("REDIRECT_URI_BASE"); base != "" && os.Getenv("REDIRECT_URI") == "" {
+		// As the toilet map used to set it
+		cfg.RedirectURI = base + os.Getenv("REDIRECT_URI_CALLBACK")
+	}
+	e.str(&cfg.AuthURL, "AUTH_URL")
+	e.str(&cfg.TokenURL, "TOKEN_URL")
+
+	e.str(&cfg.OSMAPIBase, "OSM_API_BASE")
+	if value := os.Getenv("OVERPASS_URL"); value != "" {
+		cfg.OverpassURLs = overpass.ParseMirrors(value)
+	}
+	e.duration(&cfg.OverpassTimeout, "OVERPASS_TIMEOUT", time.Second)
+	e.int(&cfg.MaxChangesetElements, "MAX_CHANGESET_ELEMENTS")
+
+	e.int(&cfg.DataWorkers, "DATA_WORKERS")
+	e.duration(&cfg.CategoryTimeout, "CATEGORY_TIMEOUT", time.Second)
+	e.duration(&cfg.TileCacheTTL, "TILE_CACHE_TTL", time.Second)
+	e.int(&cfg.TileCacheMaxMB, "TILE_CACHE_MAX_MB")
+
+	e.duration(&cfg.RefreshInterval, "REFRESH_INTERVAL", time.Minute)
+	e.int(&cfg.RefreshMaxDrop, "REFRESH_MAX_DROP")
+	e.str(&cfg.SnapshotDir, "SNAPSHOT_DIR")
+	e.int(&cfg.SnapshotKeep, "SNAPSHOT_KEEP")
+	e.str(&cfg.DiffSource, "DIFF_SOURCE")
+	e.duration(&cfg.DiffInterval, "DIFF_INTERVAL", time.Second)
+	if value := os.Getenv("DIFF_BBOX"); value != "" {
+		bbox, err := overpassql.ParseBBox(value)
+		if err != nil {
+			e.problems = append(e.problems, fmt.Sprintf("DIFF_BBOX: %v", err))
+		}
+		cfg.DiffBBox = bbox
+	}
+
+	e.str(&cfg.ExtractFile, "EXTRACT_FILE")
+	e.duration(&cfg.DrainDelay, "DRAIN_DELAY", time.Second)
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := cfg.LogLevel.UnmarshalText([]byte(value)); err != nil {
+			e.problems = append(e.problems, fmt.Sprintf("LOG_LEVEL must be debug, info, warn or error, got %q", value))
+		}
+	}
+	return e.problems
+}
+
+// envReader reads environment variables into settings, noting those that do
+// not parse.
+type envReader struct {
+	problems Problems
+}
+
+func (e *envReader) str(dst *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*dst = value
+	}
+}
+
+func (e *envReader) int(dst *int, key string) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		e.problems = append(e.problems, fmt.Sprintf("%s must be a whole number, got %q", key, value))
+		return
+	}
+	*dst = n
+}
+
+var unitName = map[time.Duration]string{time.Second: "seconds", time.Minute: "minutes"}
+
+func (e *envReader) duration(dst *time.Duration, key string, unit time.Duration) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		e.problems = append(e.problems, fmt.Sprintf("%s must be a whole number of %s, got %q", key, unitName[unit], value))
+		return
+	}
+	*dst = time.Duration(n) * unit
+}
@@ -0,0 +1,204 @@
+// config/theme.go
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"osmkit/overpassql"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Modes of fetching the map elements.
+const (
+	// ModeDataset fetches the whole dataset with Query at startup and on
+	// every refresh, and serves it at once.
+	ModeDataset = "dataset"
+	// ModeBBox fetches the elements of the area the user looks at on demand.
+	ModeBBox = "bbox"
+)
+
+// Theme is what sets one site apart from the others: where its elements come
+// from, which of their tags can be edited and what it looks like.
+type Theme struct {
+	Name     string `yaml:"name" json:"name"`
+	Port     string `yaml:"port" json:"-"`
+	Static   string `yaml:"static" json:"-"` // Directory of map.html and its assets
+	Mode     string `yaml:"mode" json:"mode"`
+	Elements string `yaml:"elements" json:"elements"` // "node" or "way"
+
+	// Query is the dataset in dataset mode and the ways of the bbox in bbox
+	// mode; nodes in bbox mode come from Layers instead.
+	Query  string  `yaml:"query" json:"-"`
+	Layers []Layer `yaml:"layers" json:"-"`
+
+	// EditableTags are the keys that can be changed on existing elements; a
+	// key ending in "*" allows every key with that prefix. Empty allows all.
+	EditableTags []string `yaml:"editableTags" json:"editableTags"`
+
+	ChangesetComment  string `yaml:"-" json:"-"`
+	CreatedBy         string `yaml:"-" json:"-"`
+	ChangesetHashtags string `yaml:"-" json:"-"` // Semicolon separated, e.g. #zoning;#bucharest
+}
+
+// Layer is one set of map elements the user can toggle, filled by an Overpass
+// query with a {{bbox}} placeholder. Layers are served to the page as they
+// are, apart from the query.
+type Layer struct {
+	ID   string `yaml:"id" json:"id"`
+	Name string `yaml:"name" json:"name"`
+	Icon string `yaml:"icon" json:"icon"`
+	// Query is a full Overpass query; Filter is the shorter alternative of
+	// one or more selectors such as node["amenity"="pharmacy"], each of which
+	// gets the bbox added.
+	Query    string `yaml:"query" json:"-"`
+	Filter   string `yaml:"filter" json:"-"`
+	MinZoom  int    `yaml:"minZoom" json:"minZoom"`
+	Editable bool   `yaml:"editable" json:"editable"`
+
+	Parsed *overpassql.Query `yaml:"-" json:"-"`
+}
+
+// themeFile is the layout of a theme file, which groups the changeset tags.
+type themeFile struct {
+	Theme     `yaml:",inline"`
+	Changeset struct {
+		Comment   string `yaml:"comment"`
+		CreatedBy string `yaml:"createdBy"`
+		Hashtags  string `yaml:"hashtags"`
+	} `yaml:"changeset"`
+}
+
+// LoadTheme reads and checks a theme file. Static is made relative to the
+// working directory.
+func LoadTheme(path string) (*Theme, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no theme file given, see themes/")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file themeFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	theme := file.Theme
+	theme.ChangesetComment = file.Changeset.Comment
+	theme.CreatedBy = file.Changeset.CreatedBy
+	theme.ChangesetHashtags = file.Changeset.Hashtags
+
+	if theme.Name == "" {
+		return nil, fmt.Errorf("%s: name is missing", path)
+	}
+	if theme.Port == "" {
+		theme.Port = "8080"
+	}
+	if theme.Static == "" {
+		theme.Static = "static"
+	}
+	if !filepath.IsAbs(theme.Static) {
+		theme.Static = filepath.Join(filepath.Dir(path), theme.Static)
+	}
+	if theme.CreatedBy == "" {
+		theme.CreatedBy = theme.Name
+	}
+
+	switch {
+	case theme.Elements != "node" && theme.Elements != "way":
+		return nil, fmt.Errorf("%s: elements must be node or way, not %q", path, theme.Elements)
+	case theme.Mode == ModeDataset:
+		if theme.Elements != "node" {
+			return nil, fmt.Errorf("%s: dataset mode only serves nodes", path)
+		}
+		if theme.Query == "" || len(theme.Layers) > 0 {
+			return nil, fmt.Errorf("%s: dataset mode needs a query and no layers", path)
+		}
+		if _, err := overpassql.Parse(theme.Query); err != nil {
+			return nil, fmt.Errorf("%s: query: %w", path, err)
+		}
+	case theme.Mode == ModeBBox && theme.Elements == "node":
+		if theme.Query != "" {
+			return nil, fmt.Errorf("%s: nodes in bbox mode come from layers, not a query", path)
+		}
+		if err := checkLayers(theme.Layers); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case theme.Mode == ModeBBox:
+		if !strings.Contains(theme.Query, "{{bbox}}") || len(theme.Layers) > 0 {
+			return nil, fmt.Errorf("%s: ways in bbox mode need a query with a {{bbox}} placeholder and no layers", path)
+		}
+	default:
+		return nil, fmt.Errorf("%s: mode must be %s or %s, not %q", path, ModeDataset, ModeBBox, theme.Mode)
+	}
+	return &theme, nil
+}
+
+// checkLayers checks the layers and parses their queries. Layers may overlap,
+// an element matching several of them shows in each.
+func checkLayers(layers []Layer) error {
+	if len(layers) == 0 {
+		return fmt.Errorf("no layers defined")
+	}
+	seen := map[string]bool{}
+	for i := range layers {
+		l := &layers[i]
+		switch {
+		case l.ID == "":
+			return fmt.Errorf("layer %d has no id", i+1)
+		case seen[l.ID]:
+			return fmt.Errorf("layer id %s is used twice", l.ID)
+		case (l.Query == "") == (l.Filter == ""):
+			return fmt.Errorf("layer %s needs either a query or a filter", l.ID)
+		}
+		seen[l.ID] = true
+		if l.Name == "" {
+			l.Name = l.ID
+		}
+		if l.Filter != "" {
+			l.Query = filterQuery(l.Filter)
+		}
+
+		// The bbox only has to parse here, the real one is set per request
+		q, err := overpassql.Parse(strings.ReplaceAll(l.Query, "{{bbox}}", "0,0,0,0"))
+		if err != nil {
+			return fmt.Errorf("query of layer %s: %w", l.ID, err)
+		}
+		if len(q.Selectors()) == 0 {
+			return fmt.Errorf("query of layer %s selects nothing", l.ID)
+		}
+		l.Parsed = q
+	}
+	return nil
+}
+
+// filterQuery turns the selectors of a layer filter into a query for the bbox.
+func filterQuery(filter string) string {
+	var b strings.Builder
+	b.WriteString("[out:json];(")
+	for _, sel := range strings.Split(filter, ";") {
+		if sel = strings.TrimSpace(sel); sel != "" {
+			b.WriteString(sel + "({{bbox}});")
+		}
+	}
+	b.WriteString(");out body;")
+	return b.String()
+}
+
+// Editable reports whether the key can be changed on existing elements.
+func (t *Theme) Editable(key string) bool {
+	if len(t.EditableTags) == 0 {
+		return true
+	}
+	for _, pattern := range t.EditableTags {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(key, prefix) || pattern == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+// config/theme_test.go
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTheme writes a theme and returns its path.
+func writeTheme(t *testing.T, text string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "theme.yaml")
+	if err := os.WriteFile(name, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestLoadThemes(t *testing.T) {
+	tests := []struct {
+		file     string
+		mode     string
+		elements string
+		layers   int
+	}{
+		{"../themes/toilet.yaml", ModeBBox, "node", 6},
+		{"../themes/water.yaml", ModeDataset, "node", 0},
+		{"../themes/zoning.yaml", ModeBBox, "way", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			theme, err := LoadTheme(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if theme.Mode != tt.mode || theme.Elements != tt.elements || len(theme.Layers) != tt.layers {
+				t.Errorf("got %s mode with %d %s layers, want %s mode with %d %s layers",
+					theme.Mode, len(theme.Layers), theme.Elements, tt.mode, tt.layers, tt.elements)
+			}
+			if theme.ChangesetComment == "" || theme.CreatedBy == "" {
+				t.Errorf("changeset tags %q, %q are missing", theme.ChangesetComment, theme.CreatedBy)
+			}
+			if _, err := os.Stat(filepath.Join(theme.Static, "map.html")); err != nil {
+				t.Errorf("static directory %s: %v", theme.Static, err)
+			}
+			for _, l := range theme.Layers {
+				if l.Parsed == nil || l.Name == "" {
+					t.Errorf("layer %+v was not checked", l)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadThemeErrors(t *testing.T) {
+	const dataset = "name: test\nmode: dataset\nelements: node\n"
+	const bboxNodes = "name: test\nmode: bbox\nelements: node\n"
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"no name", "mode: dataset\nelements: node\nquery: '[out:json];node[amenity=toilets];out;'\n"},
+		{"unknown mode", "name: test\nmode: live\nelements: node\n"},
+		{"unknown elements", "name: test\nmode: bbox\nelements: area\n"},
+		{"dataset of ways", "name: test\nmode: dataset\nelements: way\nquery: '[out:json];way[highway];out;'\n"},
+		{"dataset without query", dataset},
+		{"dataset with a bad query", dataset + "query: 'node[amenity=toilets'\n"},
+		{"ways without bbox", "name: test\nmode: bbox\nelements: way\nquery: '[out:json];way[highway];out;'\n"},
+		{"nodes with a query", bboxNodes + "query: '[out:json];node[amenity=toilets]({{bbox}});out;'\n"},
+		{"no layers", bboxNodes},
+		{"layer without id", bboxNodes + "layers: [{filter: 'node[\"a\"]'}]\n"},
+		{"layer id used twice", bboxNodes + "layers: [{id: a, filter: 'node[\"a\"]'}, {id: a, filter: 'node[\"b\"]'}]\n"},
+		{"layer with query and filter", bboxNodes + "layers: [{id: a, filter: 'node[\"a\"]', query: '[out:json];node[\"a\"]({{bbox}});out;'}]\n"},
+		{"layer with neither", bboxNodes + "layers: [{id: a}]\n"},
+		{"layer with a bad filter", bboxNodes + "layers: [{id: a, filter: 'node[\"a\"'}]\n"},
+		{"layer selecting nothing", bboxNodes + "layers: [{id: a, query: '[out:json];out body;'}]\n"},
+		{"not a theme", "- name: test\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if theme, err := LoadTheme(writeTheme(t, tt.text)); err == nil {
+				t.Errorf("got %+v, want an error", theme)
+			}
+		})
+	}
+	if _, err := LoadTheme(""); err == nil {
+		t.Error("an empty theme path was accepted")
+	}
+	if _, err := LoadTheme(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("a missing theme file was accepted")
+	}
+}
+
+func TestLoadThemeDefaults(t *testing.T) {
+	path := writeTheme(t, "name: test\nmode: bbox\nelements: node\nlayers: [{id: shops, filter: 'node[\"shop\"]'}]\n")
+	theme, err := LoadTheme(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme.Port != "8080" || theme.Static != filepath.Join(filepath.Dir(path), "static") || theme.CreatedBy != "test" {
+		t.Errorf("got port %s, static %s, created_by %s, want the defaults", theme.Port, theme.Static, theme.CreatedBy)
+	}
+	if l := theme.Layers[0]; l.Name != "shops" || l.Query != `[out:json];(node["shop"]({{bbox}}););out body;` {
+		t.Errorf("got layer %+v, want the name and query filled in", l)
+	}
+}
+
+func TestFilterQuery(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{`node["amenity"="toilets"]`, `[out:json];(node["amenity"="toilets"]({{bbox}}););out body;`},
+		{`node["shop"]; way["shop"] ;`, `[out:json];(node["shop"]({{bbox}});way["shop"]({{bbox}}););out body;`},
+	}
+	for _, tt := range tests {
+		if got := filterQuery(tt.filter); got != tt.want {
+			t.Errorf("filterQuery(%q) = %s, want %s", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestEditable(t *testing.T) {
+	theme := &Theme{EditableTags: []string{"fee", "toilets:*"}}
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"fee", true},
+		{"toilets:disposal", true},
+		{"toilets", false},
+		{"fee:conditional", false},
+		{"name", false},
+	}
+	for _, tt := range tests {
+		if got := theme.Editable(tt.key); got != tt.want {
+			t.Errorf("Editable(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+	if !(&Theme{}).Editable("anything") {
+		t.Error("a theme without editable tags refused a key")
+	}
+}
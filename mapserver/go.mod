@@ -0,0 +1,22 @@
+module mapserver
+
+go 1.22.2
+
+require (
+	github.com/gorilla/sessions v1.3.0
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/oauth2 v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+	osmkit v0.0.0
+)
+
+require (
+	github.com/datadog/czlib v0.0.0-20160811164712-4bc9a24e37f2 // indirect
+	github.com/gorilla/securecookie v1.1.2 // indirect
+	github.com/paulmach/orb v0.1.3 // indirect
+	github.com/paulmach/osm v0.8.0 // indirect
+	github.com/paulmach/protoscan v0.2.1 // indirect
+	google.golang.org/protobuf v1.27.1 // indirect
+)
+
+replace osmkit => ../osmkit
@@ -0,0 +1,238 @@
+// handlers/data.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mapserver/config"
+	"mapserver/osm"
+	"net/http"
+	"osmkit/apperr"
+	"osmkit/overpassql"
+	"osmkit/tilecache"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// HandleData serves the elements of the map, in the shape the page of the
+// theme expects.
+func HandleData(cfg *config.Config) http.HandlerFunc {
+	switch theme := cfg.Theme(); {
+	case theme.Mode == config.ModeDataset:
+		return handleDataset(cfg)
+	case theme.Elements == "way":
+		return handleWays(cfg)
+	default:
+		return handleLayers(cfg)
+	}
+}
+
+// handleDataset answers with the whole dataset.
+func handleDataset(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodes := osm.CurrentNodes()
+		if nodes == nil {
+			nodes = []osm.Node{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(nodes)
+	}
+}
+
+// HandleStatus reports the size of the dataset and how its last refresh went.
+func HandleStatus(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(osm.Status())
+	}
+}
+
+// handleWays answers with the ways inside the bbox.
+func handleWays(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bbox := r.URL.Query().Get("bbox")
+		if bbox == "" {
+			apperr.Write(w, r, apperr.New(apperr.Validation, "Bounding box is required"))
+			return
+		}
+
+		ways, mirror, err := osm.FetchWays(r.Context(), cfg, bbox)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to fetch ways", "error", err)
+			apperr.Write(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		setCacheHeaders(w, mirror, osm.WayCache.Stats())
+		json.NewEncoder(w).Encode(ways)
+	}
+}
+
+// setCacheHeaders tells whether /data came from the tile cache, and which
+// mirror answered when it did not.
+func setCacheHeaders(w http.ResponseWriter, mirror string, stats tilecache.Stats) {
+	if mirror == "" {
+		w.Header().Set("X-Cache", "HIT")
+		return
+	}
+	w.Header().Set("X-Cache", "MISS")
+	w.Header().Set("X-Overpass-Mirror", mirror)
+	slog.Debug("Tile cache", "hits", stats.Hits, "misses", stats.Misses, "tiles", stats.Tiles, "bytes", stats.Bytes)
+}
+
+// layerResult is what fetching one layer produced.
+type layerResult struct {
+	name   string
+	data   *osm.Data[osm.Node]
+	mirror string
+	err    error
+}
+
+// fetchLayers runs the layer queries on at most cfg.DataWorkers goroutines,
+// each with its own deadline, so a slow layer cannot hold up the others.
+// Results come back in the order of layers.
+func fetchLayers(ctx context.Context, cfg *config.Config, layers []config.Layer, box overpassql.BBox) []layerResult {
+	results := make([]layerResult, len(layers))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < cfg.DataWorkers && n < len(layers); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				layerCtx, cancel := context.WithTimeout(ctx, cfg.CategoryTimeout)
+				var data osm.Data[osm.Node]
+				result, err := osm.Overpass.Query(layerCtx, strings.ReplaceAll(layers[i].Query, "{{bbox}}", box.String()), &data)
+				cancel()
+				results[i] = layerResult{name: layers[i].ID, data: &data, err: err}
+				if err == nil {
+					results[i].mirror = result.Mirror
+				}
+			}
+		}()
+	}
+	for i := range layers {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// fetchUnion fetches every layer with a single union query and sorts the
+// elements into the selected layers here. The cache always holds every layer,
+// so tiles fetched recently come from osm.NodeCache whatever the selection;
+// the mirror is empty when everything did.
+func fetchUnion(ctx context.Context, cfg *config.Config, selected []config.Layer, box overpassql.BBox) (map[string][]osm.Node, string, error) {
+	mirror := ""
+	elements, _, err := osm.NodeCache.Get(ctx, box, func(ctx context.Context, box overpassql.BBox) ([]osm.Node, error) {
+		var data osm.Data[osm.Node]
+		result, err := osm.Overpass.Query(ctx, osm.UnionQuery(cfg.Theme().Layers, box), &data)
+		if err != nil {
+			return nil, err
+		}
+		mirror = result.Mirror
+		return data.Elements, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return osm.Classify(selected, elements), mirror, nil
+}
+
+// handleLayers answers with the elements of the layers listed in the "layers"
+// parameter, all of them by default, inside the bbox. They are read from the
+// extract if there is one, else fetched with one union query. If that fails
+// the layers are fetched one by one: those that failed again are left empty
+// and reported in "errors", so the map still shows the others. Only when all
+// of them fail is the request an error.
+func handleLayers(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bbox := r.URL.Query().Get("bbox")
+		if bbox == "" {
+			apperr.Write(w, r, apperr.New(apperr.Validation, "Bounding box is required"))
+			return
+		}
+		var ids []string
+		if param := r.URL.Query().Get("layers"); param != "" {
+			ids = strings.Split(param, ",")
+		}
+		layers, err := osm.SelectLayers(cfg.Theme().Layers, ids)
+		if err != nil {
+			apperr.Write(w, r, apperr.Wrap(apperr.Validation, err, "Invalid layers"))
+			return
+		}
+		box, err := overpassql.ParseBBox(bbox)
+		if err != nil {
+			apperr.Write(w, r, apperr.Wrap(apperr.Validation, err, "Invalid bounding box"))
+			return
+		}
+
+		if cfg.ExtractFile != "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(osm.Classify(layers, osm.ExtractWithin(box)))
+			return
+		}
+
+		responseData := map[string]interface{}{}
+		classified, mirror, err := fetchUnion(r.Context(), cfg, layers, box)
+		if err == nil {
+			for name, elements := range classified {
+				responseData[name] = elements
+			}
+			w.Header().Set("Content-Type", "application/json")
+			setCacheHeaders(w, mirror, osm.NodeCache.Stats())
+			json.NewEncoder(w).Encode(responseData)
+			return
+		}
+		if apperr.Is(err, apperr.Validation) {
+			apperr.Write(w, r, err)
+			return
+		}
+		slog.WarnContext(r.Context(), "Union query failed, fetching the layers one by one", "error", err)
+
+		errs := map[string]interface{}{}
+		var mirrors []string
+		var lastErr error
+		for _, result := range fetchLayers(r.Context(), cfg, layers, box) {
+			if result.err != nil {
+				slog.ErrorContext(r.Context(), "Failed to fetch layer", "layer", result.name, "error", result.err)
+				lastErr = fmt.Errorf("failed to fetch %s: %w", result.name, result.err)
+				errs[result.name] = map[string]interface{}{
+					"error":   apperr.KindOf(result.err),
+					"message": apperr.Message(result.err),
+				}
+				responseData[result.name] = []osm.Node{}
+				continue
+			}
+			responseData[result.name] = result.data.Elements
+			if !slices.Contains(mirrors, result.mirror) {
+				mirrors = append(mirrors, result.mirror)
+			}
+		}
+		if len(mirrors) == 0 && lastErr != nil {
+			apperr.Write(w, r, lastErr)
+			return
+		}
+		if len(errs) > 0 {
+			responseData["errors"] = errs
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Overpass-Mirror", strings.Join(mirrors, ", "))
+		json.NewEncoder(w).Encode(responseData)
+	}
+}
+
+// HandleLayers lists the layers of the map, for the page to build its layer
+// toggles from.
+func HandleLayers(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cfg.Theme().Layers)
+	}
+}
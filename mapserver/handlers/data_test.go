@@ -0,0 +1,78 @@
+// handlers/data_test.go
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"osmkit/overpassql"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const toiletsFixture = `<osm version="0.6">
+ <node id="2" version="1" lat="44.431" lon="26.101"><tag k="amenity" v="toilets"/></node>
+ <node id="3" version="1" lat="44.432" lon="26.102"><tag k="amenity" v="restaurant"/><tag k="toilets" v="yes"/></node>
+ <node id="4" version="1" lat="45.10" lon="26.102"><tag k="amenity" v="toilets"/></node>
+</osm>`
+
+// filterTheme writes a theme whose toilets layer is a filter of two
+// selectors, and returns its path.
+func filterTheme(t *testing.T) string {
+	t.Helper()
+	static, err := filepath.Abs("../static/toilet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "theme.yaml")
+	theme := "name: test\nmode: bbox\nelements: node\nstatic: " + static + "\nlayers:\n" +
+		"  - {id: toilets, filter: 'node[\"amenity\"=\"toilets\"]; node[\"toilets\"=\"yes\"]'}\n" +
+		"  - {id: restaurants, filter: 'node[\"amenity\"=\"restaurant\"]'}\n"
+	if err := os.WriteFile(path, []byte(theme), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFetchLayers(t *testing.T) {
+	u := &services{}
+	cfg := newTestServer(t, filterTheme(t), u)
+	if err := u.api.LoadFixture(strings.NewReader(toiletsFixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	box := overpassql.BBox{South: 44.42, West: 26.09, North: 44.44, East: 26.11}
+	results := fetchLayers(context.Background(), cfg, cfg.Theme().Layers, box)
+	// Both selectors of the filter get the bbox: node 3 only matches the
+	// second one, and node 4 is outside
+	want := map[string][]int64{"toilets": {2, 3}, "restaurants": {3}}
+	if len(results) != len(want) {
+		t.Fatalf("got %d layers, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		if result.err != nil {
+			t.Errorf("layer %s: %v", result.name, result.err)
+			continue
+		}
+		var ids []int64
+		for _, n := range result.data.Elements {
+			ids = append(ids, n.ID)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		if !reflect.DeepEqual(ids, want[result.name]) {
+			t.Errorf("layer %s = %v, want %v", result.name, ids, want[result.name])
+		}
+	}
+}
+
+func TestDataInvalidBBox(t *testing.T) {
+	cfg := newTestServer(t, filterTheme(t), &services{})
+	for _, bbox := range []string{"", "44.42,26.09,44.44", "44.44,26.09,44.42,26.11"} {
+		if code, body := probe(t, HandleData(cfg), "/data?bbox="+bbox); code != http.StatusBadRequest {
+			t.Errorf("bbox %q: got %d %s, want 400", bbox, code, body)
+		}
+	}
+}
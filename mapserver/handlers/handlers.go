@@ -0,0 +1,86 @@
+// handlers/handlers.go
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mapserver/config"
+	"mapserver/logging"
+	"mapserver/oauth"
+	"net/http"
+	"osmkit/apperr"
+	"path/filepath"
+
+	"golang.org/x/oauth2"
+)
+
+func HandleMap(cfg *config.Config) http.HandlerFunc {
+	page := filepath.Join(cfg.Theme().Static, "map.html")
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, page)
+	}
+}
+
+// HandleTheme describes the site to the page: its name, how it fetches its
+// elements and which of their tags can be edited.
+func HandleTheme(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cfg.Theme())
+	}
+}
+
+func HandleLogin(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		url := oauth.Oauth2Config.AuthCodeURL("state", oauth2.AccessTypeOffline)
+		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	}
+}
+
+func HandleCallback(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := r.URL.Query().Get("code")
+		token, err := oauth.Exchange(code)
+		if err != nil {
+			apperr.Write(w, r, apperr.Wrap(apperr.NotAuthenticated, err, "Failed to exchange token"))
+			return
+		}
+
+		userID, err := oauth.FetchUserID(cfg, token)
+		if err != nil {
+			apperr.Write(w, r, fmt.Errorf("failed to fetch user details: %w", err))
+			return
+		}
+
+		session, _ := oauth.Store.Get(r, "session-name")
+		session.Values["oauth-token"] = token
+		session.Values["osm-user-id"] = userID
+		if err := session.Save(r, w); err != nil {
+			apperr.Write(w, r, fmt.Errorf("failed to save session: %w", err))
+			return
+		}
+		logging.SetUser(r.Context(), userID)
+		slog.InfoContext(r.Context(), "User logged in", "user_id", userID)
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// sessionUser returns the OAuth token and OSM user ID of the logged in user.
+// action completes the "Please log in to ..." message.
+func sessionUser(cfg *config.Config, r *http.Request, action string) (*oauth2.Token, int64, error) {
+	session, _ := oauth.Store.Get(r, "session-name")
+	token, ok := session.Values["oauth-token"].(*oauth2.Token)
+	if !ok {
+		slog.DebugContext(r.Context(), "No OAuth token found in session")
+		return nil, 0, apperr.New(apperr.NotAuthenticated, "You are not authenticated. Please log in to %s.", action)
+	}
+
+	userID, err := oauth.UserID(cfg, session, token)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to look up your OSM account: %w", err)
+	}
+	logging.SetUser(r.Context(), userID)
+	return token, userID, nil
+}
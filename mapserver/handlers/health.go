@@ -0,0 +1,134 @@
+// handlers/health.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mapserver/config"
+	"mapserver/osm"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// draining is set once the server starts shutting down.
+var draining atomic.Bool
+
+// Drain makes /readyz fail from now on, so load balancers stop sending
+// requests while the ones in flight finish.
+func Drain() {
+	draining.Store(true)
+}
+
+// HandleHealthz answers as long as the process serves requests at all.
+func HandleHealthz(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// check is the outcome of one readiness check. A failed required check makes
+// the server unready; the others are only reported.
+type check struct {
+	OK       bool   `json:"ok"`
+	Required bool   `json:"required"`
+	Error    string `json:"error,omitempty"`
+}
+
+func newCheck(err error, required bool) check {
+	c := check{OK: err == nil, Required: required}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	return c
+}
+
+// upstreamTTL is how long the reachability of Overpass and the OSM API is
+// remembered, so frequent probes do not turn into upstream traffic.
+const upstreamTTL = 30 * time.Second
+
+// upstream is a service the theme uses; a required one must answer for the
+// server to be ready.
+type upstream struct {
+	name     string
+	required bool
+	check    func(ctx context.Context) error
+}
+
+// upstreams returns the services the theme uses. Only bbox mode serves its
+// map from them, Overpass for /data unless an extract holds the nodes and the
+// OSM API for reading and editing elements. The dataset is served from memory,
+// so its refreshes and edits are only reported: an outage there must not take
+// a map that still shows its data out of rotation.
+func upstreams(cfg *config.Config, theme *config.Theme) []upstream {
+	var deps []upstream
+	if cfg.ExtractFile == "" || theme.Elements == "way" {
+		deps = append(deps, upstream{"overpass", theme.Mode == config.ModeBBox, osm.CheckOverpass})
+	}
+	deps = append(deps, upstream{"osmAPI", theme.Mode == config.ModeBBox, func(ctx context.Context) error {
+		return osm.CheckOSMAPI(ctx, cfg)
+	}})
+	return deps
+}
+
+var (
+	upstreamMu      sync.Mutex
+	upstreamChecked = map[string]time.Time{}
+	upstreamErrs    = map[string]error{}
+)
+
+// checkUpstream returns the reachability of the service, checked again when
+// the last result is older than upstreamTTL. The check does not use the
+// context of the probe, whose cancellation would be remembered too.
+func checkUpstream(u upstream) error {
+	upstreamMu.Lock()
+	defer upstreamMu.Unlock()
+	if time.Since(upstreamChecked[u.name]) >= upstreamTTL {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		upstreamErrs[u.name] = u.check(ctx)
+		upstreamChecked[u.name] = time.Now()
+	}
+	return upstreamErrs[u.name]
+}
+
+// HandleReadyz reports whether the server can do its job: the dataset is
+// loaded in dataset mode, and the services the theme depends on answer, see
+// upstreams. It fails with 503 while one of those does not hold or the
+// server is shutting down.
+func HandleReadyz(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		theme := cfg.Theme()
+		checks := map[string]check{}
+		if theme.Mode == config.ModeDataset {
+			var err error
+			if status := osm.Status(); status.Nodes == 0 {
+				err = fmt.Errorf("no nodes loaded yet")
+			}
+			checks["dataset"] = newCheck(err, true)
+		}
+		for _, u := range upstreams(cfg, theme) {
+			checks[u.name] = newCheck(checkUpstream(u), u.required)
+		}
+
+		ready := !draining.Load()
+		for _, c := range checks {
+			if c.Required && !c.OK {
+				ready = false
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(struct {
+			Ready    bool             `json:"ready"`
+			Draining bool             `json:"draining,omitempty"`
+			Checks   map[string]check `json:"checks"`
+		}{ready, draining.Load(), checks})
+	}
+}
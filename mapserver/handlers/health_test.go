@@ -0,0 +1,193 @@
+// handlers/health_test.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"mapserver/config"
+	"mapserver/osm"
+	"net/http"
+	"net/http/httptest"
+	"osmkit/fakeosm"
+	"strings"
+	"testing"
+)
+
+const waterFixture = `<osm version="0.6">
+ <node id="1" version="1" lat="44.43" lon="26.10"><tag k="amenity" v="drinking_water"/></node>
+</osm>`
+
+// services are the Overpass instance and OSM API of a test, each of which
+// can be taken down.
+type services struct {
+	overpassDown, osmDown bool
+	api                   *fakeosm.Server
+}
+
+func (u *services) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	overpass := r.URL.Path == "/api/interpreter" || r.URL.Path == "/api/status"
+	if (u.overpassDown && overpass) || (u.osmDown && strings.HasPrefix(r.URL.Path, "/api/0.6/")) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+		return
+	}
+	u.api.ServeHTTP(w, r)
+}
+
+// newTestServer loads a theme with Overpass and the OSM API served by u, and
+// forgets the readiness of an earlier test.
+func newTestServer(t *testing.T, themeFile string, u *services) *config.Config {
+	t.Helper()
+	u.api = fakeosm.New()
+	if err := u.api.LoadFixture(strings.NewReader(waterFixture)); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(u)
+	t.Cleanup(server.Close)
+
+	t.Setenv("CONFIG", "")
+	t.Setenv("CLIENT_ID", "test")
+	t.Setenv("CLIENT_SECRET", "test")
+	t.Setenv("REDIRECT_URI", server.URL+"/callback")
+	t.Setenv("AUTH_URL", server.URL+"/oauth2/authorize")
+	t.Setenv("TOKEN_URL", server.URL+"/oauth2/token")
+	t.Setenv("OSM_API_BASE", server.URL+"/api/0.6")
+	t.Setenv("OVERPASS_URL", server.URL+"/api/interpreter")
+	t.Setenv("SNAPSHOT_DIR", t.TempDir())
+	cfg, err := config.Load("", themeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	osm.Init(cfg)
+	osm.Overpass.Attempts = 1
+
+	forgetUpstreams()
+	draining.Store(false)
+	t.Cleanup(func() { draining.Store(false) })
+	return cfg
+}
+
+// forgetUpstreams makes the next probe check every upstream again.
+func forgetUpstreams() {
+	upstreamMu.Lock()
+	defer upstreamMu.Unlock()
+	clear(upstreamChecked)
+}
+
+type readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks map[string]check `json:"checks"`
+}
+
+func probe(t *testing.T, handler http.HandlerFunc, path string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", path, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestHealthz(t *testing.T) {
+	cfg := newTestServer(t, "../themes/toilet.yaml", &services{overpassDown: true, osmDown: true})
+	Drain()
+	if code, body := probe(t, HandleHealthz(cfg), "/healthz"); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("got %d %q while draining with every upstream down, want 200", code, body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name     string
+		theme    string
+		upstream services
+		drain    bool
+		want     int
+		failed   string // the required check that failed
+	}{
+		{name: "bbox", theme: "../themes/toilet.yaml", want: http.StatusOK},
+		{name: "draining", theme: "../themes/toilet.yaml", drain: true, want: http.StatusServiceUnavailable},
+		{name: "OSM API down", theme: "../themes/toilet.yaml", upstream: services{osmDown: true}, want: http.StatusServiceUnavailable, failed: "osmAPI"},
+		{name: "Overpass down in bbox mode", theme: "../themes/toilet.yaml", upstream: services{overpassDown: true}, want: http.StatusServiceUnavailable, failed: "overpass"},
+		{name: "Overpass down for ways", theme: "../themes/zoning.yaml", upstream: services{overpassDown: true}, want: http.StatusServiceUnavailable, failed: "overpass"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestServer(t, tt.theme, &tt.upstream)
+			if tt.drain {
+				Drain()
+			}
+			code, body := probe(t, HandleReadyz(cfg), "/readyz")
+			var got readiness
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("%d %s: %v", code, body, err)
+			}
+			if code != tt.want || got.Ready != (tt.want == http.StatusOK) {
+				t.Errorf("got %d %s, want %d", code, body, tt.want)
+			}
+			if tt.failed != "" {
+				if c := got.Checks[tt.failed]; c.OK || !c.Required || c.Error == "" {
+					t.Errorf("check %s = %+v, want a failed required check", tt.failed, c)
+				}
+			}
+		})
+	}
+}
+
+func TestReadyzDataset(t *testing.T) {
+	u := &services{}
+	cfg := newTestServer(t, "../themes/water.yaml", u)
+	code, body := probe(t, HandleReadyz(cfg), "/readyz")
+	if code != http.StatusServiceUnavailable || !strings.Contains(body, "no nodes loaded yet") {
+		t.Fatalf("got %d %s before the first refresh, want 503", code, body)
+	}
+
+	if err := osm.Refresh(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := probe(t, HandleReadyz(cfg), "/readyz"); code != http.StatusOK {
+		t.Fatalf("got %d %s with the dataset loaded, want 200", code, body)
+	}
+
+	// The dataset is served from memory, so Overpass and the OSM API going
+	// down only shows in the report
+	u.overpassDown, u.osmDown = true, true
+	forgetUpstreams()
+	code, body = probe(t, HandleReadyz(cfg), "/readyz")
+	var got readiness
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK {
+		t.Errorf("got %d %s, want ready with the upstreams reported down", code, body)
+	}
+	for _, name := range []string{"overpass", "osmAPI"} {
+		if c := got.Checks[name]; c.OK || c.Required {
+			t.Errorf("check %s = %+v, want a failed check that is not required", name, c)
+		}
+	}
+}
+
+func TestReadyzExtract(t *testing.T) {
+	cfg := newTestServer(t, "../themes/toilet.yaml", &services{overpassDown: true})
+	cfg.ExtractFile = "../../osmkit/extract/testdata/sample.osm"
+	code, body := probe(t, HandleReadyz(cfg), "/readyz")
+	var got readiness
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	// The nodes come from the extract, so Overpass is not even asked
+	if _, ok := got.Checks["overpass"]; code != http.StatusOK || ok {
+		t.Errorf("got %d %s, want ready without an Overpass check", code, body)
+	}
+}
+
+func TestReadyzRemembersUpstreams(t *testing.T) {
+	u := &services{}
+	cfg := newTestServer(t, "../themes/toilet.yaml", u)
+	if code, _ := probe(t, HandleReadyz(cfg), "/readyz"); code != http.StatusOK {
+		t.Fatalf("got %d, want 200", code)
+	}
+	// Within upstreamTTL the last result is used, without asking again
+	u.osmDown = true
+	if code, body := probe(t, HandleReadyz(cfg), "/readyz"); code != http.StatusOK {
+		t.Errorf("got %d %s, want the remembered result", code, body)
+	}
+}
@@ -0,0 +1,116 @@
+// handlers/nodes.go
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"mapserver/config"
+	"mapserver/osm"
+	"net/http"
+	"osmkit/apperr"
+	"osmkit/tags"
+	"strconv"
+)
+
+// pathID reads the numeric {id} of the route.
+func pathID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, apperr.New(apperr.Validation, "Invalid ID %q", r.PathValue("id"))
+	}
+	return id, nil
+}
+
+func HandleFetchNode(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodeID, err := pathID(r)
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		node, err := osm.FetchNodeDetails(cfg, nodeID)
+		if err != nil {
+			apperr.Write(w, r, fmt.Errorf("failed to fetch node details: %w", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(node)
+	}
+}
+
+func HandleUpdateNode(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodeID, err := pathID(r)
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			apperr.Write(w, r, apperr.Wrap(apperr.Validation, err, "Failed to read request body"))
+			return
+		}
+		patch, err := tags.DecodePatch(body)
+		if err != nil {
+			apperr.Write(w, r, apperr.Wrap(apperr.Validation, err, "Failed to parse request body"))
+			return
+		}
+
+		token, userID, err := sessionUser(cfg, r, "update a node")
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		err = osm.UpdateNodeDetails(r.Context(), cfg, token, userID, nodeID, patch)
+		var conflict *tags.ConflictError
+		if errors.As(err, &conflict) {
+			// The page asks the user whether to overwrite the conflicting keys
+			slog.InfoContext(r.Context(), "Conflicting edit", "node", nodeID, "error", err)
+			apperr.Write(w, r, err)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error updating node details", "node", nodeID, "error", err)
+			apperr.Write(w, r, fmt.Errorf("failed to update node details: %w", err))
+			return
+		}
+
+		fmt.Fprintf(w, "Node updated successfully")
+	}
+}
+
+func HandleAddNode(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var node struct {
+			Lat  float64           `json:"lat"`
+			Lon  float64           `json:"lon"`
+			Tags map[string]string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&node); err != nil {
+			apperr.Write(w, r, apperr.Wrap(apperr.Validation, err, "Failed to parse request body"))
+			return
+		}
+
+		token, userID, err := sessionUser(cfg, r, "add a new source")
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		nodeID, err := osm.CreateNode(r.Context(), cfg, token, userID, node.Lat, node.Lon, node.Tags)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error creating node", "error", err)
+			apperr.Write(w, r, err)
+			return
+		}
+
+		fmt.Fprintf(w, "Node %d created successfully", nodeID)
+	}
+}
@@ -0,0 +1,176 @@
+// handlers/ways.go
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mapserver/config"
+	"mapserver/osm"
+	"net/http"
+	"osmkit/apperr"
+	"osmkit/osmchange"
+	"osmkit/tags"
+)
+
+func HandleAddWay(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var way struct {
+			Nodes []int64           `json:"nodes"`
+			Tags  map[string]string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&way); err != nil {
+			apperr.Write(w, r, apperr.Wrap(apperr.Validation, err, "Failed to parse request body"))
+			return
+		}
+
+		token, userID, err := sessionUser(cfg, r, "add a new road")
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		wayID, err := osm.CreateWay(r.Context(), cfg, token, userID, way.Nodes, way.Tags)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to create way", "error", err)
+			apperr.Write(w, r, err)
+			return
+		}
+
+		fmt.Fprintf(w, "Way %d created successfully", wayID)
+	}
+}
+
+func HandleUpdateWay(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wayID, patch, err := decodeWayPatch(r)
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		token, userID, err := sessionUser(cfg, r, "update this road")
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		if err := osm.UpdateWayTags(r.Context(), cfg, token, userID, wayID, patch); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to update way", "way", wayID, "error", err)
+			apperr.Write(w, r, err)
+			return
+		}
+
+		fmt.Fprintf(w, "Way updated successfully")
+	}
+}
+
+// HandleAddPendingChange queues a tag patch for the next save, so all edits of
+// a session are uploaded together.
+func HandleAddPendingChange(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wayID, patch, err := decodeWayPatch(r)
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		_, userID, err := sessionUser(cfg, r, "edit this road")
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		if err := osm.AddPendingChange(cfg, userID, wayID, patch); err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+		slog.InfoContext(r.Context(), "Queued change", "way", wayID, "user_id", userID)
+
+		fmt.Fprintf(w, "Change queued, %d ways waiting to be saved", len(osm.GetPendingChanges(userID)))
+	}
+}
+
+// HandleDropPendingChange drops the queued patch of a way, such as one that
+// conflicts with someone else's edit, so the other ways can still be saved.
+func HandleDropPendingChange(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wayID, err := pathID(r)
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		_, userID, err := sessionUser(cfg, r, "edit this road")
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		if !osm.RemovePendingChange(userID, wayID) {
+			apperr.Write(w, r, apperr.New(apperr.Gone, "No change of way %d is queued", wayID))
+			return
+		}
+		slog.InfoContext(r.Context(), "Dropped queued change", "way", wayID, "user_id", userID)
+
+		fmt.Fprintf(w, "Change dropped, %d ways waiting to be saved", len(osm.GetPendingChanges(userID)))
+	}
+}
+
+func HandleSaveChanges(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, userID, err := sessionUser(cfg, r, "save changes")
+		if err != nil {
+			apperr.Write(w, r, err)
+			return
+		}
+
+		chunks, err := osm.SaveChanges(r.Context(), cfg, token, userID)
+		if err != nil && len(chunks) == 0 {
+			slog.ErrorContext(r.Context(), "Failed to save changes", "error", err)
+			apperr.Write(w, r, err)
+			return
+		}
+
+		response := struct {
+			Changesets []int64                 `json:"changesets"`
+			Chunks     []osmchange.ChunkResult `json:"chunks"`
+			Error      apperr.Kind             `json:"error,omitempty"`
+			Message    string                  `json:"message,omitempty"`
+		}{Changesets: []int64{}, Chunks: []osmchange.ChunkResult{}}
+		if chunks != nil {
+			response.Chunks = chunks
+		}
+		for _, chunk := range chunks {
+			if chunk.Status == osmchange.ChunkUploaded {
+				response.Changesets = append(response.Changesets, chunk.Changeset)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			// Some chunks may have been saved already, so report them along with the error
+			slog.ErrorContext(r.Context(), "Failed to save changes", "error", err)
+			response.Error, response.Message = apperr.KindOf(err), apperr.Message(err)
+			w.WriteHeader(apperr.KindOf(err).Status())
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// decodeWayPatch reads a {"id": ..., "set": {...}, "delete": [...], "version": n} body.
+func decodeWayPatch(r *http.Request) (int64, tags.Patch, error) {
+	var way struct {
+		ID int64 `json:"id"`
+		tags.Patch
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&way); err != nil {
+		return 0, tags.Patch{}, apperr.Wrap(apperr.Validation, err, "Failed to parse request body")
+	}
+	if err := way.Patch.Validate(); err != nil {
+		return 0, tags.Patch{}, apperr.Wrap(apperr.Validation, err, "Invalid tag patch")
+	}
+	return way.ID, way.Patch, nil
+}
@@ -0,0 +1,112 @@
+// logging/access.go
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// requestInfo is what the logs know about the request being served.
+type requestInfo struct {
+	id     string
+	userID atomic.Int64 // 0 until the session is read
+}
+
+type contextKey struct{}
+
+func requestFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(contextKey{}).(*requestInfo)
+	return info
+}
+
+// SetUser records the OSM user the request is made for, for its access log
+// line.
+func SetUser(ctx context.Context, userID int64) {
+	if info := requestFrom(ctx); info != nil {
+		info.userID.Store(userID)
+	}
+}
+
+// requestID keeps the X-Request-ID a proxy in front of us set, if it is
+// reasonable, so its logs and ours can be matched; else it makes a new one.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= 64 && isPrintable(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isPrintable(s string) bool {
+	for _, c := range s {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder remembers the status code a handler answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AccessLog gives every request an ID, returned in the X-Request-ID header
+// and added to what is logged while serving it, and logs one line per
+// request with its route, status, duration and user. The route is the
+// pattern of mux that matched, so element IDs do not make every line unique.
+func AccessLog(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{id: requestID(r)}
+		ctx := context.WithValue(r.Context(), contextKey{}, info)
+		w.Header().Set("X-Request-ID", info.id)
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		mux.ServeHTTP(recorder, r.WithContext(ctx))
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if userID := info.userID.Load(); userID != 0 {
+			attrs = append(attrs, slog.Int64("user_id", userID))
+		}
+		slog.LogAttrs(ctx, slog.LevelInfo, "request", attrs...)
+	})
+}
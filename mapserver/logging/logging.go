@@ -0,0 +1,91 @@
+// logging/logging.go
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Level is the minimum level logged, info until the configuration says
+// otherwise.
+var Level = new(slog.LevelVar)
+
+// Setup makes slog, and the log package through it, write JSON lines to w,
+// with the request ID of the context added and secrets scrubbed.
+func Setup(w io.Writer) {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: Level, ReplaceAttr: Scrub})
+	slog.SetDefault(slog.New(requestHandler{handler}))
+}
+
+const redacted = "[REDACTED]"
+
+// secretKeys are parts of attribute keys whose values are never logged.
+var secretKeys = []string{"token", "authorization", "secret", "password", "cookie"}
+
+// bearer matches a bearer token in free text such as an error message.
+var bearer = regexp.MustCompile(`(?i)(bearer\s+)[^\s"',;]+`)
+
+// Scrub redacts the attributes that would put credentials in the logs:
+// anything keyed like a token or an Authorization header, OAuth tokens and
+// headers whatever their key, and bearer tokens inside messages and strings.
+func Scrub(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	switch v := a.Value.Resolve().Any().(type) {
+	case string:
+		return slog.String(a.Key, bearer.ReplaceAllString(v, "${1}"+redacted))
+	case error:
+		return slog.String(a.Key, bearer.ReplaceAllString(v.Error(), "${1}"+redacted))
+	case *oauth2.Token, oauth2.Token:
+		return slog.String(a.Key, redacted)
+	case http.Header:
+		return slog.Any(a.Key, scrubHeader(v))
+	}
+	return a
+}
+
+// scrubHeader returns a copy of the header with its credentials redacted.
+func scrubHeader(h http.Header) http.Header {
+	scrubbed := h.Clone()
+	for name := range scrubbed {
+		lower := strings.ToLower(name)
+		for _, secret := range secretKeys {
+			if strings.Contains(lower, secret) {
+				scrubbed[name] = []string{redacted}
+				break
+			}
+		}
+	}
+	return scrubbed
+}
+
+// requestHandler adds the request ID of the context to every record.
+type requestHandler struct {
+	slog.Handler
+}
+
+func (h requestHandler) Handle(ctx context.Context, r slog.Record) error {
+	if info := requestFrom(ctx); info != nil {
+		r.AddAttrs(slog.String("request_id", info.id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestHandler) WithGroup(name string) slog.Handler {
+	return requestHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,133 @@
+// logging/logging_test.go
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+const secret = "s3cr3t-0f-the-user"
+
+func TestScrub(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+secret)
+	header.Set("Cookie", "session="+secret)
+	header.Set("Accept", "application/json")
+
+	tests := []struct {
+		name string
+		attr slog.Attr
+		keep string // what must still be logged
+	}{
+		{"token key", slog.String("token", secret), `"token":"[REDACTED]"`},
+		{"access_token key", slog.String("access_token", secret), `"access_token":"[REDACTED]"`},
+		{"Authorization key", slog.String("Authorization", "Bearer "+secret), `"Authorization":"[REDACTED]"`},
+		{"client secret key", slog.String("client_secret", secret), `"client_secret":"[REDACTED]"`},
+		{"oauth token", slog.Any("creds", &oauth2.Token{AccessToken: secret, RefreshToken: secret}), `"creds":"[REDACTED]"`},
+		{"oauth token value", slog.Any("creds", oauth2.Token{AccessToken: secret}), `"creds":"[REDACTED]"`},
+		{"header", slog.Any("headers", header), `"Accept":["application/json"]`},
+		{"bearer in an error", slog.Any("err", fmt.Errorf("GET /user/details: sent Authorization: Bearer %s: 401", secret)), `GET /user/details: sent Authorization: Bearer [REDACTED]`},
+		{"bearer in a string", slog.String("upstream", `{"auth":"bearer `+secret+`"}`), `bearer [REDACTED]`},
+		{"nested in a group", slog.Group("oauth", slog.String("refresh_token", secret)), `"oauth":{"refresh_token":"[REDACTED]"}`},
+		{"logged value", slog.Any("lazy", lazyToken{}), `"lazy":"[REDACTED]"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{ReplaceAttr: Scrub}))
+			logger.LogAttrs(context.Background(), slog.LevelInfo, "login", tt.attr)
+			if strings.Contains(out.String(), secret) {
+				t.Errorf("the secret was logged: %s", out.String())
+			}
+			if !strings.Contains(out.String(), tt.keep) {
+				t.Errorf("got %s, want it to contain %s", out.String(), tt.keep)
+			}
+		})
+	}
+}
+
+// lazyToken is a slog.LogValuer that only turns into a token when logged.
+type lazyToken struct{}
+
+func (lazyToken) LogValue() slog.Value {
+	return slog.AnyValue(&oauth2.Token{AccessToken: secret})
+}
+
+func TestScrubMessage(t *testing.T) {
+	var out bytes.Buffer
+	slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{ReplaceAttr: Scrub})).Info("retrying with Bearer " + secret)
+	if strings.Contains(out.String(), secret) {
+		t.Errorf("the secret was logged: %s", out.String())
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	previous := slog.Default()
+	Setup(&out)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/nodes/{id}", func(w http.ResponseWriter, r *http.Request) {
+		SetUser(r.Context(), 42)
+		slog.InfoContext(r.Context(), "saving", "token", secret)
+		http.Error(w, "conflict", http.StatusConflict)
+	})
+	handler := AccessLog(mux)
+
+	tests := []struct {
+		name, path, requestID string
+		wantID                string // empty for a new one
+		route                 string
+		status                int
+	}{
+		{"matched", "/api/nodes/7", "proxy-1", "proxy-1", "/api/nodes/{id}", http.StatusConflict},
+		{"unmatched", "/missing", "", "", "unmatched", http.StatusNotFound},
+		{"unprintable request ID", "/missing", "bad id", "", "unmatched", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if tt.requestID != "" {
+				r.Header.Set("X-Request-ID", tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			id := w.Header().Get("X-Request-ID")
+			if tt.wantID != "" && id != tt.wantID || tt.wantID == "" && (id == "" || id == tt.requestID) {
+				t.Errorf("got request ID %q, want %q", id, tt.wantID)
+			}
+			if strings.Contains(out.String(), secret) {
+				t.Errorf("the secret was logged: %s", out.String())
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			var access struct {
+				Msg       string `json:"msg"`
+				Route     string `json:"route"`
+				Status    int    `json:"status"`
+				RequestID string `json:"request_id"`
+				UserID    int64  `json:"user_id"`
+			}
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &access); err != nil {
+				t.Fatal(err)
+			}
+			if access.Msg != "request" || access.Route != tt.route || access.Status != tt.status || access.RequestID != id {
+				t.Errorf("got access line %+v, want route %s, status %d and request ID %s", access, tt.route, tt.status, id)
+			}
+			if tt.status == http.StatusConflict && (len(lines) != 2 || access.UserID != 42) {
+				t.Errorf("got %s, want the handler's line and the user in the access line", out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"mapserver/config"
+	"mapserver/handlers"
+	"mapserver/logging"
+	"mapserver/oauth"
+	"mapserver/osm"
+	"mapserver/utils"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:]))
+	}
+
+	configFile := flag.String("config", "", "config file, $CONFIG by default; the environment overrides it")
+	themeFile := flag.String("theme", "", "theme file of the site, see themes/; overrides $THEME and the config file")
+	flag.Parse()
+
+	logging.Setup(os.Stderr)
+	cfg := config.LoadConfig(*configFile, *themeFile)
+	logging.Level.Set(cfg.LogLevel)
+	oauth.Init(cfg)
+	osm.Init(cfg)
+	go reloadOnHangup(cfg)
+
+	// Cancelled by SIGTERM, from systemd or docker stop, or by ^C
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if cfg.Theme().Mode == config.ModeDataset {
+		// Serve the last snapshot right away and fetch fresh nodes in the
+		// background, so the map comes up even when Overpass is unreachable
+		osm.WarmStart(cfg)
+		go osm.RunRefresher(ctx, cfg)
+		if cfg.DiffSource != "" {
+			go osm.RunDiffs(ctx, cfg)
+		}
+	}
+
+	mux := http.NewServeMux()
+	initializeRoutes(mux, cfg)
+
+	fs := http.FileServer(http.Dir(cfg.Theme().Static))
+	mux.Handle("GET /static/", http.StripPrefix("/static/", fs))
+
+	startServer(ctx, logging.AccessLog(mux), cfg)
+}
+
+// initializeRoutes sets up the routes of the theme: every site has the map
+// and the login, the rest depends on how it fetches its elements and which.
+func initializeRoutes(mux *http.ServeMux, cfg *config.Config) {
+	theme := cfg.Theme()
+	mux.HandleFunc("GET /{$}", handlers.HandleMap(cfg))
+	mux.HandleFunc("GET /theme", handlers.HandleTheme(cfg))
+	mux.HandleFunc("GET /login", handlers.HandleLogin(cfg))
+	mux.HandleFunc("GET /callback", handlers.HandleCallback(cfg))
+	mux.HandleFunc("GET /data", handlers.HandleData(cfg))
+	mux.HandleFunc("GET /healthz", handlers.HandleHealthz(cfg))
+	mux.HandleFunc("GET /readyz", handlers.HandleReadyz(cfg))
+	mux.Handle("GET /metrics", utils.Metrics.Handler())
+
+	switch {
+	case theme.Mode == config.ModeDataset:
+		mux.HandleFunc("GET /status", handlers.HandleStatus(cfg))
+	case theme.Elements == "node":
+		mux.HandleFunc("GET /layers", handlers.HandleLayers(cfg))
+	}
+
+	switch theme.Elements {
+	case "node":
+		mux.HandleFunc("POST /addnode", handlers.HandleAddNode(cfg))
+		mux.HandleFunc("GET /node/{id}", handlers.HandleFetchNode(cfg))
+		mux.HandleFunc("POST /updateNode/{id}", handlers.HandleUpdateNode(cfg))
+	case "way":
+		mux.HandleFunc("POST /addway", handlers.HandleAddWay(cfg))
+		mux.HandleFunc("POST /updateway", handlers.HandleUpdateWay(cfg))
+		mux.HandleFunc("POST /pendingchange", handlers.HandleAddPendingChange(cfg))
+		mux.HandleFunc("DELETE /pendingchange/{id}", handlers.HandleDropPendingChange(cfg))
+		mux.HandleFunc("POST /savechanges", handlers.HandleSaveChanges(cfg))
+	}
+}
+
+// Timeouts of the server. Writes allow for /data waiting on slow Overpass
+// mirrors and for /savechanges uploading several chunks.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 5 * time.Minute
+	idleTimeout       = 2 * time.Minute
+	// shutdownTimeout is how long the requests in flight, uploads included,
+	// get to finish once the server is told to stop.
+	shutdownTimeout = 30 * time.Second
+)
+
+// startServer serves until ctx is done, then fails /readyz for
+// cfg.DrainDelay, stops taking requests, lets those in flight finish and
+// closes the changesets left open.
+func startServer(ctx context.Context, handler http.Handler, cfg *config.Config) {
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	slog.Info("Starting", "site", cfg.Theme().Name, "port", cfg.Port)
+
+	select {
+	case err := <-serveErr:
+		slog.Error("Error starting server", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	// Fail /readyz for a while first, so load balancers stop sending
+	// requests before the listener closes
+	slog.Info("Shutting down, draining", "delay", cfg.DrainDelay.String())
+	handlers.Drain()
+	time.Sleep(cfg.DrainDelay)
+
+	slog.Info("Waiting for requests in flight", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Requests still running were cut off", "timeout", shutdownTimeout.String(), "error", err)
+	}
+	if err := oauth.CloseOpenChangesets(cfg); err != nil {
+		slog.Error("Failed to close changesets", "error", err)
+	}
+	slog.Info("Shut down")
+}
+
+// reloadOnHangup reads the theme file again on SIGHUP, so the queries,
+// layers, editable tags and changeset tags can change without a restart. The
+// rest of the configuration, secrets included, is only read at startup.
+func reloadOnHangup(cfg *config.Config) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		old, err := cfg.Reload()
+		if err != nil {
+			slog.Error("Not reloading the theme", "error", err)
+			continue
+		}
+		slog.Info("Reloaded the theme", "theme", cfg.ThemeFile)
+		osm.Reload(context.Background(), cfg, old)
+	}
+}
+
+// configCommand runs "mapserver config check", which loads the configuration
+// the way the server would and reports what is wrong with it, or what it
+// amounts to. It returns the exit status.
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: mapserver config check [-config file] [-theme file]")
+		return 2
+	}
+	flags := flag.NewFlagSet("config check", flag.ExitOnError)
+	configFile := flags.String("config", "", "config file, $CONFIG by default")
+	themeFile := flags.String("theme", "", "theme file, overrides $THEME and the config file")
+	flags.Parse(args[1:])
+
+	cfg, err := config.Load(*configFile, *themeFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "The configuration is invalid:\n")
+		var problems config.Problems
+		if errors.As(err, &problems) {
+			for _, p := range problems {
+				fmt.Fprintf(os.Stderr, "  - %s\n", p)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "  - %v\n", err)
+		}
+		return 1
+	}
+	fmt.Println("The configuration is valid:")
+	cfg.Summary(os.Stdout)
+	return 0
+}
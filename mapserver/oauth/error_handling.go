@@ -0,0 +1,18 @@
+// oauth/error_handling.go
+package oauth
+
+import (
+	"strings"
+)
+
+// IsChangesetClosedError reports whether the upload failed because the API
+// closed the changeset, after an hour of inactivity or when it filled up.
+func IsChangesetClosedError(err error) bool {
+	return strings.Contains(err.Error(), "status code 409") && strings.Contains(err.Error(), "The changeset")
+}
+
+// IsVersionMismatchError reports whether the element was changed by someone
+// else since we read it.
+func IsVersionMismatchError(err error) bool {
+	return strings.Contains(err.Error(), "status code 409") && strings.Contains(err.Error(), "Version mismatch")
+}
@@ -0,0 +1,231 @@
+// oauth/oauth.go
+package oauth
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mapserver/config"
+	"mapserver/utils"
+	"net/http"
+	"osmkit/apperr"
+	"osmkit/changeset"
+	"osmkit/osmxml"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/oauth2"
+)
+
+var (
+	Oauth2Config *oauth2.Config
+	Store        = sessions.NewCookieStore([]byte("super-secret-key"))
+	Changesets   = changeset.NewManager() // Open changeset of each OSM user
+)
+
+// changesetTokens remembers the token each user's changeset was opened with,
+// so open changesets can be closed on shutdown, after the requests are gone.
+var (
+	tokensMu        sync.Mutex
+	changesetTokens = map[int64]*oauth2.Token{} // user ID -> token
+)
+
+func Init(cfg *config.Config) {
+	// Register oauth2.Token with gob
+	gob.Register(&oauth2.Token{})
+
+	Oauth2Config = &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURI,
+		Scopes: []string{
+			"read_prefs",
+			"write_prefs",
+			"write_api",
+		},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  cfg.AuthURL,
+			TokenURL: cfg.TokenURL,
+		},
+	}
+
+	Changesets.MaxElements = cfg.MaxChangesetElements
+	utils.UserAgent = cfg.Theme().CreatedBy
+
+	Store.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   3600 * 24, // Session expires in one day
+		HttpOnly: true,      // Prevents JavaScript access to the cookie
+		// Sites behind HTTPS only send the cookie over HTTPS
+		Secure: strings.HasPrefix(cfg.RedirectURI, "https://"),
+	}
+}
+
+// httpContext makes the oauth2 package use utils.HTTPClient, which times the
+// calls to the OSM API.
+func httpContext() context.Context {
+	return context.WithValue(context.Background(), oauth2.HTTPClient, utils.HTTPClient)
+}
+
+// Exchange turns the code of the OAuth callback into a token.
+func Exchange(code string) (*oauth2.Token, error) {
+	return Oauth2Config.Exchange(httpContext(), code)
+}
+
+// clientTimeout bounds the requests made with a user's token. It is longer
+// than the timeout of utils.HTTPClient, as it covers changeset uploads.
+const clientTimeout = 2 * time.Minute
+
+// Client returns an HTTP client sending the user's token.
+func Client(token *oauth2.Token) *http.Client {
+	client := Oauth2Config.Client(httpContext(), token)
+	client.Timeout = clientTimeout
+	return client
+}
+
+// FetchUserID returns the OSM user ID the token belongs to.
+func FetchUserID(cfg *config.Config, token *oauth2.Token) (int64, error) {
+	req, err := utils.CreateRequest("GET", cfg.OSMAPIBase+"/user/details.json", "application/json", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := utils.DoRequest(Client(token), req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch user details: %w", err)
+	}
+
+	var details struct {
+		User struct {
+			ID int64 `json:"id"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(body, &details); err != nil {
+		return 0, apperr.Wrap(apperr.UpstreamUnavailable, err, "failed to parse user details")
+	}
+	if details.User.ID == 0 {
+		return 0, apperr.New(apperr.UpstreamUnavailable, "user details did not contain an id")
+	}
+	return details.User.ID, nil
+}
+
+// UserID returns the OSM user ID saved in the session at login, looking it up
+// with the token for sessions created before it was saved.
+func UserID(cfg *config.Config, session *sessions.Session, token *oauth2.Token) (int64, error) {
+	if userID, ok := session.Values["osm-user-id"].(int64); ok {
+		return userID, nil
+	}
+	userID, err := FetchUserID(cfg, token)
+	if err != nil {
+		return 0, err
+	}
+	session.Values["osm-user-id"] = userID
+	return userID, nil
+}
+
+// OpenChangeset opens a new changeset with the comment and tags of the theme.
+func OpenChangeset(ctx context.Context, cfg *config.Config, token *oauth2.Token) (int64, error) {
+	theme := cfg.Theme()
+	changesetTags := map[string]string{
+		"created_by": theme.CreatedBy,
+		"comment":    theme.ChangesetComment,
+	}
+	if theme.ChangesetHashtags != "" {
+		changesetTags["hashtags"] = theme.ChangesetHashtags
+	}
+	xmlData, err := osmxml.NewChangeset(changesetTags).Marshal()
+	if err != nil {
+		return 0, err
+	}
+	req, err := utils.CreateRequest("PUT", cfg.OSMAPIBase+"/changeset/create", "text/xml", xmlData)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := utils.DoRequest(Client(token), req)
+	if err != nil {
+		return 0, err
+	}
+
+	var changesetID int64
+	fmt.Sscanf(string(body), "%d", &changesetID)
+	if changesetID == 0 {
+		return 0, apperr.New(apperr.UpstreamUnavailable, "unexpected changeset creation response: %s", string(body))
+	}
+	slog.InfoContext(ctx, "Created changeset", "changeset", changesetID)
+	utils.ChangesetsOpened.Inc()
+	return changesetID, nil
+}
+
+// CurrentChangeset returns the user's open changeset, opening a new one when
+// the user has none or the previous one idled out or filled up.
+func CurrentChangeset(ctx context.Context, cfg *config.Config, token *oauth2.Token, userID int64) (int64, error) {
+	return ReserveChangeset(ctx, cfg, token, userID, 1)
+}
+
+// ReserveChangeset is CurrentChangeset for an upload of n elements.
+func ReserveChangeset(ctx context.Context, cfg *config.Config, token *oauth2.Token, userID int64, n int) (int64, error) {
+	return Changesets.Reserve(userID, n, func() (int64, error) {
+		slog.InfoContext(ctx, "Opening a new changeset", "user_id", userID)
+		id, err := OpenChangeset(ctx, cfg, token)
+		if err == nil {
+			tokensMu.Lock()
+			changesetTokens[userID] = token
+			tokensMu.Unlock()
+		}
+		return id, err
+	})
+}
+
+// CloseCurrentChangeset closes the user's open changeset, if any.
+func CloseCurrentChangeset(ctx context.Context, cfg *config.Config, token *oauth2.Token, userID int64) error {
+	current, open := Changesets.Take(userID)
+	if !open {
+		return nil
+	}
+	return closeChangeset(ctx, cfg, token, current.ID)
+}
+
+// CloseOpenChangesets closes the changeset of every user, for a shutdown:
+// edits made after a restart go to a new one anyway, so leaving them open
+// would only keep them from showing as done for the next hour.
+func CloseOpenChangesets(cfg *config.Config) error {
+	var errs []error
+	for _, cs := range Changesets.Open() {
+		current, open := Changesets.Take(cs.UserID)
+		if !open {
+			continue
+		}
+		tokensMu.Lock()
+		token := changesetTokens[cs.UserID]
+		tokensMu.Unlock()
+		if token == nil {
+			continue
+		}
+		if err := closeChangeset(context.Background(), cfg, token, current.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func closeChangeset(ctx context.Context, cfg *config.Config, token *oauth2.Token, changesetID int64) error {
+	endpointURL := fmt.Sprintf("%s/changeset/%d/close", cfg.OSMAPIBase, changesetID)
+	req, err := utils.CreateRequest("PUT", endpointURL, "text/xml", nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := utils.DoRequest(Client(token), req); err != nil {
+		return fmt.Errorf("failed to close changeset %d: %w", changesetID, err)
+	}
+
+	slog.InfoContext(ctx, "Closed changeset", "changeset", changesetID)
+	utils.ChangesetsClosed.Inc()
+	return nil
+}
@@ -0,0 +1,32 @@
+// oauth/oauth_test.go
+package oauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestClient(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+	Oauth2Config = &oauth2.Config{ClientID: "test"}
+
+	client := Client(&oauth2.Token{AccessToken: "test"})
+	if client.Timeout != clientTimeout {
+		t.Errorf("timeout = %s, want %s", client.Timeout, clientTimeout)
+	}
+	resp, err := client.Get(server.URL + "/api/0.6/user/details.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if authorization != "Bearer test" {
+		t.Errorf("Authorization = %q, want the user's token", authorization)
+	}
+}
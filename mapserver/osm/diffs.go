@@ -0,0 +1,124 @@
+// osm/diffs.go
+package osm
+
+import (
+	"context"
+	"log/slog"
+	"mapserver/config"
+	"osmkit/osmchange"
+	"osmkit/overpassql"
+	"osmkit/replication"
+	"sort"
+	"time"
+)
+
+// maxDiffLag is how many diffs we catch up on; when further behind we skip to
+// the newest one and leave the rest to the next full refresh.
+const maxDiffLag = 24 * 60
+
+// replicated is the state of the last diff applied, guarded by datasetMu.
+var replicated replication.State
+
+// RunDiffs applies the replication diffs of cfg.DiffSource to the dataset
+// every cfg.DiffInterval until ctx is done. It starts from the newest diff,
+// earlier edits are left to the full refreshes. The query of the theme is
+// read on every pass, as it changes when the theme is reloaded.
+func RunDiffs(ctx context.Context, cfg *config.Config) {
+	src := replication.NewSource(cfg.DiffSource)
+	src.UserAgent = cfg.Theme().CreatedBy
+
+	for {
+		filter, err := overpassql.Parse(cfg.Theme().Query)
+		if err != nil {
+			slog.Error("Not applying replication diffs, the query can't be used as a filter", "error", err)
+		} else if err := applyDiffs(ctx, cfg, src, filter); err != nil {
+			slog.Error("Applying replication diffs failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cfg.DiffInterval):
+		}
+	}
+}
+
+// applyDiffs applies every diff newer than the last one applied.
+func applyDiffs(ctx context.Context, cfg *config.Config, src *replication.Source, filter *overpassql.Query) error {
+	newest, err := src.State(ctx)
+	if err != nil {
+		return err
+	}
+
+	datasetMu.RLock()
+	sequence := replicated.Sequence
+	datasetMu.RUnlock()
+	if sequence == 0 || newest.Sequence-sequence > maxDiffLag {
+		slog.Info("Following replication diffs", "source", cfg.DiffSource, "sequence", newest.Sequence)
+		datasetMu.Lock()
+		replicated = newest
+		datasetMu.Unlock()
+		return nil
+	}
+
+	for seq := sequence + 1; seq <= newest.Sequence; seq++ {
+		changes, err := src.Diff(ctx, seq)
+		if err != nil {
+			return err
+		}
+		state := replication.State{Sequence: seq}
+		if seq == newest.Sequence {
+			state.Timestamp = newest.Timestamp
+		}
+		if nodes, changed := applyChanges(cfg, filter, changes, state); changed > 0 {
+			slog.Info("Applied replication diff", "sequence", seq, "changed", changed, "nodes", len(nodes))
+			if err := SaveSnapshot(cfg, nodes); err != nil {
+				slog.Error("Failed to save snapshot", "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyChanges applies the node changes of one diff to the dataset and
+// returns the new dataset and the number of nodes added, updated or removed.
+// Nodes are kept when they match filter inside cfg.DiffBBox; a node that no
+// longer does is removed like a deleted one. Ways and relations are not part
+// of the dataset.
+func applyChanges(cfg *config.Config, filter *overpassql.Query, changes []osmchange.Change, state replication.State) ([]Node, int) {
+	datasetMu.Lock()
+	defer datasetMu.Unlock()
+	replicated = state
+
+	byID := make(map[int64]Node, len(dataset))
+	for _, n := range dataset {
+		byID[n.ID] = n
+	}
+	changed := 0
+	for _, c := range changes {
+		if c.Node == nil {
+			continue
+		}
+		n := c.Node
+		tags := n.Tags.Map()
+		if c.Action != osmchange.Delete && cfg.DiffBBox.Contains(n.Lat, n.Lon) && filter.Match("node", tags) {
+			byID[n.ID] = Node{Type: "node", ID: n.ID, Lat: n.Lat, Lon: n.Lon, Tags: tags}
+			changed++
+		} else if _, ok := byID[n.ID]; ok {
+			delete(byID, n.ID)
+			changed++
+		}
+	}
+	if changed == 0 {
+		return dataset, 0
+	}
+
+	nodes := make([]Node, 0, len(byID))
+	for _, n := range byID {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	dataset = nodes
+	updated = time.Now()
+	status.Nodes = len(nodes)
+	return nodes, changed
+}
@@ -0,0 +1,187 @@
+// osm/diffs_test.go
+package osm
+
+import (
+	"compress/gzip"
+	"context"
+	"mapserver/config"
+	"os"
+	"osmkit/apperr"
+	"osmkit/osmchange"
+	"osmkit/osmxml"
+	"osmkit/overpassql"
+	"osmkit/replication"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestDiffs serves nodes from the dataset and returns a configuration
+// keeping diffed nodes inside Romania, with the query as filter.
+func newTestDiffs(t *testing.T, nodes []Node) (*config.Config, *overpassql.Query) {
+	t.Helper()
+	cfg := &config.Config{
+		DiffBBox:     overpassql.BBox{South: 43.6, West: 20.2, North: 48.3, East: 29.8},
+		SnapshotDir:  t.TempDir(),
+		SnapshotKeep: 2,
+	}
+	filter, err := overpassql.Parse(waterQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	datasetMu.Lock()
+	dataset, status, replicated = nodes, RefreshStatus{Nodes: len(nodes)}, replication.State{}
+	datasetMu.Unlock()
+	return cfg, filter
+}
+
+func nodeIDs(nodes []Node) []int64 {
+	ids := []int64{}
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func changedNode(action osmchange.Action, id int64, lat, lon float64, tags map[string]string) osmchange.Change {
+	return osmchange.Change{Action: action, Node: &osmxml.Node{ID: id, Version: 2, Lat: lat, Lon: lon, Tags: osmxml.TagsFromMap(tags)}}
+}
+
+func TestApplyChanges(t *testing.T) {
+	water := map[string]string{"amenity": "drinking_water"}
+	tests := []struct {
+		name        string
+		change      osmchange.Change
+		wantIDs     []int64
+		wantChanged int
+	}{
+		{"created", changedNode(osmchange.Create, 3, 44.44, 26.1, water), []int64{1, 2, 3}, 1},
+		{"moved", changedNode(osmchange.Modify, 1, 44.45, 26.2, water), []int64{1, 2}, 1},
+		{"deleted", changedNode(osmchange.Delete, 2, 0, 0, nil), []int64{1}, 1},
+		{"unknown node deleted", changedNode(osmchange.Delete, 9, 0, 0, nil), []int64{1, 2}, 0},
+		{"tag removed", changedNode(osmchange.Modify, 1, 44.43, 26.1, map[string]string{"amenity": "bench"}), []int64{2}, 1},
+		{"moved out of the area", changedNode(osmchange.Modify, 1, 52.52, 13.4, water), []int64{2}, 1},
+		{"created outside the area", changedNode(osmchange.Create, 3, 52.52, 13.4, water), []int64{1, 2}, 0},
+		{"created without the tag", changedNode(osmchange.Create, 3, 44.44, 26.1, map[string]string{"amenity": "bench"}), []int64{1, 2}, 0},
+		{"way", osmchange.Change{Action: osmchange.Delete, Way: &osmxml.Way{ID: 1, Version: 2}}, []int64{1, 2}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, filter := newTestDiffs(t, drinkingWater(2))
+			state := replication.State{Sequence: 42, Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+
+			nodes, changed := applyChanges(cfg, filter, []osmchange.Change{tt.change}, state)
+			if changed != tt.wantChanged || !reflect.DeepEqual(nodeIDs(nodes), tt.wantIDs) {
+				t.Errorf("got nodes %v with %d changed, want %v with %d", nodeIDs(nodes), changed, tt.wantIDs, tt.wantChanged)
+			}
+			if got := nodeIDs(CurrentNodes()); !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("serving %v, want %v", got, tt.wantIDs)
+			}
+			st := Status()
+			if st.Nodes != len(tt.wantIDs) || st.Sequence != 42 || st.ReplicatedTo == nil || !st.ReplicatedTo.Equal(state.Timestamp) {
+				t.Errorf("status %+v, want %d nodes replicated to sequence 42", st, len(tt.wantIDs))
+			}
+		})
+	}
+}
+
+func TestApplyChangesInOrder(t *testing.T) {
+	cfg, filter := newTestDiffs(t, drinkingWater(1))
+	water := map[string]string{"amenity": "drinking_water"}
+	changes := []osmchange.Change{
+		changedNode(osmchange.Create, 2, 44.44, 26.1, water),
+		changedNode(osmchange.Modify, 2, 44.45, 26.2, water),
+		changedNode(osmchange.Delete, 1, 0, 0, nil),
+	}
+	nodes, _ := applyChanges(cfg, filter, changes, replication.State{Sequence: 1})
+	if len(nodes) != 1 || nodes[0].ID != 2 || nodes[0].Lat != 44.45 {
+		t.Errorf("got %+v, want node 2 at its last position", nodes)
+	}
+}
+
+// replicationDir is a replication feed on disk.
+type replicationDir struct {
+	t   *testing.T
+	dir string
+}
+
+func (r replicationDir) state(sequence int64) {
+	r.t.Helper()
+	text := "sequenceNumber=" + strconv.FormatInt(sequence, 10) + "\ntimestamp=2024-05-01T10\\:00\\:00Z\n"
+	if err := os.WriteFile(filepath.Join(r.dir, "state.txt"), []byte(text), 0o644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func (r replicationDir) diff(sequence int64, body string) {
+	r.t.Helper()
+	name := filepath.Join(r.dir, filepath.FromSlash(replication.Path(sequence))+".osc.gz")
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		r.t.Fatal(err)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write([]byte(`<osmChange version="0.6">` + body + `</osmChange>`)); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func TestApplyDiffs(t *testing.T) {
+	cfg, filter := newTestDiffs(t, drinkingWater(2))
+	feed := replicationDir{t: t, dir: t.TempDir()}
+	src := replication.NewSource(feed.dir)
+	ctx := context.Background()
+
+	// The first run only notes where the feed is
+	feed.state(100)
+	if err := applyDiffs(ctx, cfg, src, filter); err != nil {
+		t.Fatal(err)
+	}
+	if st := Status(); st.Sequence != 100 || len(CurrentNodes()) != 2 {
+		t.Fatalf("status %+v after the first run, want sequence 100 and the dataset unchanged", st)
+	}
+
+	feed.diff(101, `<create><node id="3" version="1" lat="44.44" lon="26.1"><tag k="amenity" v="drinking_water"/></node></create>`)
+	feed.diff(102, `<delete><node id="1" version="2"/></delete>`)
+	feed.state(102)
+	if err := applyDiffs(ctx, cfg, src, filter); err != nil {
+		t.Fatal(err)
+	}
+	if got := nodeIDs(CurrentNodes()); !reflect.DeepEqual(got, []int64{2, 3}) {
+		t.Errorf("serving %v after diffs 101 and 102, want [2 3]", got)
+	}
+	if st := Status(); st.Sequence != 102 || st.ReplicatedTo == nil {
+		t.Errorf("status %+v, want sequence 102 with its timestamp", st)
+	}
+	if nodes, _, err := LoadSnapshot(cfg); err != nil || !reflect.DeepEqual(nodeIDs(nodes), []int64{2, 3}) {
+		t.Errorf("snapshot holds %v, %v, want the diffed dataset", nodeIDs(nodes), err)
+	}
+
+	// A missing diff stops the catch up where it is
+	feed.state(104)
+	feed.diff(104, `<delete><node id="2" version="2"/></delete>`)
+	if err := applyDiffs(ctx, cfg, src, filter); !apperr.Is(err, apperr.Gone) {
+		t.Errorf("got error %v for missing diff 103, want %s", err, apperr.Gone)
+	}
+	if st := Status(); st.Sequence != 102 || len(CurrentNodes()) != 2 {
+		t.Errorf("status %+v, want the dataset of sequence 102", st)
+	}
+
+	// Too far behind, the diffs in between are skipped
+	feed.state(102 + maxDiffLag + 1)
+	if err := applyDiffs(ctx, cfg, src, filter); err != nil {
+		t.Fatal(err)
+	}
+	if st := Status(); st.Sequence != 102+maxDiffLag+1 || len(CurrentNodes()) != 2 {
+		t.Errorf("status %+v, want a jump to the newest sequence", st)
+	}
+}
@@ -0,0 +1,78 @@
+// osm/extract.go
+package osm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mapserver/config"
+	"osmkit/extract"
+	"osmkit/overpassql"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Extract holds the elements of every layer read from cfg.ExtractFile, when
+// /data is served from a local extract rather than Overpass in bbox mode.
+// It is replaced under extractMu when the layers are reloaded.
+var (
+	Extract   []Node
+	extractMu sync.RWMutex
+)
+
+// loadExtract reads the elements matching the selectors from cfg.ExtractFile,
+// an .osm.pbf or .osm file. Ways and areas are reduced to the center of their
+// outline.
+func loadExtract(ctx context.Context, cfg *config.Config, selectors []overpassql.Selector) ([]Node, error) {
+	start := time.Now()
+	elements, err := extract.Load(ctx, cfg.ExtractFile, selectors)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Loaded extract", "elements", len(elements), "path", cfg.ExtractFile, "duration", time.Since(start).String())
+
+	nodes := make([]Node, 0, len(elements))
+	for _, e := range elements {
+		nodes = append(nodes, Node{Type: e.Type, ID: e.ID, Lat: e.Lat, Lon: e.Lon, Tags: e.Tags, Version: e.Version})
+	}
+	return nodes, nil
+}
+
+// LoadExtract reads the dataset from the extract instead of asking Overpass,
+// using the tag filters of the query.
+func LoadExtract(ctx context.Context, cfg *config.Config) ([]Node, string, error) {
+	q, err := overpassql.Parse(cfg.Theme().Query)
+	if err != nil {
+		return nil, "", fmt.Errorf("the query can't be used as a filter: %w", err)
+	}
+	nodes, err := loadExtract(ctx, cfg, q.Selectors())
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes, "extract " + filepath.Base(cfg.ExtractFile), nil
+}
+
+// LoadLayerExtract reads the elements of every layer from the extract.
+func LoadLayerExtract(ctx context.Context, cfg *config.Config) ([]Node, error) {
+	var selectors []overpassql.Selector
+	for _, l := range cfg.Theme().Layers {
+		selectors = append(selectors, l.Parsed.Selectors()...)
+	}
+	return loadExtract(ctx, cfg, selectors)
+}
+
+// ExtractWithin returns the elements of Extract inside bbox.
+func ExtractWithin(bbox overpassql.BBox) []Node {
+	extractMu.RLock()
+	defer extractMu.RUnlock()
+	var nodes []Node
+	for _, n := range Extract {
+		if bbox.Contains(n.Lat, n.Lon) {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,33 @@
+// osm/health.go
+package osm
+
+import (
+	"context"
+	"errors"
+	"mapserver/config"
+	"mapserver/utils"
+)
+
+// CheckOSMAPI reports whether the OSM API answers its capabilities request.
+func CheckOSMAPI(ctx context.Context, cfg *config.Config) error {
+	req, err := utils.CreateRequest("GET", cfg.OSMAPIBase+"/capabilities", "text/xml", nil)
+	if err != nil {
+		return err
+	}
+	_, err = utils.DoRequest(utils.HTTPClient, req.WithContext(ctx))
+	return err
+}
+
+// CheckOverpass reports whether at least one Overpass mirror answers its
+// status page.
+func CheckOverpass(ctx context.Context) error {
+	var errs []error
+	for _, mirror := range Overpass.Mirrors {
+		if _, err := Overpass.Status(ctx, mirror); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,91 @@
+// osm/layers.go
+package osm
+
+import (
+	"fmt"
+	"mapserver/config"
+	"osmkit/overpassql"
+	"strings"
+)
+
+// SelectLayers returns the layers with the given IDs, or all of them when ids
+// is empty.
+func SelectLayers(layers []config.Layer, ids []string) ([]config.Layer, error) {
+	if len(ids) == 0 {
+		return layers, nil
+	}
+	var selected []config.Layer
+	for _, id := range ids {
+		found := false
+		for _, l := range layers {
+			if l.ID == id {
+				selected = append(selected, l)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown layer %q", id)
+		}
+	}
+	return selected, nil
+}
+
+// LayersOf returns the layers an element belongs to. Layers may overlap, as a
+// restaurant with toilets=yes is both a restaurant and a toilet.
+func LayersOf(layers []config.Layer, elemType string, tags map[string]string) []*config.Layer {
+	var matched []*config.Layer
+	for i := range layers {
+		if layers[i].Parsed.Match(elemType, tags) {
+			matched = append(matched, &layers[i])
+		}
+	}
+	return matched
+}
+
+// editable reports whether one of the layers can be edited.
+func editable(layers []*config.Layer) bool {
+	for _, l := range layers {
+		if l.Editable {
+			return true
+		}
+	}
+	return false
+}
+
+// UnionQuery builds a single query returning the elements of every layer
+// inside bbox, so a map pan costs one Overpass round trip.
+func UnionQuery(layers []config.Layer, box overpassql.BBox) string {
+	var b strings.Builder
+	b.WriteString("[out:json];(")
+	seen := map[string]bool{}
+	for _, l := range layers {
+		for _, sel := range l.Parsed.Selectors() {
+			if sel.BBox != nil {
+				sel.BBox = &box
+			}
+			clause := sel.String()
+			if !seen[clause] {
+				seen[clause] = true
+				b.WriteString(clause + ";")
+			}
+		}
+	}
+	b.WriteString(");out body;")
+	return b.String()
+}
+
+// Classify sorts the elements of a union query into their layers, each into
+// every layer it matches. Every layer gets an entry, empty if nothing matched.
+func Classify(layers []config.Layer, elements []Node) map[string][]Node {
+	classified := make(map[string][]Node, len(layers))
+	for _, l := range layers {
+		classified[l.ID] = []Node{}
+	}
+	for _, e := range elements {
+		for _, l := range LayersOf(layers, e.Type, e.Tags) {
+			classified[l.ID] = append(classified[l.ID], e)
+		}
+	}
+	return classified
+}
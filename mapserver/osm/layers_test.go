@@ -0,0 +1,113 @@
+// osm/layers_test.go
+package osm
+
+import (
+	"mapserver/config"
+	"osmkit/overpassql"
+	"reflect"
+	"testing"
+)
+
+func testLayers(t *testing.T) []config.Layer {
+	t.Helper()
+	layers := []config.Layer{
+		{ID: "toilets", Query: `node["amenity"="toilets"](0,0,0,0);`, Editable: true},
+		{ID: "toiletsPois", Query: `node["toilets"="yes"](0,0,0,0);`, Editable: true},
+		{ID: "gasStations", Query: `node["amenity"="fuel"](0,0,0,0);`},
+		{ID: "restaurants", Query: `node["amenity"="restaurant"](0,0,0,0);`},
+		{ID: "tourismPois", Query: `node["tourism"](0,0,0,0);`},
+		{ID: "shopPois", Query: `(node["shop"](0,0,0,0);node["amenity"="fuel"](0,0,0,0););`},
+	}
+	for i := range layers {
+		q, err := overpassql.Parse(layers[i].Query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers[i].Parsed = q
+	}
+	return layers
+}
+
+func TestSelectLayers(t *testing.T) {
+	layers := testLayers(t)
+	if got, err := SelectLayers(layers, nil); err != nil || len(got) != len(layers) {
+		t.Errorf("got %d layers, %v, want all of them", len(got), err)
+	}
+	got, err := SelectLayers(layers, []string{"restaurants", "toilets"})
+	if err != nil || len(got) != 2 || got[0].ID != "restaurants" || got[1].ID != "toilets" {
+		t.Errorf("got %+v, %v, want restaurants and toilets", got, err)
+	}
+	if _, err := SelectLayers(layers, []string{"toilets", "pharmacies"}); err == nil {
+		t.Error("an unknown layer was accepted")
+	}
+}
+
+func TestUnionQuery(t *testing.T) {
+	layers := testLayers(t)
+	got := UnionQuery(layers, overpassql.BBox{South: 44.3, West: 25.9, North: 44.6, East: 26.3})
+	// The fuel clause of the shop layer is already in the union
+	want := `[out:json];(` +
+		`node["amenity"="toilets"](44.3,25.9,44.6,26.3);` +
+		`node["toilets"="yes"](44.3,25.9,44.6,26.3);` +
+		`node["amenity"="fuel"](44.3,25.9,44.6,26.3);` +
+		`node["amenity"="restaurant"](44.3,25.9,44.6,26.3);` +
+		`node["tourism"](44.3,25.9,44.6,26.3);` +
+		`node["shop"](44.3,25.9,44.6,26.3);` +
+		`);out body;`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	layers := testLayers(t)
+	toilets := Node{Type: "node", ID: 1, Tags: map[string]string{"amenity": "toilets"}}
+	restaurant := Node{Type: "node", ID: 2, Tags: map[string]string{"amenity": "restaurant"}}
+	withToilets := Node{Type: "node", ID: 3, Tags: map[string]string{"amenity": "restaurant", "toilets": "yes"}}
+	fuel := Node{Type: "node", ID: 4, Tags: map[string]string{"amenity": "fuel", "shop": "convenience"}}
+	bench := Node{Type: "node", ID: 5, Tags: map[string]string{"amenity": "bench"}}
+	way := Node{Type: "way", ID: 6, Tags: map[string]string{"amenity": "toilets"}}
+
+	got := Classify(layers, []Node{toilets, restaurant, withToilets, fuel, bench, way})
+	// An element matching several layers is in each of them
+	want := map[string][]Node{
+		"toilets":     {toilets},
+		"toiletsPois": {withToilets},
+		"gasStations": {fuel},
+		"restaurants": {restaurant, withToilets},
+		"tourismPois": {},
+		"shopPois":    {fuel},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLayersOf(t *testing.T) {
+	layers := testLayers(t)
+	tests := []struct {
+		name     string
+		tags     map[string]string
+		want     []string
+		editable bool
+	}{
+		{"one layer", map[string]string{"amenity": "restaurant"}, []string{"restaurants"}, false},
+		{"two layers", map[string]string{"amenity": "restaurant", "toilets": "yes"}, []string{"toiletsPois", "restaurants"}, true},
+		{"no layer", map[string]string{"amenity": "bench"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched := LayersOf(layers, "node", tt.tags)
+			var ids []string
+			for _, l := range matched {
+				ids = append(ids, l.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("layers = %v, want %v", ids, tt.want)
+			}
+			if got := editable(matched); got != tt.editable {
+				t.Errorf("editable = %v, want %v", got, tt.editable)
+			}
+		})
+	}
+}
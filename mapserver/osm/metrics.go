@@ -0,0 +1,57 @@
+// osm/metrics.go
+package osm
+
+import (
+	"mapserver/config"
+	"mapserver/utils"
+	"math"
+	"osmkit/tilecache"
+	"time"
+)
+
+// registerMetrics adds the metrics of the tile cache or the dataset, whichever
+// the theme uses, to utils.Metrics.
+func registerMetrics(cfg *config.Config) {
+	switch {
+	case NodeCache != nil:
+		registerCacheMetrics(NodeCache.Stats)
+	case WayCache != nil:
+		registerCacheMetrics(WayCache.Stats)
+	case cfg.Theme().Mode == config.ModeDataset:
+		utils.Metrics.GaugeFunc("mapserver_dataset_nodes", "Nodes of the dataset being served.", func() float64 {
+			return float64(Status().Nodes)
+		})
+		utils.Metrics.GaugeFunc("mapserver_dataset_age_seconds", "Time since the nodes being served were fetched, NaN before the first load.", func() float64 {
+			datasetMu.RLock()
+			defer datasetMu.RUnlock()
+			if updated.IsZero() {
+				return math.NaN()
+			}
+			return time.Since(updated).Seconds()
+		})
+		utils.Metrics.GaugeFunc("mapserver_dataset_refresh_ok", "Whether the last refresh of the dataset succeeded.", func() float64 {
+			if Status().OK {
+				return 1
+			}
+			return 0
+		})
+	}
+}
+
+func registerCacheMetrics(stats func() tilecache.Stats) {
+	utils.Metrics.CounterFunc("mapserver_tile_cache_hits_total", "Map tiles of /data served from the cache.", func() float64 {
+		return float64(stats().Hits)
+	})
+	utils.Metrics.CounterFunc("mapserver_tile_cache_misses_total", "Map tiles of /data fetched from Overpass.", func() float64 {
+		return float64(stats().Misses)
+	})
+	utils.Metrics.GaugeFunc("mapserver_tile_cache_hit_ratio", "Share of the map tiles of /data served from the cache.", func() float64 {
+		return stats().HitRatio()
+	})
+	utils.Metrics.CounterFunc("mapserver_tile_cache_evictions_total", "Map tiles dropped to keep the cache under its size.", func() float64 {
+		return float64(stats().Evictions)
+	})
+	utils.Metrics.GaugeFunc("mapserver_tile_cache_bytes", "Estimated size of the cached map tiles.", func() float64 {
+		return float64(stats().Bytes)
+	})
+}
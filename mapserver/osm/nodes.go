@@ -0,0 +1,189 @@
+// osm/nodes.go
+package osm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mapserver/config"
+	"mapserver/oauth"
+	"mapserver/utils"
+	"osmkit/apperr"
+	"osmkit/osmchange"
+	"osmkit/osmxml"
+	"osmkit/overpassql"
+	"osmkit/tags"
+
+	"golang.org/x/oauth2"
+)
+
+func nodeBounds(n Node) overpassql.BBox {
+	return overpassql.BBox{South: n.Lat, West: n.Lon, North: n.Lat, East: n.Lon}
+}
+
+// nodeSize estimates the memory a cached node takes.
+func nodeSize(n Node) int {
+	size := 96
+	for key, value := range n.Tags {
+		size += len(key) + len(value) + 32
+	}
+	return size
+}
+
+func FetchNodeDetails(cfg *config.Config, nodeID int64) (*Node, error) {
+	return fetchNode(fmt.Sprintf("%s/node/%d.json", cfg.OSMAPIBase, nodeID), nodeID)
+}
+
+// FetchNodeVersion returns an old version of a node from its history.
+func FetchNodeVersion(cfg *config.Config, nodeID int64, version int) (*Node, error) {
+	return fetchNode(fmt.Sprintf("%s/node/%d/%d.json", cfg.OSMAPIBase, nodeID, version), nodeID)
+}
+
+func fetchNode(url string, nodeID int64) (*Node, error) {
+	req, err := utils.CreateRequest("GET", url, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := utils.DoRequest(utils.HTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching node %d: %w", nodeID, err)
+	}
+
+	var data Data[Node]
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "error unmarshalling response")
+	}
+	if len(data.Elements) == 0 {
+		return nil, apperr.New(apperr.Gone, "no node found with ID %d", nodeID)
+	}
+
+	return &data.Elements[0], nil
+}
+
+// UpdateNodeDetails applies the patch to the latest version of the node and
+// uploads the result in the user's open changeset. When the node changed since
+// the version the user edited, the patch is merged with those changes; keys
+// changed on both sides make it return a *tags.ConflictError so the user can
+// decide.
+func UpdateNodeDetails(ctx context.Context, cfg *config.Config, token *oauth2.Token, userID, nodeID int64, patch tags.Patch) error {
+	if err := checkEditable(cfg, patch); err != nil {
+		return err
+	}
+	changesetID, err := oauth.CurrentChangeset(ctx, cfg, token, userID)
+	if err != nil {
+		return fmt.Errorf("failed to create changeset: %w", err)
+	}
+	client := oauth.Client(token)
+
+	baseVersion := patch.Version
+	var base *Node
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		node, err := FetchNodeDetails(cfg, nodeID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch node details: %w", err)
+		}
+		if baseVersion == 0 {
+			baseVersion = node.Version
+		}
+
+		if layers := cfg.Theme().Layers; len(layers) > 0 && !editable(LayersOf(layers, "node", node.Tags)) {
+			return apperr.New(apperr.Validation, "node %d is not part of an editable layer", nodeID)
+		}
+
+		updatedTags := patch.Apply(node.Tags)
+		if node.Version != baseVersion {
+			if base == nil {
+				base, err = FetchNodeVersion(cfg, nodeID, baseVersion)
+				if err != nil {
+					return fmt.Errorf("failed to fetch version %d of node %d: %w", baseVersion, nodeID, err)
+				}
+			}
+			var conflicts []tags.Conflict
+			updatedTags, conflicts = patch.Rebase(base.Tags, node.Tags)
+			if len(conflicts) > 0 {
+				utils.Conflicts.Inc("node", "refused")
+				return &tags.ConflictError{Type: "node", ID: nodeID, Version: node.Version, Tags: node.Tags, Conflicts: conflicts}
+			}
+			slog.InfoContext(ctx, "Node changed since it was edited, merged the changes", "node", nodeID, "from_version", baseVersion, "to_version", node.Version)
+			utils.Conflicts.Inc("node", "merged")
+		}
+		if tags.Equal(updatedTags, node.Tags) {
+			slog.InfoContext(ctx, "Node already has the requested tags, nothing to upload", "node", nodeID)
+			return nil
+		}
+
+		doc := &osmxml.OSM{Nodes: []osmxml.Node{{
+			ID:        nodeID,
+			Version:   node.Version,
+			Changeset: changesetID,
+			Lat:       node.Lat,
+			Lon:       node.Lon,
+			Tags:      osmxml.TagsFromMap(updatedTags),
+		}}}
+		xmlData, err := doc.Marshal()
+		if err != nil {
+			return apperr.Wrap(apperr.Validation, err, "failed to build node update")
+		}
+
+		req, err := utils.CreateRequest("PUT", fmt.Sprintf("%s/node/%d", cfg.OSMAPIBase, nodeID), "text/xml", xmlData)
+		if err != nil {
+			return err
+		}
+		_, err = utils.DoRequest(client, req)
+		switch {
+		case err == nil:
+			slog.InfoContext(ctx, "Node updated", "node", nodeID, "changeset", changesetID)
+			oauth.Changesets.Used(userID, changesetID, 1)
+			utils.Edits.Inc("node", "update")
+			if NodeCache != nil {
+				NodeCache.Forget(nodeID)
+			}
+			return nil
+		case oauth.IsVersionMismatchError(err):
+			// Someone saved the node between our read and our write: merge again
+			slog.WarnContext(ctx, "Node changed while uploading", "node", nodeID, "attempt", attempt, "error", err)
+			utils.Conflicts.Inc("node", "retried")
+		default:
+			if oauth.IsChangesetClosedError(err) {
+				oauth.Changesets.Forget(userID, changesetID)
+			}
+			return fmt.Errorf("failed to update node: %w", err)
+		}
+	}
+
+	return apperr.New(apperr.Conflict, "node %d kept changing, gave up after %d attempts", nodeID, maxUpdateAttempts)
+}
+
+// CreateNode uploads a new node through the user's open changeset and
+// returns the ID the API assigned to it.
+func CreateNode(ctx context.Context, cfg *config.Config, token *oauth2.Token, userID int64, lat, lon float64, tags map[string]string) (int64, error) {
+	changesetID, err := oauth.CurrentChangeset(ctx, cfg, token, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create changeset: %w", err)
+	}
+
+	builder := osmchange.NewBuilder(cfg.Theme().CreatedBy)
+	placeholder := builder.CreateNode(lat, lon, tags)
+
+	diff, err := osmchange.Upload(oauth.Client(token), cfg.OSMAPIBase, changesetID, builder)
+	if err != nil {
+		if oauth.IsChangesetClosedError(err) {
+			// The changeset was closed behind our back, open a new one next time
+			oauth.Changesets.Forget(userID, changesetID)
+		}
+		return 0, fmt.Errorf("failed to create node: %w", err)
+	}
+	oauth.Changesets.Used(userID, changesetID, builder.Len())
+	utils.Edits.Inc("node", "create")
+
+	created, ok := diff.Lookup("node", placeholder)
+	if !ok {
+		return 0, apperr.New(apperr.UpstreamUnavailable, "upload response did not contain the new node")
+	}
+	slog.InfoContext(ctx, "Node created", "node", created.NewID, "changeset", changesetID)
+	if NodeCache != nil {
+		NodeCache.Invalidate(nodeBounds(Node{Lat: lat, Lon: lon}))
+	}
+	return created.NewID, nil
+}
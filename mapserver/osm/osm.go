@@ -0,0 +1,107 @@
+// osm/osm.go
+package osm
+
+import (
+	"context"
+	"log/slog"
+	"mapserver/config"
+	"mapserver/utils"
+	"os"
+	"osmkit/apperr"
+	"osmkit/overpass"
+	"osmkit/tags"
+	"osmkit/tilecache"
+	"sort"
+)
+
+// Data is the shape of an Overpass JSON response.
+type Data[E any] struct {
+	Elements []E `json:"elements"`
+}
+
+type Node struct {
+	Type    string            `json:"type"`
+	ID      int64             `json:"id"`
+	Lat     float64           `json:"lat"`
+	Lon     float64           `json:"lon"`
+	Tags    map[string]string `json:"tags"`
+	Version int               `json:"version,omitempty"`
+}
+
+type Way struct {
+	Type     string            `json:"type"`
+	ID       int64             `json:"id"`
+	Geometry []Geometry        `json:"geometry"`
+	Tags     map[string]string `json:"tags"`
+	Version  int               `json:"version"`
+}
+
+type Geometry struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Overpass is the client shared by every Overpass query of the app.
+var Overpass *overpass.Client
+
+// In bbox mode, NodeCache or WayCache holds the elements of /data by map
+// tile, depending on the elements of the theme.
+var (
+	NodeCache *tilecache.Cache[Node]
+	WayCache  *tilecache.Cache[Way]
+)
+
+func Init(cfg *config.Config) {
+	Overpass = overpass.New(cfg.OverpassURLs...)
+	Overpass.Timeout = cfg.OverpassTimeout
+	Overpass.UserAgent = cfg.Theme().CreatedBy
+	Overpass.HTTPClient = utils.OverpassHTTPClient
+	defer registerMetrics(cfg)
+
+	if cfg.Theme().Mode != config.ModeBBox {
+		return
+	}
+	if cfg.Theme().Elements == "way" {
+		WayCache = tilecache.New(wayBounds, func(w Way) int64 { return w.ID }, waySize)
+		WayCache.TTL = cfg.TileCacheTTL
+		WayCache.MaxBytes = int64(cfg.TileCacheMaxMB) << 20
+		return
+	}
+
+	NodeCache = tilecache.New(nodeBounds, func(n Node) int64 { return n.ID }, nodeSize)
+	NodeCache.TTL = cfg.TileCacheTTL
+	NodeCache.MaxBytes = int64(cfg.TileCacheMaxMB) << 20
+	if cfg.ExtractFile != "" {
+		var err error
+		if Extract, err = LoadLayerExtract(context.Background(), cfg); err != nil {
+			slog.Error("Error loading the extract", "error", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// maxUpdateAttempts bounds how often an update is merged again when the
+// element keeps changing between our read and our write.
+const maxUpdateAttempts = 3
+
+// checkEditable refuses patches touching keys the theme does not allow to
+// edit.
+func checkEditable(cfg *config.Config, patch tags.Patch) error {
+	theme := cfg.Theme()
+	var refused []string
+	for key := range patch.Set {
+		if !theme.Editable(key) {
+			refused = append(refused, key)
+		}
+	}
+	for _, key := range patch.Delete {
+		if !theme.Editable(key) {
+			refused = append(refused, key)
+		}
+	}
+	if len(refused) > 0 {
+		sort.Strings(refused)
+		return apperr.New(apperr.Validation, "these tags can't be edited on this map: %v", refused)
+	}
+	return nil
+}
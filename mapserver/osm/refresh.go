@@ -0,0 +1,163 @@
+// osm/refresh.go
+package osm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mapserver/config"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FetchNodes returns the nodes of the dataset query from Overpass and the
+// mirror that served them.
+func FetchNodes(ctx context.Context, cfg *config.Config) ([]Node, string, error) {
+	var tempNodes Data[Node]
+	result, err := Overpass.Query(ctx, cfg.Theme().Query, &tempNodes)
+	if err != nil {
+		return nil, "", err
+	}
+	slog.Info("Fetched nodes", "nodes", len(tempNodes.Elements), "mirror", result.Mirror, "duration", result.Duration.String())
+
+	// Filter out duplicate nodes
+	nodeMap := make(map[int64]Node)
+	for _, node := range tempNodes.Elements {
+		if _, exists := nodeMap[node.ID]; !exists {
+			nodeMap[node.ID] = node
+		}
+	}
+
+	// Convert map back to slice
+	nodes := make([]Node, 0, len(nodeMap))
+	for _, node := range nodeMap {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes, result.Mirror, nil
+}
+
+// RefreshStatus describes the dataset being served and the last attempt to
+// refresh it.
+type RefreshStatus struct {
+	Nodes       int       `json:"nodes"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	OK          bool      `json:"ok"`
+	Error       string    `json:"error,omitempty"`
+	Source      string    `json:"source,omitempty"`
+
+	// The last replication diff applied, when DIFF_SOURCE is set
+	Sequence     int64      `json:"sequence,omitempty"`
+	ReplicatedTo *time.Time `json:"replicatedTo,omitempty"`
+}
+
+var (
+	datasetMu sync.RWMutex
+	dataset   []Node // replaced as a whole, never modified in place
+	status    RefreshStatus
+	updated   time.Time // when the nodes of dataset were fetched
+)
+
+// CurrentNodes returns the dataset being served. Callers must not modify it.
+func CurrentNodes() []Node {
+	datasetMu.RLock()
+	defer datasetMu.RUnlock()
+	return dataset
+}
+
+// Status returns the state of the dataset and its last refresh.
+func Status() RefreshStatus {
+	datasetMu.RLock()
+	defer datasetMu.RUnlock()
+	st := status
+	st.Sequence = replicated.Sequence
+	if !replicated.Timestamp.IsZero() {
+		st.ReplicatedTo = &replicated.Timestamp
+	}
+	return st
+}
+
+// swap replaces the dataset if nodes passes validate and records the attempt.
+func swap(cfg *config.Config, nodes []Node, source string, fetchErr error) error {
+	datasetMu.Lock()
+	defer datasetMu.Unlock()
+
+	status.LastAttempt = time.Now()
+	err := fetchErr
+	if err == nil {
+		err = validate(cfg, len(dataset), len(nodes))
+	}
+	if err != nil {
+		status.OK = false
+		status.Error = err.Error()
+		return err
+	}
+
+	dataset = nodes
+	updated = status.LastAttempt
+	status = RefreshStatus{
+		Nodes:       len(nodes),
+		LastAttempt: status.LastAttempt,
+		LastSuccess: status.LastAttempt,
+		OK:          true,
+		Source:      source,
+	}
+	return nil
+}
+
+// validate refuses results that look like an Overpass hiccup rather than real
+// edits: an empty set, or one that lost more than cfg.RefreshMaxDrop percent
+// of the nodes we serve.
+func validate(cfg *config.Config, current, fetched int) error {
+	if fetched == 0 {
+		return fmt.Errorf("refusing to replace %d nodes with an empty result", current)
+	}
+	if minimum := current * (100 - cfg.RefreshMaxDrop) / 100; fetched < minimum {
+		return fmt.Errorf("refusing to replace %d nodes with %d, more than %d%% fewer", current, fetched, cfg.RefreshMaxDrop)
+	}
+	return nil
+}
+
+// Refresh fetches the nodes from Overpass, or reads them from the extract if
+// one is configured, and swaps them in if they pass validation, saving them as
+// a snapshot.
+func Refresh(ctx context.Context, cfg *config.Config) error {
+	fetch := FetchNodes
+	if cfg.ExtractFile != "" {
+		fetch = LoadExtract
+	}
+	nodes, source, err := fetch(ctx, cfg)
+	if err := swap(cfg, nodes, source, err); err != nil {
+		return err
+	}
+	slog.Info("Serving nodes", "nodes", len(nodes), "source", source)
+	if err := SaveSnapshot(cfg, nodes); err != nil {
+		slog.Error("Failed to save snapshot", "error", err)
+	}
+	return nil
+}
+
+// RunRefresher refreshes the dataset right away and then every
+// cfg.RefreshInterval until ctx is done. Failed refreshes keep the current
+// dataset and are retried sooner, backing off up to the interval.
+func RunRefresher(ctx context.Context, cfg *config.Config) {
+	retry := time.Minute
+	for {
+		wait := cfg.RefreshInterval
+		if err := Refresh(ctx, cfg); err != nil {
+			slog.Error("Refreshing the nodes failed", "retry_in", retry.String(), "error", err)
+			wait = retry
+			retry = min(retry*2, cfg.RefreshInterval)
+		} else {
+			retry = time.Minute
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// osm/refresh_test.go
+package osm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mapserver/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// upstream is an Overpass interpreter answering with the nodes it is given.
+type upstream struct {
+	nodes  []Node
+	status int
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if u.status != 0 {
+		http.Error(w, "overloaded", u.status)
+		return
+	}
+	json.NewEncoder(w).Encode(Data[Node]{Elements: u.nodes})
+}
+
+func drinkingWater(n int) []Node {
+	nodes := make([]Node, n)
+	for i := range nodes {
+		nodes[i] = Node{Type: "node", ID: int64(i + 1), Lat: 44.43, Lon: 26.1, Tags: map[string]string{"amenity": "drinking_water"}}
+	}
+	return nodes
+}
+
+// waterQuery selects the dataset of the tests.
+const waterQuery = "[out:json];node[amenity=drinking_water];out;"
+
+// testConfig loads the configuration of a theme, with the settings the
+// server requires set to placeholders.
+func testConfig(t *testing.T, themeFile string) *config.Config {
+	t.Helper()
+	t.Setenv("CONFIG", "")
+	t.Setenv("CLIENT_ID", "test")
+	t.Setenv("CLIENT_SECRET", "test")
+	t.Setenv("REDIRECT_URI", "http://localhost/callback")
+	t.Setenv("AUTH_URL", "http://localhost/oauth2/authorize")
+	t.Setenv("TOKEN_URL", "http://localhost/oauth2/token")
+	cfg, err := config.Load("", themeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// datasetTheme writes a dataset theme serving the nodes of query.
+func datasetTheme(t *testing.T, query string) string {
+	t.Helper()
+	static, err := filepath.Abs("../static/water")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "theme.yaml")
+	text := fmt.Sprintf("name: test\nmode: dataset\nelements: node\nstatic: %s\nquery: '%s'\n", static, query)
+	if err := os.WriteFile(name, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// newTestUpstream points the Overpass client at u and empties the dataset.
+func newTestUpstream(t *testing.T, u *upstream) *config.Config {
+	t.Helper()
+	server := httptest.NewServer(u)
+	t.Cleanup(server.Close)
+	t.Setenv("OVERPASS_URL", server.URL+"/api/interpreter")
+	cfg := testConfig(t, datasetTheme(t, waterQuery))
+	cfg.OverpassTimeout = 5 * time.Second
+	cfg.RefreshInterval = time.Hour
+	cfg.SnapshotDir = t.TempDir()
+	cfg.SnapshotKeep = 2
+	Init(cfg)
+	Overpass.Attempts = 1
+	Overpass.Backoff = time.Millisecond
+
+	datasetMu.Lock()
+	dataset, status = nil, RefreshStatus{}
+	datasetMu.Unlock()
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	cfg := &config.Config{RefreshMaxDrop: 20}
+	tests := []struct {
+		name             string
+		current, fetched int
+		wantErr          bool
+	}{
+		{"first load", 0, 10, false},
+		{"grew", 100, 120, false},
+		{"lost a few", 100, 81, false},
+		{"lost exactly the limit", 100, 80, false},
+		{"lost too many", 100, 79, true},
+		{"empty", 100, 0, true},
+		{"empty first load", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(cfg, tt.current, tt.fetched)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate(%d, %d) = %v, want error %v", tt.current, tt.fetched, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	u := &upstream{nodes: append(drinkingWater(10), drinkingWater(1)...)} // node 1 twice
+	cfg := newTestUpstream(t, u)
+	ctx := context.Background()
+
+	if err := Refresh(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	first := Status()
+	if n := len(CurrentNodes()); n != 10 || !first.OK || first.Nodes != 10 || first.Source != cfg.OverpassURLs[0] {
+		t.Fatalf("serving %d nodes with status %+v, want the 10 distinct nodes", n, first)
+	}
+
+	tests := []struct {
+		name     string
+		nodes    []Node
+		status   int
+		swapped  bool
+		wantKept int
+	}{
+		{"too many lost", drinkingWater(5), 0, false, 10},
+		{"empty", nil, 0, false, 10},
+		{"Overpass down", drinkingWater(10), http.StatusServiceUnavailable, false, 10},
+		{"a few lost", drinkingWater(9), 0, true, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u.nodes, u.status = tt.nodes, tt.status
+			before := Status()
+			err := Refresh(ctx, cfg)
+			if (err == nil) != tt.swapped {
+				t.Fatalf("got error %v, want swapped %v", err, tt.swapped)
+			}
+			if n := len(CurrentNodes()); n != tt.wantKept {
+				t.Errorf("serving %d nodes, want %d", n, tt.wantKept)
+			}
+			st := Status()
+			if st.OK != tt.swapped || st.Nodes != tt.wantKept || st.LastAttempt.Before(before.LastAttempt) {
+				t.Errorf("status %+v after %+v", st, before)
+			}
+			if tt.swapped {
+				if st.Error != "" || !st.LastSuccess.Equal(st.LastAttempt) {
+					t.Errorf("status %+v, want a success", st)
+				}
+			} else if st.Error == "" || !st.LastSuccess.Equal(before.LastSuccess) {
+				t.Errorf("status %+v, want the error and the last success kept", st)
+			}
+		})
+	}
+}
+
+func TestRunRefresherStops(t *testing.T) {
+	cfg := newTestUpstream(t, &upstream{nodes: drinkingWater(3)})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunRefresher(ctx, cfg)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(CurrentNodes()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the first refresh did not happen")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunRefresher kept running after its context was cancelled")
+	}
+}
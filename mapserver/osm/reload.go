@@ -0,0 +1,58 @@
+// osm/reload.go
+package osm
+
+import (
+	"context"
+	"log/slog"
+	"mapserver/config"
+	"reflect"
+)
+
+// Reload applies a theme read again from disk: what was fetched with the old
+// queries or layers is dropped and fetched again with the new ones. Only the
+// dataset refresh and the extract take a while; they run before Reload
+// returns, so call it from its own goroutine.
+func Reload(ctx context.Context, cfg *config.Config, old *config.Theme) {
+	theme := cfg.Theme()
+	switch {
+	case theme.Mode == config.ModeDataset:
+		if theme.Query == old.Query {
+			return
+		}
+		slog.Info("The query changed, refreshing the dataset")
+		if err := Refresh(ctx, cfg); err != nil {
+			slog.Error("Refreshing the dataset with the new query failed", "error", err)
+		}
+	case theme.Elements == "way":
+		if theme.Query != old.Query {
+			slog.Info("The query changed, emptying the tile cache")
+			WayCache.Clear()
+		}
+	default:
+		if reflect.DeepEqual(layerQueries(theme.Layers), layerQueries(old.Layers)) {
+			return
+		}
+		slog.Info("The layers changed, emptying the tile cache")
+		NodeCache.Clear()
+		if cfg.ExtractFile == "" {
+			return
+		}
+		nodes, err := LoadLayerExtract(ctx, cfg)
+		if err != nil {
+			slog.Error("Reloading the extract for the new layers failed, serving the old one", "error", err)
+			return
+		}
+		extractMu.Lock()
+		Extract = nodes
+		extractMu.Unlock()
+	}
+}
+
+// layerQueries returns what decides the elements of each layer.
+func layerQueries(layers []config.Layer) []string {
+	queries := make([]string, len(layers))
+	for i, l := range layers {
+		queries[i] = l.ID + "\n" + l.Query
+	}
+	return queries
+}
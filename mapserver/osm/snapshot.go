@@ -0,0 +1,133 @@
+// osm/snapshot.go
+package osm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mapserver/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshots are named after the time they were taken, so sorting the names
+// sorts them by age. The content has the shape of data.json: a JSON array of
+// nodes, sorted by ID so two snapshots diff cleanly.
+const (
+	snapshotPrefix = "data-"
+	snapshotSuffix = ".json"
+	snapshotLayout = "20060102T150405Z"
+)
+
+// snapshotFiles returns the snapshot files of the directory, oldest first.
+func snapshotFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// LoadSnapshot reads the newest snapshot of cfg.SnapshotDir, returning its
+// nodes and path. It returns an os.ErrNotExist error when there is none.
+func LoadSnapshot(cfg *config.Config) ([]Node, string, error) {
+	files, err := snapshotFiles(cfg.SnapshotDir)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(files) == 0 {
+		return nil, "", fmt.Errorf("no snapshot in %s: %w", cfg.SnapshotDir, os.ErrNotExist)
+	}
+	path := files[len(files)-1]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var nodes []Node
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return nodes, path, nil
+}
+
+// WarmStart serves the newest snapshot until the first refresh succeeds.
+func WarmStart(cfg *config.Config) {
+	nodes, path, err := LoadSnapshot(cfg)
+	if err != nil {
+		slog.Info("Starting without a snapshot", "error", err)
+		return
+	}
+	if err := swap(cfg, nodes, "snapshot "+filepath.Base(path), nil); err != nil {
+		slog.Warn("Ignoring snapshot", "path", path, "error", err)
+		return
+	}
+	if info, err := os.Stat(path); err == nil {
+		datasetMu.Lock()
+		updated = info.ModTime()
+		datasetMu.Unlock()
+	}
+	slog.Info("Serving nodes from snapshot", "nodes", len(nodes), "path", path)
+}
+
+// SaveSnapshot writes the nodes to a new snapshot unless they equal the newest
+// one, then removes the oldest snapshots beyond cfg.SnapshotKeep.
+func SaveSnapshot(cfg *config.Config, nodes []Node) error {
+	data, err := json.MarshalIndent(nodes, "", " ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.SnapshotDir, 0o755); err != nil {
+		return err
+	}
+	files, err := snapshotFiles(cfg.SnapshotDir)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		if latest, err := os.ReadFile(files[len(files)-1]); err == nil && bytes.Equal(latest, data) {
+			return nil
+		}
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated snapshot
+	path := filepath.Join(cfg.SnapshotDir, snapshotPrefix+time.Now().UTC().Format(snapshotLayout)+snapshotSuffix)
+	tmp, err := os.CreateTemp(cfg.SnapshotDir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	slog.Info("Saved snapshot", "path", path)
+
+	files = append(files, path)
+	for len(files) > cfg.SnapshotKeep {
+		if err := os.Remove(files[0]); err != nil {
+			slog.Error("Failed to remove old snapshot", "path", files[0], "error", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
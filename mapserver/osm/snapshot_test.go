@@ -0,0 +1,130 @@
+// osm/snapshot_test.go
+package osm
+
+import (
+	"context"
+	"errors"
+	"mapserver/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func snapshotNames(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := snapshotFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f))
+	}
+	return names
+}
+
+func TestSaveSnapshot(t *testing.T) {
+	cfg := &config.Config{SnapshotDir: filepath.Join(t.TempDir(), "snapshots"), SnapshotKeep: 3}
+	nodes := drinkingWater(3)
+	if err := SaveSnapshot(cfg, nodes); err != nil {
+		t.Fatal(err)
+	}
+	if names := snapshotNames(t, cfg.SnapshotDir); len(names) != 1 {
+		t.Fatalf("got snapshots %v, want one", names)
+	}
+	loaded, _, err := LoadSnapshot(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, nodes) {
+		t.Errorf("loaded %v, want %v", loaded, nodes)
+	}
+
+	// The same nodes again are not written a second time
+	if err := SaveSnapshot(cfg, nodes); err != nil {
+		t.Fatal(err)
+	}
+	if names := snapshotNames(t, cfg.SnapshotDir); len(names) != 1 {
+		t.Errorf("got snapshots %v after saving the same nodes, want one", names)
+	}
+}
+
+func TestSnapshotRotation(t *testing.T) {
+	cfg := &config.Config{SnapshotDir: t.TempDir(), SnapshotKeep: 2}
+	for _, name := range []string{"data-20240101T000000Z.json", "data-20240102T000000Z.json", "notes.json", ".snapshot-123"} {
+		if err := os.WriteFile(filepath.Join(cfg.SnapshotDir, name), []byte("[]"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := SaveSnapshot(cfg, drinkingWater(2)); err != nil {
+		t.Fatal(err)
+	}
+	names := snapshotNames(t, cfg.SnapshotDir)
+	if len(names) != 2 || names[0] != "data-20240102T000000Z.json" {
+		t.Errorf("got snapshots %v, want the newer old one and the new one", names)
+	}
+	for _, other := range []string{"notes.json", ".snapshot-123"} {
+		if _, err := os.Stat(filepath.Join(cfg.SnapshotDir, other)); err != nil {
+			t.Errorf("rotation touched %s: %v", other, err)
+		}
+	}
+	if loaded, path, err := LoadSnapshot(cfg); err != nil || len(loaded) != 2 || filepath.Base(path) != names[1] {
+		t.Errorf("loaded %d nodes from %s, error %v, want the new snapshot", len(loaded), path, err)
+	}
+}
+
+func TestLoadSnapshotMissing(t *testing.T) {
+	for _, dir := range []string{t.TempDir(), filepath.Join(t.TempDir(), "missing")} {
+		if _, _, err := LoadSnapshot(&config.Config{SnapshotDir: dir}); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("got error %v for %s, want os.ErrNotExist", err, dir)
+		}
+	}
+
+	cfg := &config.Config{SnapshotDir: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(cfg.SnapshotDir, "data-20240101T000000Z.json"), []byte("[{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadSnapshot(cfg); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got error %v for a truncated snapshot, want a parse error", err)
+	}
+}
+
+func TestWarmStart(t *testing.T) {
+	u := &upstream{status: 503}
+	cfg := newTestUpstream(t, u)
+	ctx := context.Background()
+	if err := SaveSnapshot(cfg, drinkingWater(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	WarmStart(cfg)
+	st := Status()
+	if n := len(CurrentNodes()); n != 10 || !st.OK || !strings.HasPrefix(st.Source, "snapshot data-") {
+		t.Fatalf("serving %d nodes with status %+v, want the snapshot", n, st)
+	}
+
+	// The snapshot is served while Overpass is down, and guards against a
+	// refresh that lost most of it
+	if err := Refresh(ctx, cfg); err == nil || len(CurrentNodes()) != 10 {
+		t.Errorf("got error %v and %d nodes with Overpass down, want the snapshot kept", err, len(CurrentNodes()))
+	}
+	u.nodes, u.status = drinkingWater(2), 0
+	if err := Refresh(ctx, cfg); err == nil || len(CurrentNodes()) != 10 {
+		t.Errorf("got error %v and %d nodes after losing most nodes, want the snapshot kept", err, len(CurrentNodes()))
+	}
+	u.nodes = drinkingWater(11)
+	if err := Refresh(ctx, cfg); err != nil || len(CurrentNodes()) != 11 {
+		t.Errorf("got error %v and %d nodes, want the refreshed nodes", err, len(CurrentNodes()))
+	}
+}
+
+func TestWarmStartWithoutSnapshot(t *testing.T) {
+	cfg := newTestUpstream(t, &upstream{})
+	WarmStart(cfg)
+	if n := len(CurrentNodes()); n != 0 || Status().OK {
+		t.Errorf("serving %d nodes with status %+v, want nothing yet", n, Status())
+	}
+}
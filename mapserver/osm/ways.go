@@ -0,0 +1,421 @@
+// osm/ways.go
+package osm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"mapserver/config"
+	"mapserver/oauth"
+	"mapserver/utils"
+	"net/http"
+	"osmkit/apperr"
+	"osmkit/osmchange"
+	"osmkit/osmxml"
+	"osmkit/overpassql"
+	"osmkit/tags"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	pendingChanges = make(map[int64]map[int64]tags.Patch) // OSM user ID -> way ID -> patch
+	saving         = make(map[int64]*sync.Mutex)          // OSM user ID -> held while saving
+	mu             sync.Mutex
+)
+
+// saveLock returns the lock a save of the user holds, so a second save waits
+// for the first instead of uploading the same patches again.
+func saveLock(userID int64) *sync.Mutex {
+	mu.Lock()
+	defer mu.Unlock()
+	lock, ok := saving[userID]
+	if !ok {
+		lock = &sync.Mutex{}
+		saving[userID] = lock
+	}
+	return lock
+}
+
+func wayBounds(w Way) overpassql.BBox {
+	if len(w.Geometry) == 0 {
+		return overpassql.BBox{}
+	}
+	b := overpassql.BBox{South: w.Geometry[0].Lat, West: w.Geometry[0].Lon, North: w.Geometry[0].Lat, East: w.Geometry[0].Lon}
+	for _, g := range w.Geometry[1:] {
+		b.South, b.North = min(b.South, g.Lat), max(b.North, g.Lat)
+		b.West, b.East = min(b.West, g.Lon), max(b.East, g.Lon)
+	}
+	return b
+}
+
+// waySize estimates the memory a cached way takes.
+func waySize(w Way) int {
+	size := 96 + 16*len(w.Geometry)
+	for key, value := range w.Tags {
+		size += len(key) + len(value) + 32
+	}
+	return size
+}
+
+// FetchWays returns the ways of the theme query inside bbox and the mirror
+// that served them, empty when they all came from WayCache.
+func FetchWays(ctx context.Context, cfg *config.Config, bbox string) ([]Way, string, error) {
+	box, err := overpassql.ParseBBox(bbox)
+	if err != nil {
+		return nil, "", apperr.Wrap(apperr.Validation, err, "Invalid bounding box")
+	}
+
+	mirror := ""
+	ways, _, err := WayCache.Get(ctx, box, func(ctx context.Context, box overpassql.BBox) ([]Way, error) {
+		query := strings.ReplaceAll(cfg.Theme().Query, "{{bbox}}", box.String())
+
+		var data Data[Way]
+		result, err := Overpass.Query(ctx, query, &data)
+		if err != nil {
+			return nil, err
+		}
+		mirror = result.Mirror
+
+		slog.InfoContext(ctx, "Fetched ways", "ways", len(data.Elements), "mirror", result.Mirror)
+		return data.Elements, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if ways == nil {
+		ways = []Way{}
+	}
+	return ways, mirror, nil
+}
+
+// AddPendingChange queues a tag patch of the user for the next SaveChanges. A
+// second patch of the same way is combined with the first, and merged against
+// the newer of their versions, so editing a way again resolves a conflict.
+func AddPendingChange(cfg *config.Config, userID, wayID int64, patch tags.Patch) error {
+	if err := checkEditable(cfg, patch); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	changes, ok := pendingChanges[userID]
+	if !ok {
+		changes = make(map[int64]tags.Patch)
+		pendingChanges[userID] = changes
+	}
+	if queued, ok := changes[wayID]; ok {
+		patch = queued.Then(patch)
+	}
+	changes[wayID] = patch
+	return nil
+}
+
+// GetPendingChanges returns a copy of the user's queued patches by way ID.
+func GetPendingChanges(userID int64) map[int64]tags.Patch {
+	mu.Lock()
+	defer mu.Unlock()
+	changes := make(map[int64]tags.Patch)
+	for k, v := range pendingChanges[userID] {
+		changes[k] = v
+	}
+	return changes
+}
+
+// RemovePendingChange drops the queued patch of the way, if any, and reports
+// whether there was one.
+func RemovePendingChange(userID, wayID int64) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := pendingChanges[userID][wayID]
+	delete(pendingChanges[userID], wayID)
+	if len(pendingChanges[userID]) == 0 {
+		delete(pendingChanges, userID)
+	}
+	return ok
+}
+
+// fetchWay reads the current version of a way from the API.
+func fetchWay(cfg *config.Config, wayID int64, token *oauth2.Token) (*osmxml.Way, error) {
+	return readWay(fmt.Sprintf("%s/way/%d", cfg.OSMAPIBase, wayID), wayID, token)
+}
+
+// fetchWayVersion reads an old version of a way from its history.
+func fetchWayVersion(cfg *config.Config, wayID int64, version int, token *oauth2.Token) (*osmxml.Way, error) {
+	return readWay(fmt.Sprintf("%s/way/%d/%d", cfg.OSMAPIBase, wayID, version), wayID, token)
+}
+
+func readWay(url string, wayID int64, token *oauth2.Token) (*osmxml.Way, error) {
+	req, err := utils.CreateRequest("GET", url, "text/xml", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := oauth.Client(token).Do(req)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, apperr.FromStatus(resp.StatusCode, string(body), "failed to get way %d", wayID)
+	}
+
+	osmData, err := osmxml.Decode(resp.Body)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "failed to parse response")
+	}
+	if len(osmData.Ways) == 0 {
+		return nil, apperr.New(apperr.UpstreamUnavailable, "way %d not found in response", wayID)
+	}
+
+	return &osmData.Ways[0], nil
+}
+
+// patchedWay reads the latest version of the way and returns it with the
+// patch applied, or nil when it already has the requested tags. When the way
+// changed since the version the user edited, the patch is merged with those
+// changes; keys changed on both sides make it return a *tags.ConflictError.
+func patchedWay(ctx context.Context, cfg *config.Config, token *oauth2.Token, wayID int64, patch tags.Patch) (*osmxml.Way, error) {
+	way, err := fetchWay(cfg, wayID, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get way: %w", err)
+	}
+
+	current := way.Tags.Map()
+	updatedTags := patch.Apply(current)
+	if patch.Version != 0 && way.Version != patch.Version {
+		base, err := fetchWayVersion(cfg, wayID, patch.Version, token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get version %d of way %d: %w", patch.Version, wayID, err)
+		}
+		var conflicts []tags.Conflict
+		updatedTags, conflicts = patch.Rebase(base.Tags.Map(), current)
+		if len(conflicts) > 0 {
+			utils.Conflicts.Inc("way", "refused")
+			return nil, &tags.ConflictError{Type: "way", ID: wayID, Version: way.Version, Tags: current, Conflicts: conflicts}
+		}
+		slog.InfoContext(ctx, "Way changed since it was edited, merged the changes", "way", wayID, "from_version", patch.Version, "to_version", way.Version)
+		utils.Conflicts.Inc("way", "merged")
+	}
+	if tags.Equal(updatedTags, current) {
+		slog.InfoContext(ctx, "Way already has the requested tags, nothing to upload", "way", wayID)
+		return nil, nil
+	}
+
+	way.Tags = osmxml.TagsFromMap(updatedTags)
+	return way, nil
+}
+
+// UpdateWayTags applies the patch to the latest version of the way and
+// uploads the result in the user's open changeset, merging again when someone
+// saves the way between our read and our write.
+func UpdateWayTags(ctx context.Context, cfg *config.Config, token *oauth2.Token, userID, wayID int64, patch tags.Patch) error {
+	if err := checkEditable(cfg, patch); err != nil {
+		return err
+	}
+	changesetID, err := oauth.CurrentChangeset(ctx, cfg, token, userID)
+	if err != nil {
+		return fmt.Errorf("failed to create changeset: %w", err)
+	}
+	client := oauth.Client(token)
+
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		way, err := patchedWay(ctx, cfg, token, wayID, patch)
+		if err != nil || way == nil {
+			return err
+		}
+		if patch.Version == 0 {
+			// Later attempts merge against the version we just read
+			patch.Version = way.Version
+		}
+		if len(way.Nds) == 0 {
+			return apperr.New(apperr.Validation, "way %d has no nodes, refusing to upload it", way.ID)
+		}
+
+		// The version and node list go back unchanged, as a way without <nd>
+		// children would lose its geometry
+		way.Changeset = changesetID
+		xmlData, err := (&osmxml.OSM{Ways: []osmxml.Way{*way}}).Marshal()
+		if err != nil {
+			return apperr.Wrap(apperr.Validation, err, "failed to build way update")
+		}
+		req, err := utils.CreateRequest("PUT", fmt.Sprintf("%s/way/%d", cfg.OSMAPIBase, wayID), "text/xml", xmlData)
+		if err != nil {
+			return err
+		}
+
+		_, err = utils.DoRequest(client, req)
+		if err == nil {
+			oauth.Changesets.Used(userID, changesetID, 1)
+			utils.Edits.Inc("way", "update")
+			slog.InfoContext(ctx, "Way updated", "way", wayID, "changeset", changesetID)
+			WayCache.Forget(wayID)
+			return nil
+		}
+		if !oauth.IsVersionMismatchError(err) {
+			if oauth.IsChangesetClosedError(err) {
+				oauth.Changesets.Forget(userID, changesetID)
+			}
+			return fmt.Errorf("failed to update way: %w", err)
+		}
+		slog.WarnContext(ctx, "Way changed while uploading", "way", wayID, "attempt", attempt, "error", err)
+		utils.Conflicts.Inc("way", "retried")
+	}
+
+	return apperr.New(apperr.Conflict, "way %d kept changing, gave up after %d attempts", wayID, maxUpdateAttempts)
+}
+
+// CreateWay uploads a new way over existing nodes through the user's open
+// changeset and returns the ID the API assigned to it.
+func CreateWay(ctx context.Context, cfg *config.Config, token *oauth2.Token, userID int64, nodes []int64, tags map[string]string) (int64, error) {
+	changesetID, err := oauth.CurrentChangeset(ctx, cfg, token, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create changeset: %w", err)
+	}
+
+	builder := osmchange.NewBuilder(cfg.Theme().CreatedBy)
+	placeholder := builder.CreateWay(nodes, tags)
+
+	diff, err := osmchange.Upload(oauth.Client(token), cfg.OSMAPIBase, changesetID, builder)
+	if err != nil {
+		if oauth.IsChangesetClosedError(err) {
+			oauth.Changesets.Forget(userID, changesetID)
+		}
+		return 0, fmt.Errorf("failed to create way: %w", err)
+	}
+	oauth.Changesets.Used(userID, changesetID, builder.Len())
+	utils.Edits.Inc("way", "create")
+
+	created, ok := diff.Lookup("way", placeholder)
+	if !ok {
+		return 0, apperr.New(apperr.UpstreamUnavailable, "upload response did not contain the new way")
+	}
+	slog.InfoContext(ctx, "Way created", "way", created.NewID, "changeset", changesetID)
+
+	// Show the new way on the next /data of its area
+	geometry, err := fetchGeometry(cfg, nodes)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read the nodes of the new way, clearing the way cache", "way", created.NewID, "error", err)
+		WayCache.Clear()
+	} else {
+		WayCache.Invalidate(wayBounds(Way{Geometry: geometry}))
+	}
+	return created.NewID, nil
+}
+
+// fetchGeometry reads the positions of the nodes from the API.
+func fetchGeometry(cfg *config.Config, nodeIDs []int64) ([]Geometry, error) {
+	ids := make([]string, len(nodeIDs))
+	for i, id := range nodeIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	req, err := utils.CreateRequest("GET", fmt.Sprintf("%s/nodes?nodes=%s", cfg.OSMAPIBase, strings.Join(ids, ",")), "text/xml", nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := utils.DoRequest(utils.HTTPClient, req)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := osmxml.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "failed to parse nodes")
+	}
+
+	geometry := make([]Geometry, 0, len(doc.Nodes))
+	for _, n := range doc.Nodes {
+		geometry = append(geometry, Geometry{Lat: n.Lat, Lon: n.Lon})
+	}
+	return geometry, nil
+}
+
+// SaveChanges uploads all pending tag patches of the user as osmChange diffs.
+// Batches larger than cfg.MaxChangesetElements are split over several
+// changesets, each carrying the same comment and hashtags; the result reports
+// the changeset and status of every chunk. A conflict on any way aborts the
+// save with a *tags.ConflictError before anything is uploaded; the user then
+// queues the way again from its latest version, or drops it, and retries.
+// Saves of one user run one after the other.
+func SaveChanges(ctx context.Context, cfg *config.Config, token *oauth2.Token, userID int64) ([]osmchange.ChunkResult, error) {
+	lock := saveLock(userID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	pending := GetPendingChanges(userID)
+	if len(pending) == 0 {
+		slog.InfoContext(ctx, "No pending changes to save", "user_id", userID)
+		return nil, nil
+	}
+	slog.InfoContext(ctx, "Saving pending changes", "changes", len(pending), "user_id", userID)
+
+	wayIDs := make([]int64, 0, len(pending))
+	for wayID := range pending {
+		wayIDs = append(wayIDs, wayID)
+	}
+	sort.Slice(wayIDs, func(i, j int) bool { return wayIDs[i] < wayIDs[j] })
+
+	client := oauth.Client(token)
+	changesetFor := func(n int) (int64, error) {
+		return oauth.ReserveChangeset(ctx, cfg, token, userID, n)
+	}
+
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		builder := osmchange.NewBuilder(cfg.Theme().CreatedBy)
+		for _, wayID := range wayIDs {
+			way, err := patchedWay(ctx, cfg, token, wayID, pending[wayID])
+			if err != nil {
+				return nil, err
+			}
+			if way != nil {
+				builder.ModifyWay(*way)
+			}
+		}
+		if builder.Len() == 0 {
+			for _, wayID := range wayIDs {
+				RemovePendingChange(userID, wayID)
+			}
+			return nil, nil
+		}
+
+		chunks := builder.Split(cfg.MaxChangesetElements)
+		slog.InfoContext(ctx, "Uploading ways", "ways", builder.Len(), "chunks", len(chunks))
+
+		results, err := osmchange.UploadChunks(ctx, client, cfg.OSMAPIBase, chunks, changesetFor,
+			func(i int, result osmchange.ChunkResult) {
+				if result.Status == osmchange.ChunkUploaded {
+					oauth.Changesets.Used(userID, result.Changeset, result.Elements)
+					utils.Edits.Add(float64(len(result.Diff.Ways)), "way", "update")
+					for _, way := range result.Diff.Ways {
+						RemovePendingChange(userID, way.OldID)
+						WayCache.Forget(way.OldID)
+					}
+					slog.InfoContext(ctx, "Saved chunk", "chunk", i+1, "chunks", len(chunks), "user_id", userID, "changeset", result.Changeset)
+				}
+				// Every chunk gets a changeset of its own
+				if err := oauth.CloseCurrentChangeset(ctx, cfg, token, userID); err != nil {
+					slog.ErrorContext(ctx, "Failed to close changeset", "changeset", result.Changeset, "error", err)
+				}
+			})
+		if err != nil && oauth.IsVersionMismatchError(err) && results[0].Status == osmchange.ChunkFailed {
+			// Nothing was saved yet, so merge everything again
+			slog.WarnContext(ctx, "A way changed while uploading", "attempt", attempt, "error", err)
+			utils.Conflicts.Inc("way", "retried")
+			continue
+		}
+		if err != nil {
+			return results, fmt.Errorf("failed to upload changes: %w", err)
+		}
+
+		slog.InfoContext(ctx, "All changes saved", "user_id", userID)
+		return results, nil
+	}
+
+	return nil, apperr.New(apperr.Conflict, "ways kept changing, gave up after %d attempts", maxUpdateAttempts)
+}
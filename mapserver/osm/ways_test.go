@@ -0,0 +1,331 @@
+// osm/ways_test.go
+package osm
+
+import (
+	"context"
+	"errors"
+	"mapserver/config"
+	"mapserver/oauth"
+	"net/http"
+	"net/http/httptest"
+	"osmkit/apperr"
+	"osmkit/changeset"
+	"osmkit/fakeosm"
+	"osmkit/osmchange"
+	"osmkit/osmxml"
+	"osmkit/tags"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// wayVersion1 and wayVersion2 are way 100 as the API serves it, before and
+// after someone else renamed the road.
+const wayVersion1 = `<?xml version="1.0" encoding="UTF-8"?>
+<osm version="0.6" generator="openstreetmap-cgimap 2.0.1" copyright="OpenStreetMap and contributors" attribution="http://www.openstreetmap.org/copyright" license="http://opendatacommons.org/licenses/odbl/1-0/">
+ <node id="1" visible="true" version="1" changeset="10" timestamp="2024-03-01T10:00:00Z" user="mapper" uid="7" lat="44.4301000" lon="26.1020000"/>
+ <node id="2" visible="true" version="1" changeset="10" timestamp="2024-03-01T10:00:00Z" user="mapper" uid="7" lat="44.4305000" lon="26.1030000"/>
+ <node id="3" visible="true" version="1" changeset="10" timestamp="2024-03-01T10:00:00Z" user="mapper" uid="7" lat="44.4310000" lon="26.1041000"/>
+ <way id="100" visible="true" version="1" changeset="10" timestamp="2024-03-01T10:00:00Z" user="mapper" uid="7">
+  <nd ref="1"/>
+  <nd ref="2"/>
+  <nd ref="3"/>
+  <tag k="highway" v="residential"/>
+  <tag k="name" v="Strada Test"/>
+  <tag k="surface" v="asphalt"/>
+ </way>
+</osm>`
+
+const wayVersion2 = `<?xml version="1.0" encoding="UTF-8"?>
+<osm version="0.6" generator="openstreetmap-cgimap 2.0.1" copyright="OpenStreetMap and contributors" attribution="http://www.openstreetmap.org/copyright" license="http://opendatacommons.org/licenses/odbl/1-0/">
+ <way id="100" visible="true" version="2" changeset="11" timestamp="2024-04-02T08:30:00Z" user="other" uid="8">
+  <nd ref="1"/>
+  <nd ref="2"/>
+  <nd ref="3"/>
+  <tag k="highway" v="residential"/>
+  <tag k="name" v="Strada Noua"/>
+  <tag k="surface" v="asphalt"/>
+ </way>
+</osm>`
+
+// testToken is accepted by fakeosm, which registers a user for any token.
+var testToken = &oauth2.Token{AccessToken: "test"}
+
+// newTestAPI serves the recorded way from fakeosm and returns the zoning
+// configuration pointing at it.
+func newTestAPI(t *testing.T) *config.Config {
+	t.Helper()
+	return newWrappedTestAPI(t, func(api http.Handler) http.Handler { return api })
+}
+
+// newWrappedTestAPI is newTestAPI with the API served through wrap.
+func newWrappedTestAPI(t *testing.T, wrap func(api http.Handler) http.Handler) *config.Config {
+	t.Helper()
+	api := fakeosm.New()
+	for _, doc := range []string{wayVersion1, wayVersion2} {
+		if err := api.LoadFixture(strings.NewReader(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(wrap(api))
+	t.Cleanup(server.Close)
+
+	t.Setenv("CONFIG", "")
+	t.Setenv("CLIENT_ID", "test")
+	t.Setenv("CLIENT_SECRET", "test")
+	t.Setenv("REDIRECT_URI", server.URL+"/callback")
+	t.Setenv("AUTH_URL", server.URL+"/oauth2/authorize")
+	t.Setenv("TOKEN_URL", server.URL+"/oauth2/token")
+	t.Setenv("OSM_API_BASE", server.URL+"/api/0.6")
+	t.Setenv("OVERPASS_URL", server.URL+"/api/interpreter")
+	cfg, err := config.Load("", "../themes/zoning.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changesets opened on the server of an earlier test are unknown here
+	oauth.Changesets = changeset.NewManager()
+	oauth.Init(cfg)
+	Init(cfg)
+	return cfg
+}
+
+func refs(way *osmxml.Way) []int64 {
+	var ids []int64
+	for _, nd := range way.Nds {
+		ids = append(ids, nd.Ref)
+	}
+	return ids
+}
+
+func TestPatchedWay(t *testing.T) {
+	cfg := newTestAPI(t)
+	tests := []struct {
+		name     string
+		patch    tags.Patch
+		want     map[string]string // nil when nothing is left to upload
+		conflict bool
+	}{
+		{
+			name:  "set on the latest version",
+			patch: tags.Patch{Set: map[string]string{"zoning_code": "R1"}, Version: 2},
+			want:  map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt", "zoning_code": "R1"},
+		},
+		{
+			name:  "unknown version",
+			patch: tags.Patch{Set: map[string]string{"zoning_code": "R1"}},
+			want:  map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt", "zoning_code": "R1"},
+		},
+		{
+			name:  "delete",
+			patch: tags.Patch{Delete: []string{"surface"}, Version: 2},
+			want:  map[string]string{"highway": "residential", "name": "Strada Noua"},
+		},
+		{
+			name:  "merged with a later rename",
+			patch: tags.Patch{Set: map[string]string{"zoning_code": "R1"}, Delete: []string{"surface"}, Version: 1},
+			want:  map[string]string{"highway": "residential", "name": "Strada Noua", "zoning_code": "R1"},
+		},
+		{
+			name:  "already applied",
+			patch: tags.Patch{Set: map[string]string{"name": "Strada Noua"}, Version: 2},
+		},
+		{
+			name:     "conflicts with a later rename",
+			patch:    tags.Patch{Set: map[string]string{"name": "Strada Veche"}, Version: 1},
+			conflict: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			way, err := patchedWay(context.Background(), cfg, testToken, 100, tt.patch)
+			if tt.conflict {
+				var conflict *tags.ConflictError
+				if !errors.As(err, &conflict) {
+					t.Fatalf("got error %v, want a conflict", err)
+				}
+				if conflict.Version != 2 || len(conflict.Conflicts) != 1 || conflict.Conflicts[0].Key != "name" {
+					t.Errorf("got %+v, want a conflict on name at version 2", conflict)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if way != nil {
+					t.Fatalf("got way with tags %v, want nothing to upload", way.Tags.Map())
+				}
+				return
+			}
+			if way == nil {
+				t.Fatal("got nothing to upload")
+			}
+			if way.Version != 2 {
+				t.Errorf("version = %d, want 2", way.Version)
+			}
+			if got := refs(way); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+				t.Errorf("node refs = %v, want [1 2 3]", got)
+			}
+			if got := way.Tags.Map(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tags = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateWayTags(t *testing.T) {
+	cfg := newTestAPI(t)
+	ctx := context.Background()
+	patch := tags.Patch{Set: map[string]string{"zoning_code": "R1"}, Version: 1}
+	if err := UpdateWayTags(ctx, cfg, testToken, 1, 100, patch); err != nil {
+		t.Fatal(err)
+	}
+
+	way, err := fetchWay(cfg, 100, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if way.Version != 3 {
+		t.Errorf("version = %d, want 3", way.Version)
+	}
+	if got := refs(way); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("node refs = %v, want [1 2 3]", got)
+	}
+	want := map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt", "zoning_code": "R1"}
+	if got := way.Tags.Map(); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+
+	// Uploading the same patch again changes nothing
+	if err := UpdateWayTags(ctx, cfg, testToken, 1, 100, patch); err != nil {
+		t.Fatal(err)
+	}
+	if way, err = fetchWay(cfg, 100, testToken); err != nil {
+		t.Fatal(err)
+	}
+	if way.Version != 3 {
+		t.Errorf("version after the same patch = %d, want 3", way.Version)
+	}
+}
+
+func TestUpdateWayTagsNotEditable(t *testing.T) {
+	cfg := newTestAPI(t)
+	patch := tags.Patch{Set: map[string]string{"highway": "service"}, Version: 2}
+	err := UpdateWayTags(context.Background(), cfg, testToken, 1, 100, patch)
+	if !apperr.Is(err, apperr.Validation) {
+		t.Fatalf("got error %v, want a validation error", err)
+	}
+	way, err := fetchWay(cfg, 100, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if way.Version != 2 {
+		t.Errorf("version = %d, want 2", way.Version)
+	}
+}
+
+func TestPendingChanges(t *testing.T) {
+	cfg := newTestAPI(t)
+	const userID = 2
+	if err := AddPendingChange(cfg, userID, 100, tags.Patch{Set: map[string]string{"zoning_code": "R1"}, Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// Queued again after the conflict with version 2, which the user has seen
+	if err := AddPendingChange(cfg, userID, 100, tags.Patch{Set: map[string]string{"zoning_code": "R2"}, Version: 2}); err != nil {
+		t.Fatal(err)
+	}
+	want := tags.Patch{Set: map[string]string{"zoning_code": "R2"}, Version: 2}
+	if got := GetPendingChanges(userID)[100]; !reflect.DeepEqual(got, want) {
+		t.Errorf("queued %+v, want %+v", got, want)
+	}
+
+	if !RemovePendingChange(userID, 100) {
+		t.Error("the queued change was not dropped")
+	}
+	if RemovePendingChange(userID, 100) {
+		t.Error("dropped a change that was not queued")
+	}
+	if got := GetPendingChanges(userID); len(got) != 0 {
+		t.Errorf("got %v still queued", got)
+	}
+}
+
+func TestFetchGeometry(t *testing.T) {
+	cfg := newTestAPI(t)
+	got, err := fetchGeometry(cfg, []int64{1, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Geometry{{Lat: 44.4301, Lon: 26.102}, {Lat: 44.431, Lon: 26.1041}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := fetchGeometry(cfg, []int64{1, 4}); err == nil {
+		t.Error("got no error for a missing node")
+	}
+}
+
+func TestFetchWaysInvertedBBox(t *testing.T) {
+	cfg := newTestAPI(t)
+	// South above north used to reach the way cache and panic there
+	_, _, err := FetchWays(context.Background(), cfg, "44.44,26.10,44.42,26.11")
+	if !apperr.Is(err, apperr.Validation) {
+		t.Errorf("got error %v, want a validation error", err)
+	}
+}
+
+func TestSaveChangesConcurrently(t *testing.T) {
+	var uploads atomic.Int32
+	cfg := newWrappedTestAPI(t, func(api http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/upload") {
+				uploads.Add(1)
+				// Give a second save time to read the way before this lands
+				time.Sleep(50 * time.Millisecond)
+			}
+			api.ServeHTTP(w, r)
+		})
+	})
+	const userID = 3
+	if err := AddPendingChange(cfg, userID, 100, tags.Patch{Set: map[string]string{"zoning_code": "R1"}, Version: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]osmchange.ChunkResult, 2)
+	errs := make([]error, 2)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = SaveChanges(context.Background(), cfg, testToken, userID)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The save that waited found nothing left to upload
+	if n := uploads.Load(); n != 1 || len(results[0])+len(results[1]) != 1 {
+		t.Errorf("got %d uploads and results %+v, want one upload", n, results)
+	}
+	way, err := fetchWay(cfg, 100, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if way.Version != 3 || way.Tags.Map()["zoning_code"] != "R1" {
+		t.Errorf("got version %d with tags %v, want version 3", way.Version, way.Tags.Map())
+	}
+	if got := GetPendingChanges(userID); len(got) != 0 {
+		t.Errorf("got %v still queued", got)
+	}
+}
@@ -1,5 +1,6 @@
 import { showModal, hideModal } from './modal.js';
 import { mymap } from './map.js';
+import { errorMessage } from './utils.js';
 
 export let isAddingSource = false;
 
@@ -263,7 +264,7 @@ const addNodeToOSM = async (lat, lon, tags) => {
         });
 
         if (!response.ok) {
-            throw new Error(await response.text());
+            throw new Error(await errorMessage(response));
         }
 
         toastr.success(await response.text());
@@ -6,7 +6,37 @@ import {filterData} from "./filter.js";
 import { fetchNodeDetails, updateNodeDetails, editInPlace } from './editInPlace.js';
 
 const markers = L.markerClusterGroup();
-let allData = { toilets: [], gasStations: [], restaurants: [] }; // Store all fetched data
+let allData = {}; // Fetched elements by layer id
+let layersPromise = null;
+
+// The layers come from the server, see themes/toilet.yaml. Elements are only
+// fetched for the layers that are switched on.
+export const getLayers = () => {
+    if (!layersPromise) {
+        layersPromise = fetch('/layers')
+            .then(response => response.json())
+            .then(layers => layers.map(layer => ({ ...layer, enabled: true })));
+    }
+    return layersPromise;
+};
+
+export const resetData = () => {
+    allData = {};
+};
+
+const layerIcons = {};
+const layerIcon = (layer) => {
+    if (!layerIcons[layer.id]) {
+        layerIcons[layer.id] = L.icon({
+            iconUrl: layer.icon || '/static/question_mark_icon.png',
+            iconSize: [25, 25],
+            iconAnchor: [16, 37],
+            popupAnchor: [0, -28],
+            className: 'layer-icon'
+        });
+    }
+    return layerIcons[layer.id];
+};
 
 const icons = {
     toilet: L.icon({
@@ -67,6 +97,8 @@ const getNodeTypeAndIcon = (node) => {
         } else {
             return { type: 'toilet', icon: icons.toilet }; // Default to toilet type
         }
+    } else if (node.layer) {
+        return { type: node.layer.name, icon: layerIcon(node.layer) }; // Icon of the layer for other nodes
     } else {
         return { type: 'unknown', icon: icons.unknown }; // Use unknown icon for other nodes
     }
@@ -118,7 +150,7 @@ const createPopupContent = async (node, denumire) => {
         ${formatTags(node.tags)}
         <div class="mapillary-thumbnail">${mapillaryLink}</div>
         <a href="#" class="edit-link" data-node-id="${node.id}">Edit this node</a><br>
-        <a href="#" class="edit-in-place-link" data-node-id="${node.id}">Edit In place</a><br>
+        ${node.layer && !node.layer.editable ? '' : `<a href="#" class="edit-in-place-link" data-node-id="${node.id}">Edit In place</a><br>`}
         <button class="route-button" data-lat="${node.lat}" data-lon="${node.lon}">Route to here</button>
     `;
 
@@ -159,10 +191,13 @@ const createMarker = async (node) => {
             event.preventDefault();
             editNode(event.target.dataset.nodeId);
         });
-        popupElement.querySelector('.edit-in-place-link').addEventListener('click', (event) => {
-            event.preventDefault();
-            editInPlace(event.target.dataset.nodeId);
-        });
+        const editInPlaceLink = popupElement.querySelector('.edit-in-place-link');
+        if (editInPlaceLink) {
+            editInPlaceLink.addEventListener('click', (event) => {
+                event.preventDefault();
+                editInPlace(event.target.dataset.nodeId);
+            });
+        }
         popupElement.querySelector('.route-button').addEventListener('click', (event) => {
             const lat = parseFloat(event.target.dataset.lat);
             const lon = parseFloat(event.target.dataset.lon);
@@ -211,19 +246,30 @@ export const fetchDataAndAddMarkers = async (map, criteria = {}) => {
         return;
     }
 
-    if (allData.toilets.length === 0 && allData.gasStations.length === 0 && allData.restaurants.length === 0) {
+    const layers = await getLayers();
+    const enabled = layers.filter(layer => layer.enabled);
+
+    if (enabled.some(layer => !allData[layer.id])) {
         const bounds = map.getBounds();
         const bbox = `${bounds.getSouth()},${bounds.getWest()},${bounds.getNorth()},${bounds.getEast()}`;
+        const ids = enabled.map(layer => layer.id).join(',');
 
         try {
-            const response = await fetch(`/data?bbox=${bbox}`);
+            const response = await fetch(`/data?bbox=${bbox}&layers=${encodeURIComponent(ids)}`);
             const data = await response.json();
-            allData.toilets = data.toilets;
-            allData.toiletsPois = data.toiletsPois;
-            allData.tourismPois = data.tourismPois;
-            allData.shopPois = data.shopPois;
-            allData.gasStations = data.gasStations;
-            allData.restaurants = data.restaurants;
+            if (!response.ok) {
+                toastr.error(`Failed to load the map data: ${data.message}`);
+                return;
+            }
+            // Layers that failed come back empty, the others are still shown
+            if (data.errors) {
+                console.warn('Some layers failed to load:', data.errors);
+                const names = layers.filter(layer => data.errors[layer.id]).map(layer => layer.name);
+                toastr.warning(`Could not load ${names.join(', ')}, try again later`);
+            }
+            enabled.forEach(layer => {
+                allData[layer.id] = (data[layer.id] || []).map(node => ({ ...node, layer }));
+            });
         } catch (error) {
             console.error('Error fetching data:', error);
             return;
@@ -237,15 +283,10 @@ export const fetchDataAndAddMarkers = async (map, criteria = {}) => {
         return;
     }
 
-    // Combine all data into a single array for filtering and mapping
-    const combinedData = [
-        ...allData.toilets,
-        ...allData.toiletsPois,
-        ...allData.shopPois,
-        ...allData.tourismPois,
-        ...allData.gasStations,
-        ...allData.restaurants
-    ];
+    // Combine the layers shown at this zoom into a single array for filtering and mapping
+    const combinedData = enabled
+        .filter(layer => map.getZoom() >= (layer.minZoom || 0))
+        .flatMap(layer => allData[layer.id] || []);
 
     const filteredData = filterData(combinedData, criteria);
     const markersToAdd = await filterAndMapNodes(filteredData);
@@ -1,4 +1,5 @@
 // editInPlace.js
+import { errorMessage } from './utils.js';
 
 const fetchNodeDetails = async (nodeId) => {
     try {
@@ -13,16 +14,51 @@ const fetchNodeDetails = async (nodeId) => {
     }
 };
 
-const updateNodeDetails = async (nodeId, updatedTags) => {
+// Only send what the user changed, so tags edited by someone else in the meantime are kept
+const buildTagPatch = (originalTags, updatedTags) => {
+    const set = {};
+    const remove = [];
+    Object.entries(updatedTags).forEach(([key, value]) => {
+        if (value === '') {
+            if (key in originalTags) {
+                remove.push(key);
+            }
+        } else if (originalTags[key] !== value) {
+            set[key] = value;
+        }
+    });
+    return { set, delete: remove };
+};
+
+const formatConflictValue = (value) => value === null ? '(none)' : value;
+
+const confirmOverwrite = (conflict) => {
+    const lines = conflict.conflicts.map(c =>
+        `${c.key}: yours "${formatConflictValue(c.ours)}", theirs "${formatConflictValue(c.theirs)}"`);
+    return confirm(`This node was changed by someone else in the meantime:\n\n${lines.join('\n')}\n\nOverwrite their values with yours?`);
+};
+
+const updateNodeDetails = async (nodeId, patch) => {
     try {
         const response = await fetch(`/updateNode/${nodeId}`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify(updatedTags)
+            body: JSON.stringify(patch)
         });
 
+        if (response.status === 409) {
+            // Someone else changed the same tags since the node was loaded: let the user decide
+            const conflict = await response.json();
+            if (confirmOverwrite(conflict)) {
+                await updateNodeDetails(nodeId, { ...patch, version: conflict.version });
+            } else {
+                toastr.warning('Update cancelled, reload the node to see the latest tags');
+            }
+            return;
+        }
+
         if (!response.ok) {
-            throw new Error('Failed to update node details');
+            throw new Error(await errorMessage(response));
         }
 
         toastr.success('Node details updated successfully');
@@ -38,7 +74,7 @@ const updateNodeDetails = async (nodeId, updatedTags) => {
 
     } catch (error) {
         console.error('Error updating node details:', error);
-        toastr.error('Failed to update node details');
+        toastr.error(`Failed to update node details: ${error.message}`);
     }
 };
 
@@ -159,7 +195,13 @@ const editInPlace = async (nodeId) => {
             updatedTags['toilets'] = 'yes';
         }
 
-        await updateNodeDetails(nodeId, updatedTags);
+        const patch = { ...buildTagPatch(nodeDetails.tags, updatedTags), version: nodeDetails.version };
+        if (Object.keys(patch.set).length === 0 && patch.delete.length === 0) {
+            toastr.info('Nothing to update');
+            return;
+        }
+
+        await updateNodeDetails(nodeId, patch);
     });
 
     popupContent.innerHTML = '';
@@ -1,5 +1,25 @@
 // filters.js
-import { fetchDataAndAddMarkers } from './data.js';
+import { fetchDataAndAddMarkers, getLayers } from './data.js';
+
+// populateLayers adds a toggle per layer of the map
+const populateLayers = async (map) => {
+    const layers = await getLayers();
+    const layersContainer = document.getElementById('layers');
+    layersContainer.innerHTML = '';
+    layers.forEach(layer => {
+        const layerId = `layer-${layer.id}`;
+        const layerElement = document.createElement('div');
+        layerElement.innerHTML = `
+            <input type="checkbox" id="${layerId}" ${layer.enabled ? 'checked' : ''}>
+            <label for="${layerId}">${layer.name}</label>
+        `;
+        layerElement.querySelector('input').addEventListener('change', (event) => {
+            layer.enabled = event.target.checked;
+            fetchDataAndAddMarkers(map);
+        });
+        layersContainer.appendChild(layerElement);
+    });
+};
 
 const createFilterElement = (key, value, count) => {
     const filterId = `filter-${key}-${value}`;
@@ -52,4 +72,4 @@ const setupFilterEventListeners = (map) => {
     });
 };
 
-export { populateFilters, setupFilterEventListeners };
+export { populateFilters, populateLayers, setupFilterEventListeners };
@@ -2,7 +2,7 @@
 import { getUrlParameter, setUrlParameters, saveMapCenterToCookies, getUserPosition } from './utils.js';
 import { onMapClick, isAddingSource } from './addSource.js';
 import { fetchDataAndAddMarkers } from './data.js';
-import { populateFilters, setupFilterEventListeners } from './filters.js';
+import { populateFilters, populateLayers, setupFilterEventListeners } from './filters.js';
 import { showModal } from './modal.js';
 
 
@@ -104,11 +104,13 @@ document.addEventListener("DOMContentLoaded", async function() {
     const bounds = mymap.getBounds();
     const bbox = `${bounds.getSouth()},${bounds.getWest()},${bounds.getNorth()},${bounds.getEast()}`;
 
+    populateLayers(mymap);
+
     const response = await fetch(`/data?bbox=${bbox}`);
     const data = await response.json();
 
-    // Get top key-value pairs
-    const topKeyValues = getTopKeyValues(data);
+    // Get top key-value pairs over the elements of every layer
+    const topKeyValues = getTopKeyValues(Object.values(data).filter(Array.isArray).flat());
     console.log('Top key-value pairs:', topKeyValues);
 
     // Populate filters
@@ -67,3 +67,13 @@ export const getUserPosition = (callback) => {
         console.error("Geolocation is not supported by this browser.");
     }
 };
+
+// Reads the message of a JSON error response, falling back to the raw body
+export const errorMessage = async (response) => {
+    const text = await response.text();
+    try {
+        return JSON.parse(text).message || text;
+    } catch {
+        return text;
+    }
+};
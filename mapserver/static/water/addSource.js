@@ -257,8 +257,7 @@ const addNodeToOSM = async (lat, lon, tags) => {
         });
 
         if (!response.ok) {
-            const errorText = await response.text();
-            throw new Error(errorText);
+            throw new Error(await errorMessage(response));
         }
 
         const result = await response.text();
@@ -56,4 +56,13 @@ const getUserPosition = (callback) => {
     } else {
         console.error("Geolocation is not supported by this browser.");
     }
-};
\ No newline at end of file
+};
+// Reads the message of a JSON error response, falling back to the raw body
+const errorMessage = async (response) => {
+    const text = await response.text();
+    try {
+        return JSON.parse(text).message || text;
+    } catch {
+        return text;
+    }
+};
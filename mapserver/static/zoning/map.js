@@ -4,7 +4,7 @@ import { getUrlParameter, setUrlParameters } from './utils.js';
 import { initializeMap } from './mapInitialization.js';
 import { setupMapEventListeners } from './events.js';
 import { fetchDataAndAddMarkers } from './markers.js';
-import { editWay, submitEditWayForm } from './wayUtils.js';
+import { editWay, submitEditWayForm, queueEditWayForm, saveChanges } from './wayUtils.js';
 
 document.addEventListener("DOMContentLoaded", async function () {
     const initialLat = parseFloat(getUrlParameter('lat')) || 45.9432;
@@ -13,9 +13,10 @@ document.addEventListener("DOMContentLoaded", async function () {
 
     window.mymap = initializeMap(initialLat, initialLon, initialZoom); // Define mymap globally
 
-    // Attach editWay and submitEditWayForm to the global window object
+    // Attach the edit form handlers to the global window object
     window.editWay = editWay;
     window.submitEditWayForm = submitEditWayForm;
+    window.queueEditWayForm = queueEditWayForm;
 
     setupMapEventListeners(window.mymap);
 
@@ -60,7 +61,7 @@ const searchStreets = () => {
                     <div class="popup-content">
                         <b>Road Segment</b><br>
                         ${formatTags(result.tags)}
-                        <a href="#" class="edit-link" onclick='editWay(${result.id}, ${JSON.stringify(result.tags)}); return false;'>Edit this segment</a>
+                        <a href="#" class="edit-link" onclick='editWay(${result.id}, ${JSON.stringify(result.tags)}, ${result.version}); return false;'>Edit this segment</a>
                     </div>
                 `)
                 .openOn(window.mymap);
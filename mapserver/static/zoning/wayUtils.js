@@ -0,0 +1,278 @@
+// wayUtils.js
+
+const zoningCodeColors = {
+    residential: 'blue',
+    commercial: 'green',
+    industrial: 'red',
+    A: 'gold',
+    B: 'orange',
+    C: 'red',
+    D: 'red',
+    // Add more zoning codes and their colors here
+};
+
+export const createWay = (way) => {
+    const latlngs = way.geometry.map(point => [point.lat, point.lon]);
+    const zoningCode = way.tags['zoning_code'];
+    const color = zoningCodeColors[zoningCode] || 'gray'; // Default color
+
+    const wayPolyline = L.polyline(latlngs, {
+        color,
+        weight: 15,  // Adjust the width here
+        opacity: 0.3 // Adjust the transparency here
+    });
+
+    const popupContent = `
+        <div class="popup-content">
+            <b>Road Segment</b><br>
+            ${formatTags(way.tags)}
+            <a href="#" class="edit-link" onclick='editWay(${way.id}, ${JSON.stringify(way.tags)}, ${way.version}); return false;'>Edit this segment</a>
+        </div>
+    `;
+    wayPolyline.bindPopup(popupContent);
+
+    wayPolyline.on('click', () => {
+        wayPolyline.openPopup();
+        mymap.setView(latlngs[0], 18); // Zoom to the way
+    });
+
+    return wayPolyline;
+};
+
+export const createLegend = (data) => {
+    const legendContainer = document.getElementById('legend');
+    legendContainer.innerHTML = ''; // Clear previous legend
+
+    const zoningCodes = [...new Set(data.map(way => way.tags['zoning_code']))];
+
+    zoningCodes.forEach(zoningCode => {
+        const color = zoningCodeColors[zoningCode] || 'blue';
+        const legendItem = document.createElement('div');
+        legendItem.classList.add('legend-item');
+        legendItem.innerHTML = `
+            <span class="legend-color" style="background-color: ${color};"></span>
+            <span>${zoningCode}</span>
+        `;
+        legendContainer.appendChild(legendItem);
+    });
+};
+
+const formatTags = (tags) => {
+    if (!tags) return 'No tags available';
+
+    return Object.entries(tags)
+        .map(([key, value]) => `${key}: ${value}`)
+        .join('<br>');
+};
+
+const createFormField = (label, id, value) => `
+    <label for="${id}">${label}:</label>
+    <input type="text" id="${id}" name="${id}" value="${value}"><br>
+`;
+
+export const editWay = (wayId, tags, version) => {
+    const uniqueFields = {};
+    const commonFields = ['addr:neighborhood', 'zoning_code', 'old_name'];
+
+    commonFields.forEach(field => {
+        if (tags[field]) {
+            uniqueFields[field] = tags[field];
+            delete tags[field];
+        } else {
+            uniqueFields[field] = '';
+        }
+    });
+
+    const formFields = Object.entries(tags).map(([key, value]) => createFormField(key, key, value)).join('');
+
+    const commonFormFields = Object.entries(uniqueFields).map(([key, value]) => createFormField(key, key, value)).join('');
+
+    const popup = L.popup()
+        .setLatLng(mymap.getCenter())
+        .setContent(`
+            <div>
+                <h3>Edit Way ${wayId}</h3>
+                <form id="editWayForm" onsubmit="submitEditWayForm(${wayId}, ${version}); return false;">
+                    ${commonFormFields}
+                    ${formFields}
+                    <button type="submit">Save</button>
+                    <button type="button" onclick="queueEditWayForm(${wayId}, ${version})">Save later</button>
+                </form>
+            </div>
+        `)
+        .openOn(mymap);
+};
+
+// Builds the tag patch of the edit form, or null when nothing changed
+const editWayPatch = (wayId, version) => {
+    const form = document.getElementById("editWayForm");
+    // Only send the fields the user changed; emptied fields delete the tag
+    const set = {};
+    const remove = [];
+    Array.from(form.querySelectorAll("input")).forEach(input => {
+        const value = input.value.trim();
+        if (value === input.defaultValue.trim()) {
+            return;
+        }
+        if (value === "") {
+            remove.push(input.name);
+        } else {
+            set[input.name] = value;
+        }
+    });
+
+    if (Object.keys(set).length === 0 && remove.length === 0) {
+        alert("Nothing to update");
+        return null;
+    }
+    return { id: wayId, set, delete: remove, version };
+};
+
+export const submitEditWayForm = async (wayId, version) => {
+    const patch = editWayPatch(wayId, version);
+    if (patch) {
+        await updateWay(patch);
+    }
+};
+
+// Queues the edit on the server; "Save Changes" uploads all queued edits at once
+export const queueEditWayForm = async (wayId, version) => {
+    const patch = editWayPatch(wayId, version);
+    if (!patch) {
+        return;
+    }
+
+    try {
+        const response = await queueChange(patch);
+        if (!response.ok) {
+            alert("Failed to queue change: " + await errorMessage(response));
+            return;
+        }
+        mymap.closePopup();
+        alert(await response.text());
+    } catch (error) {
+        console.error('Error queueing change:', error);
+        alert("Failed to queue change");
+    }
+};
+
+// Adds the patch to the queued change of its way, if there is one
+const queueChange = (patch) => fetch(`/pendingchange`, {
+    method: "POST",
+    headers: {
+        "Content-Type": "application/json"
+    },
+    body: JSON.stringify(patch)
+});
+
+// Queues our values of the conflicting keys against the latest version of the
+// way, which also moves the rest of its queued change onto that version
+const requeueOurs = (conflict) => {
+    const set = {};
+    const remove = [];
+    conflict.conflicts.forEach(c => {
+        if (c.ours === null) {
+            remove.push(c.key);
+        } else {
+            set[c.key] = c.ours;
+        }
+    });
+    return queueChange({ id: conflict.id, set, delete: remove, version: conflict.version });
+};
+
+export const saveChanges = async () => {
+    try {
+        const response = await fetch(`/savechanges`, { method: "POST" });
+        if (response.status === 409) {
+            // Nothing was saved: keep our values or drop the way, then save the rest
+            const conflict = await response.json();
+            const resolved = confirmOverwrite(conflict)
+                ? await requeueOurs(conflict)
+                : await fetch(`/pendingchange/${conflict.id}`, { method: "DELETE" });
+            if (!resolved.ok) {
+                alert(`Failed to resolve the conflict on way ${conflict.id}: ` + await errorMessage(resolved));
+                return;
+            }
+            await saveChanges();
+            return;
+        }
+        if (response.status === 401) {
+            alert("You are not authenticated. Redirecting to login page.");
+            window.location.href = "/login";
+            return;
+        }
+
+        // Large saves are split over several changesets, each reported as a chunk
+        const result = await response.json();
+        const chunks = (result.chunks || []).map((chunk, i) =>
+            `Part ${i + 1}: ${chunk.elements} ways, ${chunk.status}` + (chunk.changeset ? ` (changeset ${chunk.changeset})` : ""));
+        if (!response.ok) {
+            alert(`Failed to save changes: ${result.message}\n\n${chunks.join("\n")}`);
+            return;
+        }
+        if (result.changesets.length === 0) {
+            alert("Nothing to save");
+            return;
+        }
+        alert(`Changes saved in changesets ${result.changesets.join(", ")}\n\n${chunks.join("\n")}`);
+    } catch (error) {
+        console.error('Error saving changes:', error);
+        alert("Failed to save changes");
+    }
+};
+
+// Reads the message of a JSON error response, falling back to the raw body
+const errorMessage = async (response) => {
+    const text = await response.text();
+    try {
+        return JSON.parse(text).message || text;
+    } catch {
+        return text;
+    }
+};
+
+const formatConflictValue = (value) => value === null ? "(none)" : value;
+
+// Asks whether to overwrite the values someone else saved since the way was loaded
+const confirmOverwrite = (conflict) => {
+    const lines = conflict.conflicts.map(c =>
+        `${c.key}: yours "${formatConflictValue(c.ours)}", theirs "${formatConflictValue(c.theirs)}"`);
+    return confirm(`This way was changed by someone else in the meantime:\n\n${lines.join("\n")}\n\nOverwrite their values with yours?`);
+};
+
+const updateWay = async (patch) => {
+    try {
+        const response = await fetch(`/updateway`, {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json"
+            },
+            body: JSON.stringify(patch)
+        });
+
+        if (response.status === 409) {
+            const conflict = await response.json();
+            if (confirmOverwrite(conflict)) {
+                await updateWay({ ...patch, version: conflict.version });
+            } else {
+                alert("Update cancelled, reload the map to see the latest tags");
+            }
+            return;
+        }
+
+        if (!response.ok) {
+            if (response.status === 401) {
+                alert("You are not authenticated. Redirecting to login page.");
+                window.location.href = "/login";
+            } else {
+                alert("Failed to update way: " + await errorMessage(response));
+            }
+            return;
+        }
+
+        alert("Way updated successfully");
+    } catch (error) {
+        console.error('Error updating way:', error);
+        alert("Failed to update way");
+    }
+};
@@ -6,31 +6,36 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"osmkit/apperr"
 )
 
+// UserAgent is sent with every request to the OSM API, set from the theme.
+var UserAgent = "mapserver"
+
 func CreateRequest(method, url, contentType string, body []byte) (*http.Request, error) {
 	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", UserAgent)
 	return req, nil
 }
 
 func DoRequest(client *http.Client, req *http.Request) ([]byte, error) {
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %v", err)
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "request to %s failed", req.URL.Path)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request failed: status code %d", resp.StatusCode)
-	}
-
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "failed to read response body")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apperr.FromStatus(resp.StatusCode, string(body), "request to %s failed", req.URL.Path)
 	}
 
 	return body, nil
@@ -0,0 +1,41 @@
+// utils/metrics.go
+package utils
+
+import (
+	"net/http"
+	"osmkit/metrics"
+	"time"
+)
+
+// Metrics is served on /metrics. The metrics of the caches and the dataset
+// are registered by osm.Init, as only those of the theme exist.
+var Metrics = metrics.NewRegistry()
+
+var (
+	overpassLatency = Metrics.Histogram("mapserver_overpass_request_duration_seconds",
+		"Time until Overpass answered, by endpoint and status code.", metrics.DefaultBuckets, "endpoint", "status")
+	osmAPILatency = Metrics.Histogram("mapserver_osm_api_request_duration_seconds",
+		"Time until the OSM API answered, by endpoint and status code.", metrics.DefaultBuckets, "endpoint", "status")
+
+	// Edits counts the elements saved to OSM, by element type and action,
+	// "create" or "update".
+	Edits = Metrics.Counter("mapserver_edits_total",
+		"Elements saved to OSM, by element type and action.", "element", "action")
+	ChangesetsOpened = Metrics.Counter("mapserver_changesets_opened_total", "Changesets opened.")
+	ChangesetsClosed = Metrics.Counter("mapserver_changesets_closed_total", "Changesets closed by the server.")
+	// Conflicts counts edits that met a newer version of their element, by
+	// outcome: "merged" when the changes did not overlap, "refused" when the
+	// user had to decide, "retried" when it changed while uploading.
+	Conflicts = Metrics.Counter("mapserver_edit_conflicts_total",
+		"Edits that met a newer version of their element, by element type and outcome.", "element", "outcome")
+)
+
+// osmAPITimeout bounds the reads of the OSM API made without a user's token.
+// The OAuth client of a user shares the transport and has its own timeout.
+const osmAPITimeout = 30 * time.Second
+
+// HTTPClient is the client for the OSM API and its OAuth endpoints.
+var HTTPClient = &http.Client{Transport: &metrics.Transport{Histogram: osmAPILatency}, Timeout: osmAPITimeout}
+
+// OverpassHTTPClient is the client for the Overpass mirrors.
+var OverpassHTTPClient = &http.Client{Transport: &metrics.Transport{Histogram: overpassLatency}}
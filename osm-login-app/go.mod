@@ -3,6 +3,6 @@ module osm-login-app
 go 1.22.2
 
 require (
-	github.com/joho/godotenv v1.5.1 // indirect
-	golang.org/x/oauth2 v0.20.0 // indirect
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/oauth2 v0.20.0
 )
@@ -1,7 +0,0 @@
-// constants/constants.go
-package constants
-
-const (
-	ChangesetComment = "Adding a new Public Toilet node"
-	CreatedBy        = "ToiletMap.com Editor"
-)
@@ -1,12 +0,0 @@
-module toilet_map
-
-go 1.20
-
-require (
-	github.com/gorilla/mux v1.8.1
-	github.com/gorilla/sessions v1.3.0
-	github.com/joho/godotenv v1.5.1
-	golang.org/x/oauth2 v0.21.0
-)
-
-require github.com/gorilla/securecookie v1.1.2 // indirect
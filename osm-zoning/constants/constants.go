@@ -1,6 +0,0 @@
-package constants
-
-const (
-	ChangesetComment = "Updated road information"
-	CreatedBy        = "OSM-ZoningApp"
-)
@@ -0,0 +1,151 @@
+// apperr/apperr.go
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"osmkit/tags"
+)
+
+// Kind classifies an error by what the client can do about it.
+type Kind string
+
+const (
+	NotAuthenticated    Kind = "not_authenticated"
+	Conflict            Kind = "conflict"
+	Gone                Kind = "gone"
+	RateLimited         Kind = "rate_limited"
+	UpstreamUnavailable Kind = "upstream_unavailable"
+	Validation          Kind = "validation"
+	Internal            Kind = "internal"
+)
+
+// Status returns the HTTP status our handlers answer with for the kind.
+func (k Kind) Status() int {
+	switch k {
+	case NotAuthenticated:
+		return http.StatusUnauthorized
+	case Conflict:
+		return http.StatusConflict
+	case Gone:
+		return http.StatusGone
+	case RateLimited:
+		return http.StatusTooManyRequests
+	case UpstreamUnavailable:
+		return http.StatusBadGateway
+	case Validation:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an error with a Kind. Message is safe to show to the user.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns an error of the given kind.
+func New(kind Kind, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap returns an error of the given kind that keeps err as its cause.
+func Wrap(kind Kind, err error, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// FromStatus classifies a failed response of the OSM API or Overpass.
+func FromStatus(status int, body string, format string, args ...interface{}) *Error {
+	kind := UpstreamUnavailable
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		kind = NotAuthenticated
+	case http.StatusConflict:
+		kind = Conflict
+	case http.StatusGone, http.StatusNotFound:
+		kind = Gone
+	case http.StatusTooManyRequests:
+		kind = RateLimited
+	case http.StatusBadRequest, http.StatusPreconditionFailed:
+		kind = Validation
+	}
+	msg := fmt.Sprintf(format, args...)
+	return &Error{Kind: kind, Message: fmt.Sprintf("%s: status code %d and Body:%s", msg, status, body)}
+}
+
+// KindOf returns the kind of err, Internal for errors without one.
+func KindOf(err error) Kind {
+	var conflict *tags.ConflictError
+	if errors.As(err, &conflict) {
+		return Conflict
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Internal
+}
+
+// internalMessage is all the client learns of an Internal error, whose text
+// may hold upstream responses or details of our own.
+const internalMessage = "Internal server error"
+
+// Message returns what the client is told about err: its text, or a generic
+// message for Internal errors, which are only detailed in the logs.
+func Message(err error) string {
+	if KindOf(err) == Internal {
+		return internalMessage
+	}
+	return err.Error()
+}
+
+// Is reports whether err is of the given kind.
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
+
+// Write answers the request with err as a JSON body:
+//
+//	{"error": "conflict", "message": "..."}
+//
+// Edit conflicts also carry the fields of tags.ConflictError so the page can
+// ask the user which values to keep. Internal errors are logged with the
+// context of r and answered with a generic message.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	kind := KindOf(err)
+	if kind == Internal {
+		slog.ErrorContext(r.Context(), "Internal error", "error", err)
+	}
+	body := map[string]interface{}{
+		"error":   kind,
+		"message": Message(err),
+	}
+
+	var conflict *tags.ConflictError
+	if errors.As(err, &conflict) {
+		body["type"] = conflict.Type
+		body["id"] = conflict.ID
+		body["version"] = conflict.Version
+		body["tags"] = conflict.Tags
+		body["conflicts"] = conflict.Conflicts
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(kind.Status())
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,125 @@
+// apperr/apperr_test.go
+package apperr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"osmkit/tags"
+	"testing"
+)
+
+func TestFromStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   Kind
+	}{
+		{http.StatusUnauthorized, NotAuthenticated},
+		{http.StatusForbidden, NotAuthenticated},
+		{http.StatusConflict, Conflict},
+		{http.StatusNotFound, Gone},
+		{http.StatusGone, Gone},
+		{http.StatusTooManyRequests, RateLimited},
+		{http.StatusBadRequest, Validation},
+		{http.StatusPreconditionFailed, Validation},
+		{http.StatusInternalServerError, UpstreamUnavailable},
+		{http.StatusGatewayTimeout, UpstreamUnavailable},
+	}
+	for _, tt := range tests {
+		if got := FromStatus(tt.status, "", "failed").Kind; got != tt.want {
+			t.Errorf("FromStatus(%d) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		kind    Kind
+		message string
+	}{
+		{
+			name:    "validation",
+			err:     New(Validation, "Invalid bounding box"),
+			status:  http.StatusBadRequest,
+			kind:    Validation,
+			message: "Invalid bounding box",
+		},
+		{
+			name:    "wrapped",
+			err:     fmt.Errorf("failed to update way: %w", New(Gone, "way 100 was deleted")),
+			status:  http.StatusGone,
+			kind:    Gone,
+			message: "failed to update way: way 100 was deleted",
+		},
+		{
+			name:    "internal",
+			err:     errors.New("open /srv/snapshots/nodes.json: permission denied"),
+			status:  http.StatusInternalServerError,
+			kind:    Internal,
+			message: internalMessage,
+		},
+		{
+			name:    "conflict",
+			err:     &tags.ConflictError{Type: "way", ID: 100, Version: 3, Conflicts: []tags.Conflict{{Key: "name"}}},
+			status:  http.StatusConflict,
+			kind:    Conflict,
+			message: "way 100 was changed by someone else (now version 3), conflicting keys: name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Write(rec, httptest.NewRequest("GET", "/data", nil), tt.err)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			var body struct {
+				Error   Kind   `json:"error"`
+				Message string `json:"message"`
+				Version int    `json:"version"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != tt.kind || body.Message != tt.message {
+				t.Errorf("got %s %q, want %s %q", body.Error, body.Message, tt.kind, tt.message)
+			}
+			if tt.kind == Conflict && body.Version != 3 {
+				t.Errorf("version = %d, want the conflict fields", body.Version)
+			}
+		})
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	gone := New(Gone, "way 100 was deleted")
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{"typed", gone, Gone},
+		{"wrapped", fmt.Errorf("failed to update way: %w", gone), Gone},
+		{"wrapping a cause", Wrap(UpstreamUnavailable, errors.New("dial tcp: timeout"), "Overpass is unavailable"), UpstreamUnavailable},
+		{"edit conflict", fmt.Errorf("save: %w", &tags.ConflictError{Type: "way", ID: 100}), Conflict},
+		{"untyped", errors.New("boom"), Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.want {
+				t.Errorf("KindOf = %s, want %s", got, tt.want)
+			}
+			if !Is(tt.err, tt.want) {
+				t.Errorf("Is(%s) = false", tt.want)
+			}
+		})
+	}
+	if Is(nil, Internal) {
+		t.Error("a nil error is of kind internal")
+	}
+}
@@ -0,0 +1,169 @@
+// changeset/changeset.go
+package changeset
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultIdleTimeout is kept below the one hour after which the OSM API
+	// closes an idle changeset, so we never hand out one that is about to close.
+	DefaultIdleTimeout = 55 * time.Minute
+	// DefaultMaxElements is the OSM API limit of changes per changeset.
+	DefaultMaxElements = 10000
+)
+
+// Changeset is the state we track for a changeset opened on behalf of a user.
+type Changeset struct {
+	ID       int64
+	UserID   int64
+	OpenedAt time.Time
+	LastUsed time.Time
+	Elements int
+}
+
+// Manager hands out one open changeset per OSM user. It is safe for concurrent
+// use; requests of different users never wait on each other.
+type Manager struct {
+	IdleTimeout time.Duration
+	MaxElements int
+	Now         func() time.Time
+
+	mu    sync.Mutex
+	users map[int64]*userState
+}
+
+type userState struct {
+	mu        sync.Mutex
+	changeset *Changeset
+}
+
+// NewManager returns a Manager using the OSM API limits.
+func NewManager() *Manager {
+	return &Manager{
+		IdleTimeout: DefaultIdleTimeout,
+		MaxElements: DefaultMaxElements,
+		Now:         time.Now,
+		users:       make(map[int64]*userState),
+	}
+}
+
+func (m *Manager) user(userID int64) *userState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		u = &userState{}
+		m.users[userID] = u
+	}
+	return u
+}
+
+// usable reports whether cs can still take n more elements. Callers must hold the user's lock.
+func (m *Manager) usable(cs *Changeset, n int) bool {
+	if cs == nil {
+		return false
+	}
+	if m.Now().Sub(cs.LastUsed) >= m.IdleTimeout {
+		return false
+	}
+	return cs.Elements+n <= m.MaxElements
+}
+
+// Get returns the user's open changeset, calling open to create a new one when
+// the user has none, it has been idle too long or it is full. Concurrent calls
+// for the same user share a single open call.
+func (m *Manager) Get(userID int64, open func() (int64, error)) (int64, error) {
+	return m.Reserve(userID, 1, open)
+}
+
+// Reserve is like Get but makes sure the changeset still has room for n elements.
+func (m *Manager) Reserve(userID int64, n int, open func() (int64, error)) (int64, error) {
+	u := m.user(userID)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if m.usable(u.changeset, n) {
+		return u.changeset.ID, nil
+	}
+
+	id, err := open()
+	if err != nil {
+		return 0, err
+	}
+	now := m.Now()
+	u.changeset = &Changeset{ID: id, UserID: userID, OpenedAt: now, LastUsed: now}
+	return id, nil
+}
+
+// Used records that n elements were uploaded to the changeset.
+func (m *Manager) Used(userID, changesetID int64, n int) {
+	u := m.user(userID)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.changeset != nil && u.changeset.ID == changesetID {
+		u.changeset.Elements += n
+		u.changeset.LastUsed = m.Now()
+	}
+}
+
+// Forget drops the changeset if it is still the user's current one, for
+// example after the API reported it as closed.
+func (m *Manager) Forget(userID, changesetID int64) {
+	u := m.user(userID)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.changeset != nil && u.changeset.ID == changesetID {
+		u.changeset = nil
+	}
+}
+
+// Take removes and returns the user's current changeset so the caller can close
+// it. The boolean is false when there is none or it has already idled out.
+func (m *Manager) Take(userID int64) (Changeset, bool) {
+	u := m.user(userID)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.changeset == nil {
+		return Changeset{}, false
+	}
+	cs := *u.changeset
+	u.changeset = nil
+	return cs, m.Now().Sub(cs.LastUsed) < m.IdleTimeout
+}
+
+// Current returns a copy of the user's changeset and whether it is still open.
+func (m *Manager) Current(userID int64) (Changeset, bool) {
+	u := m.user(userID)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.changeset == nil {
+		return Changeset{}, false
+	}
+	return *u.changeset, m.usable(u.changeset, 0)
+}
+
+// Open returns every changeset that has not idled out yet.
+func (m *Manager) Open() []Changeset {
+	m.mu.Lock()
+	users := make([]*userState, 0, len(m.users))
+	for _, u := range m.users {
+		users = append(users, u)
+	}
+	m.mu.Unlock()
+
+	var open []Changeset
+	for _, u := range users {
+		u.mu.Lock()
+		if u.changeset != nil && m.Now().Sub(u.changeset.LastUsed) < m.IdleTimeout {
+			open = append(open, *u.changeset)
+		}
+		u.mu.Unlock()
+	}
+	return open
+}
@@ -0,0 +1,203 @@
+// changeset/changeset_test.go
+package changeset
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock is a time the tests move by hand.
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+// opener hands out changeset IDs and counts how often it was asked to.
+type opener struct {
+	mu    sync.Mutex
+	next  int64
+	calls int
+}
+
+func (o *opener) open() (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.calls++
+	o.next++
+	return o.next, nil
+}
+
+func newTestManager() (*Manager, *clock, *opener) {
+	c := &clock{now: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	m := NewManager()
+	m.Now = c.Now
+	return m, c, &opener{next: 100}
+}
+
+func TestReserveReuses(t *testing.T) {
+	m, c, o := newTestManager()
+
+	first, err := m.Reserve(1, 10, o.open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Used(1, first, 10)
+	c.now = c.now.Add(DefaultIdleTimeout - time.Second)
+	second, err := m.Get(1, o.open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first || o.calls != 1 {
+		t.Errorf("got changeset %d after %d opens, want %d reused", second, o.calls, first)
+	}
+	if cs, open := m.Current(1); !open || cs.Elements != 10 || !cs.LastUsed.Equal(c.now.Add(-DefaultIdleTimeout+time.Second)) {
+		t.Errorf("got %+v open %v, want 10 elements used at the first upload", cs, open)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		idle   time.Duration
+		reused bool
+	}{
+		{"fresh", 0, true},
+		{"just before the timeout", DefaultIdleTimeout - time.Second, true},
+		{"at the timeout", DefaultIdleTimeout, false},
+		{"long idle", 2 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, c, o := newTestManager()
+			first, _ := m.Get(1, o.open)
+			m.Used(1, first, 1)
+
+			c.now = c.now.Add(tt.idle)
+			if _, open := m.Current(1); open != tt.reused {
+				t.Errorf("Current open = %v, want %v", open, tt.reused)
+			}
+			if got := len(m.Open()); (got == 1) != tt.reused {
+				t.Errorf("Open returned %d changesets", got)
+			}
+			second, _ := m.Get(1, o.open)
+			if (second == first) != tt.reused {
+				t.Errorf("got changeset %d after %d, reused = %v, want %v", second, first, second == first, tt.reused)
+			}
+		})
+	}
+}
+
+func TestMaxElements(t *testing.T) {
+	m, _, o := newTestManager()
+	m.MaxElements = 100
+
+	first, _ := m.Reserve(1, 60, o.open)
+	m.Used(1, first, 60)
+	if id, _ := m.Reserve(1, 40, o.open); id != first {
+		t.Errorf("40 more elements fit in %d, got %d", first, id)
+	}
+	second, _ := m.Reserve(1, 41, o.open)
+	if second == first {
+		t.Fatalf("41 more elements were put in the changeset holding 60 of 100")
+	}
+	if cs, _ := m.Current(1); cs.ID != second || cs.Elements != 0 {
+		t.Errorf("got %+v, want the new empty changeset %d", cs, second)
+	}
+
+	// Uses of the replaced changeset are not counted against the new one
+	m.Used(1, first, 30)
+	if cs, _ := m.Current(1); cs.Elements != 0 {
+		t.Errorf("the old changeset's elements went to %+v", cs)
+	}
+}
+
+func TestForget(t *testing.T) {
+	m, _, o := newTestManager()
+	first, _ := m.Get(1, o.open)
+
+	m.Forget(1, first+1)
+	if id, _ := m.Get(1, o.open); id != first {
+		t.Errorf("Forget of another changeset dropped %d", first)
+	}
+	m.Forget(1, first)
+	if id, _ := m.Get(1, o.open); id == first {
+		t.Errorf("changeset %d was handed out after Forget", first)
+	}
+}
+
+func TestTake(t *testing.T) {
+	m, c, o := newTestManager()
+	if _, ok := m.Take(1); ok {
+		t.Error("Take returned a changeset for a user without one")
+	}
+
+	first, _ := m.Get(1, o.open)
+	cs, ok := m.Take(1)
+	if !ok || cs.ID != first || cs.UserID != 1 {
+		t.Errorf("got %+v %v, want changeset %d of user 1", cs, ok, first)
+	}
+	if _, ok := m.Current(1); ok {
+		t.Error("the changeset is still current after Take")
+	}
+
+	second, _ := m.Get(1, o.open)
+	c.now = c.now.Add(DefaultIdleTimeout)
+	if cs, ok := m.Take(1); ok || cs.ID != second {
+		t.Errorf("got %+v %v, want the idled out changeset %d not to be closed", cs, ok, second)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	m, _, o := newTestManager()
+	alice, _ := m.Get(1, o.open)
+	bob, _ := m.Get(2, o.open)
+	if alice == bob {
+		t.Fatalf("both users got changeset %d", alice)
+	}
+
+	m.Used(2, alice, 5)
+	m.Forget(2, alice)
+	if cs, ok := m.Current(1); !ok || cs.ID != alice || cs.Elements != 0 {
+		t.Errorf("user 2 changed user 1's changeset: %+v", cs)
+	}
+	if _, ok := m.Take(1); !ok {
+		t.Fatal("Take found no changeset for user 1")
+	}
+	if cs, ok := m.Current(2); !ok || cs.ID != bob {
+		t.Errorf("Take of user 1 dropped user 2's changeset: %+v", cs)
+	}
+}
+
+func TestOpenFails(t *testing.T) {
+	m, _, _ := newTestManager()
+	failed := errors.New("API down")
+	if _, err := m.Get(1, func() (int64, error) { return 0, failed }); err != failed {
+		t.Errorf("got %v, want the open error", err)
+	}
+	if _, ok := m.Current(1); ok {
+		t.Error("a failed open left a changeset behind")
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	m, _, o := newTestManager()
+	var wg sync.WaitGroup
+	ids := make([]int64, 20)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], _ = m.Get(1, o.open)
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Fatalf("concurrent calls got changesets %v", ids)
+		}
+	}
+	if o.calls != 1 {
+		t.Errorf("opened %d changesets, want 1", o.calls)
+	}
+}
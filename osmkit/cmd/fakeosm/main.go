@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"osmkit/fakeosm"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8089", "address to listen on")
+	fixtures := flag.String("fixture", "", "comma separated list of .osm or .json files to load")
+	flag.Parse()
+
+	server := fakeosm.New()
+	for _, path := range strings.Split(*fixtures, ",") {
+		if path == "" {
+			continue
+		}
+		if err := server.LoadFixtureFile(path); err != nil {
+			log.Fatalf("Error loading fixture: %v", err)
+		}
+		log.Printf("Loaded fixture %s", path)
+	}
+
+	base := "http://" + *addr
+	fmt.Printf("Fake OSM server starting on %s...\n", *addr)
+	fmt.Println("Point the maps at it with:")
+	fmt.Printf("  OSM_API_BASE=%s/api/0.6\n", base)
+	fmt.Printf("  OVERPASS_URL=%s/api/interpreter\n", base)
+	fmt.Printf("  AUTH_URL=%s/oauth2/authorize\n", base)
+	fmt.Printf("  TOKEN_URL=%s/oauth2/token\n", base)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		server.ServeHTTP(w, r)
+	})
+	if err := http.ListenAndServe(*addr, handler); err != nil {
+		log.Fatalf("Error starting server: %s", err)
+	}
+}
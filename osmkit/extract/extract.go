@@ -0,0 +1,237 @@
+// extract/extract.go
+package extract
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"osmkit/overpassql"
+	"runtime"
+	"strings"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"github.com/paulmach/osm/osmxml"
+)
+
+// Element is a node, or a way or relation reduced to the center of its
+// bounding box like Overpass' "out center" does.
+type Element struct {
+	Type    string
+	ID      int64
+	Version int
+	Lat     float64
+	Lon     float64
+	Tags    map[string]string
+}
+
+// Load reads an OSM extract, .osm.pbf or plain .osm XML, and returns the
+// elements matched by any of the selectors. Spatial filters of the selectors
+// are ignored, the extract is assumed to cover the area of interest.
+//
+// Ways and relations need the locations of their nodes, which come first in
+// the file, so it is read up to three times: relations, ways and then nodes,
+// each pass keeping only what the previous ones asked for.
+func Load(ctx context.Context, path string, selectors []overpassql.Selector) ([]Element, error) {
+	wantWays, wantRelations := false, false
+	for _, sel := range selectors {
+		wantWays = wantWays || sel.MatchType("way")
+		wantRelations = wantRelations || sel.MatchType("relation")
+	}
+	match := func(elemType string, tags osm.Tags) (map[string]string, bool) {
+		if len(tags) == 0 {
+			return nil, false
+		}
+		m := tags.Map()
+		for _, sel := range selectors {
+			if sel.MatchType(elemType) && sel.MatchTags(m) {
+				return m, true
+			}
+		}
+		return nil, false
+	}
+
+	var elements []Element
+	var relations []*osm.Relation
+	neededWays := map[osm.WayID]bool{}
+	if wantRelations {
+		err := scan(ctx, path, osm.TypeRelation, func(o osm.Object) bool {
+			_, ok := match("relation", o.(*osm.Relation).Tags)
+			return ok
+		}, func(o osm.Object) {
+			r := o.(*osm.Relation)
+			relations = append(relations, r)
+			for _, m := range r.Members {
+				if m.Type == osm.TypeWay {
+					neededWays[osm.WayID(m.Ref)] = true
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ways []*osm.Way
+	wayNodes := map[osm.WayID]osm.WayNodes{}
+	neededNodes := map[osm.NodeID]bool{}
+	if wantWays || len(neededWays) > 0 {
+		err := scan(ctx, path, osm.TypeWay, func(o osm.Object) bool {
+			w := o.(*osm.Way)
+			_, ok := match("way", w.Tags)
+			return ok || neededWays[w.ID]
+		}, func(o osm.Object) {
+			w := o.(*osm.Way)
+			if _, ok := match("way", w.Tags); ok {
+				ways = append(ways, w)
+			}
+			if neededWays[w.ID] {
+				wayNodes[w.ID] = w.Nodes
+			}
+			for _, n := range w.Nodes {
+				neededNodes[n.ID] = true
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range relations {
+		for _, m := range r.Members {
+			if m.Type == osm.TypeNode {
+				neededNodes[osm.NodeID(m.Ref)] = true
+			}
+		}
+	}
+
+	locations := map[osm.NodeID][2]float64{}
+	err := scan(ctx, path, osm.TypeNode, func(o osm.Object) bool {
+		n := o.(*osm.Node)
+		if neededNodes[n.ID] {
+			return true
+		}
+		_, ok := match("node", n.Tags)
+		return ok
+	}, func(o osm.Object) {
+		n := o.(*osm.Node)
+		if neededNodes[n.ID] {
+			locations[n.ID] = [2]float64{n.Lat, n.Lon}
+		}
+		if tags, ok := match("node", n.Tags); ok {
+			elements = append(elements, Element{Type: "node", ID: int64(n.ID), Version: n.Version, Lat: n.Lat, Lon: n.Lon, Tags: tags})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range ways {
+		var b bounds
+		for _, n := range w.Nodes {
+			b.add(locations, n.ID)
+		}
+		if lat, lon, ok := b.center(); ok {
+			tags, _ := match("way", w.Tags)
+			elements = append(elements, Element{Type: "way", ID: int64(w.ID), Version: w.Version, Lat: lat, Lon: lon, Tags: tags})
+		}
+	}
+	for _, r := range relations {
+		var b bounds
+		for _, m := range r.Members {
+			switch m.Type {
+			case osm.TypeNode:
+				b.add(locations, osm.NodeID(m.Ref))
+			case osm.TypeWay:
+				for _, n := range wayNodes[osm.WayID(m.Ref)] {
+					b.add(locations, n.ID)
+				}
+			}
+		}
+		if lat, lon, ok := b.center(); ok {
+			tags, _ := match("relation", r.Tags)
+			elements = append(elements, Element{Type: "relation", ID: int64(r.ID), Version: r.Version, Lat: lat, Lon: lon, Tags: tags})
+		}
+	}
+	return elements, nil
+}
+
+// scan calls fn for every element of the given type for which keep is true.
+// keep runs on the decoding goroutines of PBF files and must not modify
+// anything.
+func scan(ctx context.Context, path string, elemType osm.Type, keep func(osm.Object) bool, fn func(osm.Object)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var scanner osm.Scanner
+	if strings.HasSuffix(path, ".pbf") {
+		s := osmpbf.New(ctx, f, runtime.GOMAXPROCS(0))
+		s.SkipNodes = elemType != osm.TypeNode
+		s.SkipWays = elemType != osm.TypeWay
+		s.SkipRelations = elemType != osm.TypeRelation
+		s.FilterNode = func(n *osm.Node) bool { return keep(n) }
+		s.FilterWay = func(w *osm.Way) bool { return keep(w) }
+		s.FilterRelation = func(r *osm.Relation) bool { return keep(r) }
+		scanner = s
+	} else {
+		scanner = &filtered{Scanner: osmxml.New(ctx, f), elemType: elemType, keep: keep}
+	}
+	defer scanner.Close()
+
+	for scanner.Scan() {
+		fn(scanner.Object())
+	}
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return nil
+}
+
+// filtered applies the element type and keep function to a scanner that
+// can't skip elements itself.
+type filtered struct {
+	osm.Scanner
+	elemType osm.Type
+	keep     func(osm.Object) bool
+}
+
+func (s *filtered) Scan() bool {
+	for s.Scanner.Scan() {
+		o := s.Scanner.Object()
+		if o.ObjectID().Type() == s.elemType && s.keep(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// bounds is the bounding box of the located nodes added to it.
+type bounds struct {
+	south, west, north, east float64
+	n                        int
+}
+
+func (b *bounds) add(locations map[osm.NodeID][2]float64, id osm.NodeID) {
+	p, ok := locations[id]
+	if !ok {
+		return
+	}
+	lat, lon := p[0], p[1]
+	if b.n == 0 {
+		b.south, b.north, b.west, b.east = lat, lat, lon, lon
+	} else {
+		b.south, b.north = min(b.south, lat), max(b.north, lat)
+		b.west, b.east = min(b.west, lon), max(b.east, lon)
+	}
+	b.n++
+}
+
+func (b *bounds) center() (lat, lon float64, ok bool) {
+	if b.n == 0 {
+		return 0, 0, false
+	}
+	return (b.south + b.north) / 2, (b.west + b.east) / 2, true
+}
@@ -0,0 +1,100 @@
+// extract/extract_test.go
+package extract
+
+import (
+	"context"
+	"math"
+	"osmkit/overpassql"
+	"strconv"
+	"testing"
+)
+
+const sample = "testdata/sample.osm"
+
+func load(t *testing.T, query string) map[string]Element {
+	t.Helper()
+	q, err := overpassql.Parse(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elements, err := Load(context.Background(), sample, q.Selectors())
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKey := map[string]Element{}
+	for _, e := range elements {
+		byKey[e.Type+"/"+strconv.FormatInt(e.ID, 10)] = e
+	}
+	return byKey
+}
+
+func TestLoad(t *testing.T) {
+	got := load(t, `[out:json];nwr["amenity"="toilets"];out center;`)
+
+	tests := []struct {
+		key      string
+		version  int
+		lat, lon float64
+	}{
+		{"node/1", 2, 44.43, 26.10},
+		{"node/2", 1, 44.431, 26.101},
+		{"way/100", 3, 44.41, 26.02},      // center of the closed way
+		{"relation/200", 4, 44.52, 26.23}, // center of its way and node
+	}
+	for _, tt := range tests {
+		e, ok := got[tt.key]
+		if !ok {
+			t.Errorf("%s is missing", tt.key)
+			continue
+		}
+		if e.Version != tt.version || math.Abs(e.Lat-tt.lat) > 1e-9 || math.Abs(e.Lon-tt.lon) > 1e-9 {
+			t.Errorf("%s = version %d at %v,%v, want version %d at %v,%v", tt.key, e.Version, e.Lat, e.Lon, tt.version, tt.lat, tt.lon)
+		}
+		if e.Tags["amenity"] != "toilets" {
+			t.Errorf("%s has tags %v", tt.key, e.Tags)
+		}
+	}
+	// The bench, the untagged nodes and ways, the road and the relation
+	// without any located member are left out
+	if len(got) != len(tests) {
+		t.Errorf("got %d elements, want %d: %v", len(got), len(tests), got)
+	}
+}
+
+func TestLoadTagFilters(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"nodes only", `[out:json];node["amenity"="toilets"];out;`, []string{"node/1", "node/2"}},
+		{"value excluded", `[out:json];node["amenity"="toilets"]["fee"!="yes"];out;`, []string{"node/1"}},
+		{"regular expression", `[out:json];node["amenity"~"^(bench|fountain)$"];out;`, []string{"node/3"}},
+		{"ways only", `[out:json];way["building"];out center;`, []string{"way/100"}},
+		{"union", `[out:json];(node["amenity"="bench"];way["highway"];);out center;`, []string{"node/3", "way/101"}},
+		{"nothing", `[out:json];node["amenity"="fuel"];out;`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := load(t, tt.query)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %d elements %v, want %v", len(got), got, tt.want)
+			}
+			for _, key := range tt.want {
+				if _, ok := got[key]; !ok {
+					t.Errorf("%s is missing from %v", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	q, err := overpassql.Parse(`[out:json];node["amenity"="toilets"];out;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(context.Background(), "testdata/missing.osm", q.Selectors()); err == nil {
+		t.Error("got no error for a missing extract")
+	}
+}
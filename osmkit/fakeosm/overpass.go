@@ -0,0 +1,281 @@
+// fakeosm/overpass.go
+package fakeosm
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"osmkit/overpassql"
+	"strings"
+)
+
+// Output verbosity levels of the out statement.
+const (
+	outIDs = iota
+	outSkel
+	outBody
+	outTags
+	outMeta
+)
+
+type outMode struct {
+	level  int
+	geom   bool
+	center bool
+}
+
+func parseOut(fields []string) outMode {
+	mode := outMode{level: outBody}
+	for _, f := range fields {
+		switch f {
+		case "ids":
+			mode.level = outIDs
+		case "skel":
+			mode.level = outSkel
+		case "body":
+			mode.level = outBody
+		case "tags":
+			mode.level = outTags
+		case "meta":
+			mode.level = outMeta
+		case "geom":
+			mode.geom = true
+		case "center":
+			mode.center = true
+		}
+	}
+	return mode
+}
+
+// handleInterpreter answers Overpass queries against the elements held by the
+// server. Areas are not modelled: an area filter matches every element, so a
+// fixture is expected to contain only data inside the areas its queries use.
+func (s *Server) handleInterpreter(w http.ResponseWriter, r *http.Request) {
+	query, err := readQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q, err := overpassql.Parse(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if out := q.Settings["out"]; out != "json" {
+		http.Error(w, "fakeosm only supports [out:json]", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	elements := s.evaluate(q)
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"version":   0.6,
+		"generator": "fakeosm",
+		"elements":  elements,
+	})
+}
+
+// handleStatus answers like the /api/status page of an Overpass instance
+// without a rate limit.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "Connected as: 0\nCurrent time: %s\nRate limit: 0\nCurrently running queries (pid, space limit, time limit, start time):\n",
+		s.Now().UTC().Format("2006-01-02T15:04:05Z"))
+}
+
+func readQuery(r *http.Request) (string, error) {
+	if r.Method == http.MethodGet {
+		return r.URL.Query().Get("data"), nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	query := string(body)
+	if strings.HasPrefix(query, "data=") {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return "", err
+		}
+		query = values.Get("data")
+	}
+	return query, nil
+}
+
+// evaluate runs the statements of q in order. Callers must hold s.mu.
+func (s *Server) evaluate(q *overpassql.Query) []map[string]interface{} {
+	all := s.visible()
+	sets := map[string][]*Element{}
+	areas := map[string]bool{}
+	output := []map[string]interface{}{}
+
+	store := func(into string, result []*Element) {
+		if into == "" {
+			into = "_"
+		}
+		sets[into] = result
+	}
+
+	for _, st := range q.Statements {
+		switch st.Kind {
+		case overpassql.Select:
+			if st.Selector.Type == "area" {
+				name := st.Into
+				if name == "" {
+					name = "_"
+				}
+				areas[name] = true
+				continue
+			}
+			store(st.Into, s.selectElements(all, *st.Selector, areas))
+		case overpassql.Union:
+			seen := map[string]bool{}
+			var result []*Element
+			for _, sel := range st.Union {
+				for _, e := range s.selectElements(all, sel, areas) {
+					if !seen[e.key()] {
+						seen[e.key()] = true
+						result = append(result, e)
+					}
+				}
+			}
+			store(st.Into, result)
+		case overpassql.Recurse:
+			store(st.Into, s.recurse(all, sets["_"], st.Recurse))
+		case overpassql.Out:
+			mode := parseOut(st.Out)
+			for _, e := range sets["_"] {
+				output = append(output, s.render(e, mode))
+			}
+		}
+	}
+	return output
+}
+
+func (s *Server) selectElements(all []*Element, sel overpassql.Selector, areas map[string]bool) []*Element {
+	if sel.Area != "" && !areas[sel.Area] {
+		return nil
+	}
+	var result []*Element
+	for _, e := range all {
+		if !sel.MatchType(e.Type) || !sel.MatchTags(e.Tags) {
+			continue
+		}
+		if sel.BBox != nil && !s.inBBox(e, *sel.BBox) {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+func (s *Server) inBBox(e *Element, bbox overpassql.BBox) bool {
+	switch e.Type {
+	case "node":
+		return bbox.Contains(e.Lat, e.Lon)
+	case "way":
+		for _, ref := range e.Nodes {
+			if n := s.current("node", ref); n != nil && bbox.Contains(n.Lat, n.Lon) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recurse implements > (nodes of the ways in the set) and < (ways using the nodes in the set).
+func (s *Server) recurse(all []*Element, input []*Element, op string) []*Element {
+	var result []*Element
+	seen := map[string]bool{}
+	add := func(e *Element) {
+		if e != nil && e.Visible && !seen[e.key()] {
+			seen[e.key()] = true
+			result = append(result, e)
+		}
+	}
+
+	if strings.HasPrefix(op, ">") {
+		for _, e := range input {
+			for _, ref := range e.Nodes {
+				add(s.current("node", ref))
+			}
+		}
+		return result
+	}
+
+	nodes := map[int64]bool{}
+	for _, e := range input {
+		if e.Type == "node" {
+			nodes[e.ID] = true
+		}
+	}
+	for _, e := range all {
+		for _, ref := range e.Nodes {
+			if nodes[ref] {
+				add(e)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (s *Server) render(e *Element, mode outMode) map[string]interface{} {
+	out := renderJSON(e, mode.level)
+	if e.Type == "way" && (mode.geom || mode.center) {
+		geometry := make([]map[string]float64, 0, len(e.Nodes))
+		var sumLat, sumLon float64
+		for _, ref := range e.Nodes {
+			if n := s.current("node", ref); n != nil {
+				geometry = append(geometry, map[string]float64{"lat": n.Lat, "lon": n.Lon})
+				sumLat += n.Lat
+				sumLon += n.Lon
+			}
+		}
+		if mode.geom {
+			out["geometry"] = geometry
+		}
+		if mode.center && len(geometry) > 0 {
+			out["center"] = map[string]float64{"lat": sumLat / float64(len(geometry)), "lon": sumLon / float64(len(geometry))}
+		}
+	}
+	return out
+}
+
+// renderJSON renders an element in the JSON shape shared by Overpass and the API.
+func renderJSON(e *Element, level int) map[string]interface{} {
+	out := map[string]interface{}{
+		"type": e.Type,
+		"id":   e.ID,
+	}
+	if level == outIDs {
+		return out
+	}
+	if level != outTags {
+		if e.Type == "node" {
+			out["lat"] = e.Lat
+			out["lon"] = e.Lon
+		}
+		if e.Type == "way" {
+			out["nodes"] = e.Nodes
+		}
+	}
+	if level >= outBody && len(e.Tags) > 0 {
+		out["tags"] = e.Tags
+	}
+	if level == outMeta {
+		out["version"] = e.Version
+		out["changeset"] = e.Changeset
+		if !e.Timestamp.IsZero() {
+			out["timestamp"] = e.Timestamp.UTC().Format("2006-01-02T15:04:05Z")
+		}
+		if e.UID != 0 {
+			out["uid"] = e.UID
+			out["user"] = e.User
+		}
+	}
+	return out
+}
@@ -0,0 +1,544 @@
+// fakeosm/server.go
+package fakeosm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"osmkit/osmxml"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an in-memory implementation of the part of the OSM API v0.6, the
+// OAuth 2 endpoints and the Overpass interpreter that the maps talk to.
+type Server struct {
+	// Now returns the current time; tests can replace it to age changesets.
+	Now func() time.Time
+	// IdleTimeout is how long a changeset stays open without edits.
+	IdleTimeout time.Duration
+	// MaxChangesetElements is the number of changes after which a changeset is closed.
+	MaxChangesetElements int
+
+	mu              sync.Mutex
+	elements        map[string][]*Element
+	changesets      map[int64]*changeset
+	users           map[string]*user
+	codes           map[string]string
+	nextNodeID      int64
+	nextWayID       int64
+	nextChangesetID int64
+	nextUID         int64
+
+	mux *http.ServeMux
+}
+
+// New returns an empty server with the same limits as api.openstreetmap.org.
+func New() *Server {
+	s := &Server{
+		Now:                  time.Now,
+		IdleTimeout:          time.Hour,
+		MaxChangesetElements: 10000,
+		elements:             make(map[string][]*Element),
+		changesets:           make(map[int64]*changeset),
+		users:                make(map[string]*user),
+		codes:                make(map[string]string),
+		nextNodeID:           1_000_000_000_000,
+		nextWayID:            1_000_000_000_000,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /api/0.6/changeset/create", s.handleChangesetCreate)
+	mux.HandleFunc("GET /api/0.6/changeset/{id}", s.handleChangesetRead)
+	mux.HandleFunc("PUT /api/0.6/changeset/{id}/close", s.handleChangesetClose)
+	mux.HandleFunc("POST /api/0.6/changeset/{id}/upload", s.handleUpload)
+	for _, elemType := range []string{"node", "way"} {
+		elemType := elemType
+		mux.HandleFunc("PUT /api/0.6/"+elemType+"/create", func(w http.ResponseWriter, r *http.Request) {
+			s.handleElementCreate(w, r, elemType)
+		})
+		mux.HandleFunc("GET /api/0.6/"+elemType+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+			s.handleElementRead(w, r, elemType)
+		})
+		mux.HandleFunc("PUT /api/0.6/"+elemType+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+			s.handleElementUpdate(w, r, elemType)
+		})
+		mux.HandleFunc("GET /api/0.6/"+elemType+"/{id}/{version}", func(w http.ResponseWriter, r *http.Request) {
+			s.handleElementVersion(w, r, elemType)
+		})
+		for _, path := range []string{elemType + "s", elemType + "s.json"} {
+			mux.HandleFunc("GET /api/0.6/"+path, func(w http.ResponseWriter, r *http.Request) {
+				s.handleElementsRead(w, r, elemType)
+			})
+		}
+	}
+	mux.HandleFunc("GET /api/0.6/user/details.json", s.handleUserDetails)
+	mux.HandleFunc("GET /api/0.6/capabilities", s.handleCapabilities)
+	mux.HandleFunc("/api/interpreter", s.handleInterpreter)
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /oauth2/authorize", s.handleAuthorize)
+	mux.HandleFunc("POST /oauth2/token", s.handleToken)
+	s.mux = mux
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		http.Error(w, apiErr.Message, apiErr.Status)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeXML(w http.ResponseWriter, doc *osmxml.OSM) {
+	doc.Version = "0.6"
+	doc.Generator = "fakeosm"
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(doc); err != nil {
+		log.Printf("fakeosm: failed to encode response: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("fakeosm: failed to encode response: %v", err)
+	}
+}
+
+func writeText(w http.ResponseWriter, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, format, args...)
+}
+
+// authenticate returns the user for the bearer token of the request. Callers must hold s.mu.
+func (s *Server) authenticate(r *http.Request) (*user, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, errorf(http.StatusUnauthorized, "Couldn't authenticate you")
+	}
+	return s.userForToken(token), nil
+}
+
+// pathID parses the {id} wildcard, stripping an optional .json suffix.
+func pathID(r *http.Request) (int64, bool, error) {
+	raw := r.PathValue("id")
+	raw, isJSON := strings.CutSuffix(raw, ".json")
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false, errorf(http.StatusBadRequest, "Invalid id %q", r.PathValue("id"))
+	}
+	return id, isJSON, nil
+}
+
+func readDocument(r *http.Request) (*osmxml.OSM, error) {
+	doc, err := osmxml.Decode(r.Body)
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "Cannot parse valid %s from xml string: %v", "osm", err)
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, errorf(http.StatusBadRequest, "%v", err)
+	}
+	return doc, nil
+}
+
+func (s *Server) handleChangesetCreate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	doc, err := readDocument(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(doc.Changesets) != 1 {
+		writeError(w, errorf(http.StatusBadRequest, "Cannot parse valid changeset from xml string"))
+		return
+	}
+
+	cs := s.createChangeset(u, doc.Changesets[0].Tags.Map())
+	writeText(w, "%d", cs.ID)
+}
+
+func (s *Server) handleChangesetRead(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, isJSON, err := pathID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	cs, ok := s.changesets[id]
+	if !ok {
+		writeError(w, errorf(http.StatusNotFound, "Changeset %d not found", id))
+		return
+	}
+	s.expire(cs)
+
+	out := osmxml.Changeset{
+		ID:           cs.ID,
+		User:         cs.User,
+		UID:          cs.UID,
+		CreatedAt:    cs.CreatedAt.UTC().Format(time.RFC3339),
+		Open:         strconv.FormatBool(cs.Open),
+		ChangesCount: cs.Changes,
+		Tags:         osmxml.TagsFromMap(cs.Tags),
+	}
+	if !cs.Open {
+		out.ClosedAt = cs.ClosedAt.UTC().Format(time.RFC3339)
+	}
+
+	if isJSON {
+		writeJSON(w, map[string]interface{}{
+			"version": "0.6",
+			"changeset": map[string]interface{}{
+				"id":            out.ID,
+				"created_at":    out.CreatedAt,
+				"closed_at":     out.ClosedAt,
+				"open":          cs.Open,
+				"user":          out.User,
+				"uid":           out.UID,
+				"changes_count": out.ChangesCount,
+				"tags":          cs.Tags,
+			},
+		})
+		return
+	}
+	writeXML(w, &osmxml.OSM{Changesets: []osmxml.Changeset{out}})
+}
+
+func (s *Server) handleChangesetClose(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id, _, err := pathID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	cs, err := s.openChangeset(u, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.close(cs, s.Now())
+}
+
+func (s *Server) handleElementCreate(w http.ResponseWriter, r *http.Request, elemType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	doc, err := readDocument(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	e, err := fromDocument(doc, elemType)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	cs, err := s.openChangeset(u, e.Changeset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	created, err := s.create(u, cs, *e)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeText(w, "%d", created.ID)
+}
+
+func (s *Server) handleElementUpdate(w http.ResponseWriter, r *http.Request, elemType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id, _, err := pathID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	doc, err := readDocument(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	e, err := fromDocument(doc, elemType)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if e.ID != id {
+		writeError(w, errorf(http.StatusBadRequest, "The id in the url (%d) is not the same as provided in the xml (%d)", id, e.ID))
+		return
+	}
+	cs, err := s.openChangeset(u, e.Changeset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	updated, err := s.modify(u, cs, *e)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeText(w, "%d", updated.Version)
+}
+
+func (s *Server) handleElementRead(w http.ResponseWriter, r *http.Request, elemType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, isJSON, err := pathID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	e := s.current(elemType, id)
+	if e == nil {
+		writeError(w, errorf(http.StatusNotFound, "Not found"))
+		return
+	}
+	if !e.Visible {
+		writeError(w, errorf(http.StatusGone, ""))
+		return
+	}
+
+	writeElement(w, e, isJSON)
+}
+
+// handleElementsRead serves the elements listed in ?nodes= or ?ways=, all of
+// them or a 404 when one is missing, like the multi fetch of the API.
+func (s *Server) handleElementsRead(w http.ResponseWriter, r *http.Request, elemType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	param := r.URL.Query().Get(elemType + "s")
+	if param == "" {
+		writeError(w, errorf(http.StatusBadRequest, "The parameter %ss is required", elemType))
+		return
+	}
+	var elements []*Element
+	for _, raw := range strings.Split(param, ",") {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			writeError(w, errorf(http.StatusBadRequest, "Invalid id %q", raw))
+			return
+		}
+		e := s.current(elemType, id)
+		if e == nil {
+			writeError(w, errorf(http.StatusNotFound, "Not found"))
+			return
+		}
+		elements = append(elements, e)
+	}
+
+	if strings.HasSuffix(r.URL.Path, ".json") {
+		rendered := make([]map[string]interface{}, 0, len(elements))
+		for _, e := range elements {
+			rendered = append(rendered, renderJSON(e, outMeta))
+		}
+		writeJSON(w, map[string]interface{}{"version": "0.6", "generator": "fakeosm", "elements": rendered})
+		return
+	}
+	doc := &osmxml.OSM{}
+	for _, e := range elements {
+		one := toDocument(e)
+		doc.Nodes = append(doc.Nodes, one.Nodes...)
+		doc.Ways = append(doc.Ways, one.Ways...)
+	}
+	writeXML(w, doc)
+}
+
+// handleElementVersion serves one version from the history of an element.
+func (s *Server) handleElementVersion(w http.ResponseWriter, r *http.Request, elemType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, _, err := pathID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	raw, isJSON := strings.CutSuffix(r.PathValue("version"), ".json")
+	version, err := strconv.Atoi(raw)
+	if err != nil || version <= 0 {
+		writeError(w, errorf(http.StatusBadRequest, "Invalid version %q", r.PathValue("version")))
+		return
+	}
+	e := s.version(elemType, id, version)
+	if e == nil {
+		writeError(w, errorf(http.StatusNotFound, "Not found"))
+		return
+	}
+	writeElement(w, e, isJSON)
+}
+
+func writeElement(w http.ResponseWriter, e *Element, isJSON bool) {
+	if isJSON {
+		writeJSON(w, map[string]interface{}{
+			"version":   "0.6",
+			"generator": "fakeosm",
+			"elements":  []map[string]interface{}{renderJSON(e, outMeta)},
+		})
+		return
+	}
+	writeXML(w, toDocument(e))
+}
+
+// handleCapabilities answers like /api/0.6/capabilities, which clients use to
+// check that the API is up.
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	fmt.Fprintf(w, `<osm version="0.6" generator="fakeosm"><api><version minimum="0.6" maximum="0.6"/>`+
+		`<changesets maximum_elements="%d"/><status database="online" api="online"/></api></osm>`, s.MaxChangesetElements)
+}
+
+func (s *Server) handleUserDetails(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	count := 0
+	for _, cs := range s.changesets {
+		if cs.UID == u.ID {
+			count++
+		}
+	}
+	writeJSON(w, map[string]interface{}{
+		"version": "0.6",
+		"user": map[string]interface{}{
+			"id":           u.ID,
+			"display_name": u.Name,
+			"changesets":   map[string]int{"count": count},
+		},
+	})
+}
+
+// handleAuthorize skips the consent screen and sends the browser straight
+// back to the application with a fresh code. Every login gets a new user.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	redirectURI := r.URL.Query().Get("redirect_uri")
+	target, err := url.Parse(redirectURI)
+	if err != nil || redirectURI == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	code := randomString()
+	token := randomString()
+	s.codes[code] = token
+	s.userForToken(token)
+	s.mu.Unlock()
+
+	q := target.Query()
+	q.Set("code", code)
+	q.Set("state", r.URL.Query().Get("state"))
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := r.FormValue("code")
+	token, ok := s.codes[code]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	delete(s.codes, code)
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"scope":        "read_prefs write_prefs write_api",
+		"created_at":   s.Now().Unix(),
+	})
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// fromDocument extracts the single element of elemType from a request body.
+func fromDocument(doc *osmxml.OSM, elemType string) (*Element, error) {
+	switch {
+	case elemType == "node" && len(doc.Nodes) == 1:
+		n := doc.Nodes[0]
+		return &Element{Type: "node", ID: n.ID, Version: n.Version, Changeset: n.Changeset, Lat: n.Lat, Lon: n.Lon, Tags: n.Tags.Map()}, nil
+	case elemType == "way" && len(doc.Ways) == 1:
+		wy := doc.Ways[0]
+		nodes := make([]int64, 0, len(wy.Nds))
+		for _, nd := range wy.Nds {
+			nodes = append(nodes, nd.Ref)
+		}
+		return &Element{Type: "way", ID: wy.ID, Version: wy.Version, Changeset: wy.Changeset, Nodes: nodes, Tags: wy.Tags.Map()}, nil
+	}
+	return nil, errorf(http.StatusBadRequest, "Cannot parse valid %s from xml string", elemType)
+}
+
+// toDocument renders an element the way GET /api/0.6/{type}/{id} does.
+func toDocument(e *Element) *osmxml.OSM {
+	doc := &osmxml.OSM{}
+	switch e.Type {
+	case "node":
+		doc.Nodes = []osmxml.Node{{ID: e.ID, Version: e.Version, Changeset: e.Changeset, Lat: e.Lat, Lon: e.Lon, Tags: osmxml.TagsFromMap(e.Tags)}}
+	case "way":
+		nds := make([]osmxml.Nd, 0, len(e.Nodes))
+		for _, ref := range e.Nodes {
+			nds = append(nds, osmxml.Nd{Ref: ref})
+		}
+		doc.Ways = []osmxml.Way{{ID: e.ID, Version: e.Version, Changeset: e.Changeset, Nds: nds, Tags: osmxml.TagsFromMap(e.Tags)}}
+	}
+	return doc
+}
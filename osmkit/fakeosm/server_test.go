@@ -0,0 +1,231 @@
+// fakeosm/server_test.go
+package fakeosm
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fixture = `<?xml version="1.0" encoding="UTF-8"?>
+<osm version="0.6">
+ <node id="1" version="1" lat="44.43" lon="26.10"/>
+ <node id="2" version="1" lat="44.44" lon="26.11"/>
+ <way id="100" version="3">
+  <nd ref="1"/>
+  <nd ref="2"/>
+  <tag k="highway" v="residential"/>
+ </way>
+</osm>`
+
+const changesetBody = `<osm><changeset><tag k="created_by" v="fakeosm test"/></changeset></osm>`
+
+// client talks to a fake server as one user.
+type client struct {
+	t      *testing.T
+	server *httptest.Server
+	token  string
+}
+
+func newTestServer(t *testing.T) (*Server, *client) {
+	s := New()
+	if err := s.LoadFixture(strings.NewReader(fixture)); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, &client{t: t, server: server, token: "alice"}
+}
+
+// do sends a request and returns the status and body of the response.
+func (c *client) do(method, path, body string) (int, string) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func (c *client) openChangeset() string {
+	c.t.Helper()
+	status, id := c.do("PUT", "/api/0.6/changeset/create", changesetBody)
+	if status != http.StatusOK {
+		c.t.Fatalf("creating a changeset: %d %s", status, id)
+	}
+	return id
+}
+
+func wayBody(changeset string, version int) string {
+	return `<osm><way id="100" version="` + strconv.Itoa(version) + `" changeset="` + changeset + `">` +
+		`<nd ref="1"/><nd ref="2"/><tag k="highway" v="residential"/><tag k="zoning_code" v="R1"/></way></osm>`
+}
+
+func TestUpdateVersions(t *testing.T) {
+	_, c := newTestServer(t)
+	cs := c.openChangeset()
+
+	status, body := c.do("PUT", "/api/0.6/way/100", wayBody(cs, 3))
+	if status != http.StatusOK || body != "4" {
+		t.Fatalf("first update: %d %s, want version 4", status, body)
+	}
+	status, body = c.do("PUT", "/api/0.6/way/100", wayBody(cs, 3))
+	if status != http.StatusConflict || !strings.Contains(body, "Provided 3, server had: 4") {
+		t.Errorf("update of a stale version: %d %s, want a version mismatch", status, body)
+	}
+	status, body = c.do("PUT", "/api/0.6/way/100", wayBody(cs, 4))
+	if status != http.StatusOK || body != "5" {
+		t.Errorf("update of the latest version: %d %s, want version 5", status, body)
+	}
+
+	status, body = c.do("GET", "/api/0.6/way/100", "")
+	if status != http.StatusOK || !strings.Contains(body, `version="5"`) || !strings.Contains(body, `changeset="`+cs+`"`) {
+		t.Errorf("read back %d %s, want version 5 in changeset %s", status, body, cs)
+	}
+}
+
+func TestCreateNode(t *testing.T) {
+	_, c := newTestServer(t)
+	cs := c.openChangeset()
+
+	status, id := c.do("PUT", "/api/0.6/node/create", `<osm><node changeset="`+cs+`" lat="44.45" lon="26.12"><tag k="amenity" v="toilets"/></node></osm>`)
+	if status != http.StatusOK {
+		t.Fatalf("create: %d %s", status, id)
+	}
+	status, body := c.do("GET", "/api/0.6/node/"+id, "")
+	if status != http.StatusOK || !strings.Contains(body, `version="1"`) || !strings.Contains(body, `v="toilets"`) {
+		t.Errorf("read back %d %s, want version 1 with its tags", status, body)
+	}
+}
+
+func TestClosedChangesets(t *testing.T) {
+	tests := []struct {
+		name  string
+		close func(s *Server, c *client, cs string)
+	}{
+		{"closed by the client", func(s *Server, c *client, cs string) {
+			if status, body := c.do("PUT", "/api/0.6/changeset/"+cs+"/close", ""); status != http.StatusOK {
+				t.Fatalf("close: %d %s", status, body)
+			}
+		}},
+		{"idle for too long", func(s *Server, c *client, cs string) {
+			now := time.Now()
+			s.Now = func() time.Time { return now.Add(s.IdleTimeout + time.Minute) }
+		}},
+		{"full", func(s *Server, c *client, cs string) {
+			s.MaxChangesetElements = 1
+			if status, body := c.do("PUT", "/api/0.6/way/100", wayBody(cs, 3)); status != http.StatusOK {
+				t.Fatalf("update: %d %s", status, body)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+			cs := c.openChangeset()
+			tt.close(s, c, cs)
+
+			status, body := c.do("PUT", "/api/0.6/node/create", `<osm><node changeset="`+cs+`" lat="44.45" lon="26.12"/></osm>`)
+			if status != http.StatusConflict || !strings.Contains(body, "was closed at") {
+				t.Errorf("edit in a closed changeset: %d %s, want 409", status, body)
+			}
+			status, body = c.do("GET", "/api/0.6/changeset/"+cs, "")
+			if status != http.StatusOK || !strings.Contains(body, `open="false"`) || !strings.Contains(body, "closed_at=") {
+				t.Errorf("changeset read back as %d %s, want it closed", status, body)
+			}
+		})
+	}
+}
+
+func TestChangesetOwner(t *testing.T) {
+	_, alice := newTestServer(t)
+	cs := alice.openChangeset()
+	bob := &client{t: t, server: alice.server, token: "bob"}
+
+	if status, body := bob.do("PUT", "/api/0.6/way/100", wayBody(cs, 3)); status != http.StatusConflict {
+		t.Errorf("edit in another user's changeset: %d %s, want 409", status, body)
+	}
+	if status, body := bob.do("PUT", "/api/0.6/changeset/"+cs+"/close", ""); status != http.StatusConflict {
+		t.Errorf("closing another user's changeset: %d %s, want 409", status, body)
+	}
+
+	anonymous := &client{t: t, server: alice.server}
+	if status, body := anonymous.do("PUT", "/api/0.6/changeset/create", changesetBody); status != http.StatusUnauthorized {
+		t.Errorf("changeset without a token: %d %s, want 401", status, body)
+	}
+}
+
+func TestWayNeedsItsNodes(t *testing.T) {
+	_, c := newTestServer(t)
+	cs := c.openChangeset()
+	body := `<osm><way id="100" version="3" changeset="` + cs + `"><nd ref="1"/><nd ref="99"/></way></osm>`
+	if status, resp := c.do("PUT", "/api/0.6/way/100", body); status != http.StatusPreconditionFailed {
+		t.Errorf("way with a missing node: %d %s, want 412", status, resp)
+	}
+	body = `<osm><way id="100" version="3" changeset="` + cs + `"></way></osm>`
+	if status, resp := c.do("PUT", "/api/0.6/way/100", body); status != http.StatusPreconditionFailed {
+		t.Errorf("way without nodes: %d %s, want 412", status, resp)
+	}
+}
+
+func TestElementHistory(t *testing.T) {
+	_, c := newTestServer(t)
+	cs := c.openChangeset()
+	if status, body := c.do("PUT", "/api/0.6/way/100", wayBody(cs, 3)); status != http.StatusOK {
+		t.Fatalf("update: %d %s", status, body)
+	}
+
+	status, body := c.do("GET", "/api/0.6/way/100/3", "")
+	if status != http.StatusOK || !strings.Contains(body, `version="3"`) || strings.Contains(body, "zoning_code") {
+		t.Errorf("version 3 read back as %d %s, want the fixture tags", status, body)
+	}
+	status, body = c.do("GET", "/api/0.6/way/100/4.json", "")
+	if status != http.StatusOK || !strings.Contains(body, `"version":4`) || !strings.Contains(body, `"zoning_code":"R1"`) {
+		t.Errorf("version 4 read back as %d %s, want the edited tags", status, body)
+	}
+	if status, body := c.do("GET", "/api/0.6/way/100/5", ""); status != http.StatusNotFound {
+		t.Errorf("a version not written yet: %d %s, want 404", status, body)
+	}
+}
+
+func TestElementsRead(t *testing.T) {
+	_, c := newTestServer(t)
+	tests := []struct {
+		path   string
+		status int
+		want   []string
+	}{
+		{"/api/0.6/nodes?nodes=1,2", http.StatusOK, []string{`<node id="1"`, `<node id="2"`}},
+		{"/api/0.6/nodes.json?nodes=2", http.StatusOK, []string{`"id":2`, `"lat":44.44`}},
+		{"/api/0.6/ways?ways=100", http.StatusOK, []string{`<way id="100"`, `<nd ref="2">`}},
+		{"/api/0.6/nodes?nodes=1,3", http.StatusNotFound, nil},
+		{"/api/0.6/nodes?nodes=1,x", http.StatusBadRequest, nil},
+		{"/api/0.6/nodes", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		status, body := c.do("GET", tt.path, "")
+		if status != tt.status {
+			t.Errorf("GET %s: %d %s, want %d", tt.path, status, body, tt.status)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("GET %s: got %s, want it to contain %s", tt.path, body, want)
+			}
+		}
+	}
+}
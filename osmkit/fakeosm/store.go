@@ -0,0 +1,299 @@
+// fakeosm/store.go
+package fakeosm
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Element is one version of a node, way or relation held by the fake server.
+type Element struct {
+	Type      string
+	ID        int64
+	Version   int
+	Changeset int64
+	UID       int64
+	User      string
+	Timestamp time.Time
+	Visible   bool
+	Lat       float64
+	Lon       float64
+	Nodes     []int64
+	Tags      map[string]string
+}
+
+func (e *Element) key() string {
+	return elementKey(e.Type, e.ID)
+}
+
+func elementKey(elemType string, id int64) string {
+	return fmt.Sprintf("%s/%d", elemType, id)
+}
+
+type changeset struct {
+	ID           int64
+	UID          int64
+	User         string
+	Tags         map[string]string
+	CreatedAt    time.Time
+	ClosedAt     time.Time
+	LastActivity time.Time
+	Open         bool
+	Changes      int
+}
+
+type user struct {
+	ID   int64
+	Name string
+}
+
+// apiError is returned by store operations and carries the HTTP status the
+// real API would answer with.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string { return e.Message }
+
+func errorf(status int, format string, args ...interface{}) error {
+	return &apiError{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// current returns the latest version of an element, or nil. Callers must hold s.mu.
+func (s *Server) current(elemType string, id int64) *Element {
+	versions := s.elements[elementKey(elemType, id)]
+	if len(versions) == 0 {
+		return nil
+	}
+	return versions[len(versions)-1]
+}
+
+// version returns the given version of an element, or nil when the history
+// does not have it. Callers must hold s.mu.
+func (s *Server) version(elemType string, id int64, version int) *Element {
+	for _, e := range s.elements[elementKey(elemType, id)] {
+		if e.Version == version {
+			return e
+		}
+	}
+	return nil
+}
+
+// put stores a new version of an element. Callers must hold s.mu.
+func (s *Server) put(e *Element) {
+	key := e.key()
+	s.elements[key] = append(s.elements[key], e)
+}
+
+// userForToken returns the user owning a bearer token, registering a new
+// user for tokens the server has not seen yet. Callers must hold s.mu.
+func (s *Server) userForToken(token string) *user {
+	if u, ok := s.users[token]; ok {
+		return u
+	}
+	s.nextUID++
+	u := &user{ID: s.nextUID, Name: fmt.Sprintf("fake_user_%d", s.nextUID)}
+	s.users[token] = u
+	return u
+}
+
+// openChangeset returns the changeset if u may add changes to it. Callers must hold s.mu.
+func (s *Server) openChangeset(u *user, id int64) (*changeset, error) {
+	cs, ok := s.changesets[id]
+	if !ok {
+		return nil, errorf(404, "Changeset %d not found", id)
+	}
+	if cs.UID != u.ID {
+		return nil, errorf(409, "The user doesn't own that changeset")
+	}
+	s.expire(cs)
+	if !cs.Open {
+		return nil, errorf(409, "The changeset %d was closed at %s", id, cs.ClosedAt.UTC().Format(time.RFC3339))
+	}
+	if cs.Changes >= s.MaxChangesetElements {
+		s.close(cs, s.Now())
+		return nil, errorf(409, "The changeset %d was closed at %s", id, cs.ClosedAt.UTC().Format(time.RFC3339))
+	}
+	return cs, nil
+}
+
+// expire closes a changeset that has been idle for longer than IdleTimeout. Callers must hold s.mu.
+func (s *Server) expire(cs *changeset) {
+	if cs.Open && s.Now().Sub(cs.LastActivity) > s.IdleTimeout {
+		s.close(cs, cs.LastActivity.Add(s.IdleTimeout))
+	}
+}
+
+func (s *Server) close(cs *changeset, at time.Time) {
+	cs.Open = false
+	cs.ClosedAt = at
+}
+
+// createChangeset opens a new changeset for u. Callers must hold s.mu.
+func (s *Server) createChangeset(u *user, tags map[string]string) *changeset {
+	s.nextChangesetID++
+	now := s.Now()
+	cs := &changeset{
+		ID:           s.nextChangesetID,
+		UID:          u.ID,
+		User:         u.Name,
+		Tags:         tags,
+		CreatedAt:    now,
+		LastActivity: now,
+		Open:         true,
+	}
+	s.changesets[cs.ID] = cs
+	return cs
+}
+
+// create stores a new element in cs and returns it with its assigned ID. Callers must hold s.mu.
+func (s *Server) create(u *user, cs *changeset, e Element) (*Element, error) {
+	if err := s.checkElement(&e); err != nil {
+		return nil, err
+	}
+	switch e.Type {
+	case "node":
+		s.nextNodeID++
+		e.ID = s.nextNodeID
+	case "way":
+		s.nextWayID++
+		e.ID = s.nextWayID
+	}
+	s.stamp(u, cs, &e, 1)
+	return &e, nil
+}
+
+// modify stores a new version of an existing element after checking the
+// version the client based its edit on. Callers must hold s.mu.
+func (s *Server) modify(u *user, cs *changeset, e Element) (*Element, error) {
+	cur := s.current(e.Type, e.ID)
+	if cur == nil {
+		return nil, errorf(404, "Not found")
+	}
+	if !cur.Visible {
+		return nil, errorf(410, "The %s with the id %d has already been deleted", e.Type, e.ID)
+	}
+	if e.Version != cur.Version {
+		return nil, errorf(409, "Version mismatch: Provided %d, server had: %d of %s %d", e.Version, cur.Version, title(e.Type), e.ID)
+	}
+	if err := s.checkElement(&e); err != nil {
+		return nil, err
+	}
+	s.stamp(u, cs, &e, cur.Version+1)
+	return &e, nil
+}
+
+// remove stores a deleted version of an element after checking the version and,
+// for nodes, that no visible way still uses it. Callers must hold s.mu.
+func (s *Server) remove(u *user, cs *changeset, e Element) (*Element, error) {
+	cur := s.current(e.Type, e.ID)
+	if cur == nil {
+		return nil, errorf(404, "Not found")
+	}
+	if !cur.Visible {
+		return nil, errorf(410, "The %s with the id %d has already been deleted", e.Type, e.ID)
+	}
+	if e.Version != cur.Version {
+		return nil, errorf(409, "Version mismatch: Provided %d, server had: %d of %s %d", e.Version, cur.Version, title(e.Type), e.ID)
+	}
+	if e.Type == "node" {
+		var ways []int64
+		for _, other := range s.visible() {
+			for _, ref := range other.Nodes {
+				if ref == e.ID {
+					ways = append(ways, other.ID)
+					break
+				}
+			}
+		}
+		if len(ways) > 0 {
+			return nil, errorf(412, "Precondition failed: Node %d is still used by ways %v.", e.ID, ways)
+		}
+	}
+
+	deleted := *cur
+	deleted.Tags = nil
+	deleted.Nodes = nil
+	s.stamp(u, cs, &deleted, cur.Version+1)
+	deleted.Visible = false // stamp stored the pointer, so this hides the new version
+	return &deleted, nil
+}
+
+// stamp assigns version and changeset metadata and stores e. Callers must hold s.mu.
+func (s *Server) stamp(u *user, cs *changeset, e *Element, version int) {
+	now := s.Now()
+	e.Version = version
+	e.Changeset = cs.ID
+	e.UID = u.ID
+	e.User = u.Name
+	e.Timestamp = now
+	e.Visible = true
+	cs.Changes++
+	cs.LastActivity = now
+	s.put(e)
+}
+
+// checkElement validates an element the way the API does before accepting it.
+func (s *Server) checkElement(e *Element) error {
+	for k, v := range e.Tags {
+		if len([]rune(k)) > 255 || len([]rune(v)) > 255 {
+			return errorf(400, "Element %s/%d has a tag with too long key or value", e.Type, e.ID)
+		}
+	}
+	if e.Type == "way" {
+		if len(e.Nodes) == 0 {
+			return errorf(412, "Precondition failed: Way %d must have at least one node", e.ID)
+		}
+		var missing []int64
+		for _, ref := range e.Nodes {
+			if n := s.current("node", ref); n == nil || !n.Visible {
+				missing = append(missing, ref)
+			}
+		}
+		if len(missing) > 0 {
+			return errorf(412, "Precondition failed: Way %d requires the nodes with id in (%v), which either do not exist, or are not visible.", e.ID, missing)
+		}
+	}
+	return nil
+}
+
+// visible returns the current version of every visible element sorted by type and ID.
+func (s *Server) visible() []*Element {
+	var out []*Element
+	for _, versions := range s.elements {
+		if cur := versions[len(versions)-1]; cur.Visible {
+			out = append(out, cur)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Type != out[j].Type {
+			return typeOrder(out[i].Type) < typeOrder(out[j].Type)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func typeOrder(elemType string) int {
+	switch elemType {
+	case "node":
+		return 0
+	case "way":
+		return 1
+	}
+	return 2
+}
+
+func title(elemType string) string {
+	switch elemType {
+	case "node":
+		return "Node"
+	case "way":
+		return "Way"
+	case "relation":
+		return "Relation"
+	}
+	return elemType
+}
@@ -0,0 +1,145 @@
+// fakeosm/upload.go
+package fakeosm
+
+import (
+	"encoding/xml"
+	"net/http"
+	"osmkit/osmchange"
+	"osmkit/osmxml"
+	"time"
+)
+
+type osmChange struct {
+	Blocks []changeBlock `xml:",any"`
+}
+
+type changeBlock struct {
+	XMLName xml.Name
+	Nodes   []osmxml.Node `xml:"node"`
+	Ways    []osmxml.Way  `xml:"way"`
+}
+
+// handleUpload applies an osmChange document to a changeset. Like the real
+// API it applies every element or, on the first error, none of them.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id, _, err := pathID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	cs, err := s.openChangeset(u, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var change osmChange
+	if err := xml.NewDecoder(r.Body).Decode(&change); err != nil {
+		writeError(w, errorf(http.StatusBadRequest, "Cannot parse valid osmChange from xml string: %v", err))
+		return
+	}
+
+	saved := make(map[string][]*Element, len(s.elements))
+	for key, versions := range s.elements {
+		saved[key] = versions
+	}
+	savedNode, savedWay, savedChanges, savedActivity := s.nextNodeID, s.nextWayID, cs.Changes, cs.LastActivity
+
+	result, err := s.applyChange(u, cs, change)
+	if err != nil {
+		s.elements = saved
+		s.nextNodeID, s.nextWayID, cs.Changes, cs.LastActivity = savedNode, savedWay, savedChanges, savedActivity
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(result)
+}
+
+// applyChange applies the blocks in document order. Callers must hold s.mu and
+// roll back on error.
+func (s *Server) applyChange(u *user, cs *changeset, change osmChange) (*osmchange.DiffResult, error) {
+	result := &osmchange.DiffResult{}
+	placeholders := map[int64]int64{} // placeholder node ID -> real ID
+
+	for _, block := range change.Blocks {
+		action := block.XMLName.Local
+		var elements []Element
+		for _, n := range block.Nodes {
+			elements = append(elements, Element{Type: "node", ID: n.ID, Version: n.Version, Changeset: n.Changeset, Lat: n.Lat, Lon: n.Lon, Tags: n.Tags.Map()})
+		}
+		for _, wy := range block.Ways {
+			e := Element{Type: "way", ID: wy.ID, Version: wy.Version, Changeset: wy.Changeset, Tags: wy.Tags.Map()}
+			for _, nd := range wy.Nds {
+				e.Nodes = append(e.Nodes, nd.Ref)
+			}
+			elements = append(elements, e)
+		}
+		if action == "delete" {
+			// Ways go first so the nodes they use can be deleted after them
+			for i, j := 0, len(elements)-1; i < j; i, j = i+1, j-1 {
+				elements[i], elements[j] = elements[j], elements[i]
+			}
+		}
+
+		for _, e := range elements {
+			if e.Changeset != cs.ID {
+				return nil, errorf(http.StatusConflict, "Changeset mismatch: Provided %d but only %d is allowed", e.Changeset, cs.ID)
+			}
+			if cs.Changes >= s.MaxChangesetElements {
+				return nil, errorf(http.StatusConflict, "The changeset %d was closed at %s", cs.ID, s.Now().UTC().Format(time.RFC3339))
+			}
+
+			// Nodes created earlier in the upload are referenced by their placeholder
+			resolved := make([]int64, len(e.Nodes))
+			for i, ref := range e.Nodes {
+				if real, ok := placeholders[ref]; ok {
+					ref = real
+				}
+				resolved[i] = ref
+			}
+			e.Nodes = resolved
+
+			var (
+				out *Element
+				err error
+			)
+			switch action {
+			case "create":
+				out, err = s.create(u, cs, e)
+				if err == nil && e.Type == "node" {
+					placeholders[e.ID] = out.ID
+				}
+			case "modify":
+				out, err = s.modify(u, cs, e)
+			case "delete":
+				out, err = s.remove(u, cs, e)
+			default:
+				return nil, errorf(http.StatusBadRequest, "Unknown action %s, choices are create, modify, delete", action)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			entry := osmchange.Result{OldID: e.ID}
+			if action != "delete" {
+				entry.NewID, entry.NewVersion = out.ID, out.Version
+			}
+			if e.Type == "node" {
+				result.Nodes = append(result.Nodes, entry)
+			} else {
+				result.Ways = append(result.Ways, entry)
+			}
+		}
+	}
+	return result, nil
+}
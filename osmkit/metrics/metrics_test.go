@@ -0,0 +1,71 @@
+// metrics/metrics_test.go
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests by route.", "route", "code")
+	saves := r.Counter("saves_total", "Saves.")
+	latency := r.Histogram("latency_seconds", "Latency of\nrequests.", []float64{1, 0.1}, "route")
+	r.GaugeFunc("cache_bytes", "Size of the cache.", func() float64 { return 2048 })
+
+	requests.Inc("/data", "200")
+	requests.Inc("/data", "200")
+	requests.Add(0.5, `/node/"x"`, "404")
+	saves.Inc()
+	latency.Observe(0.05, "/data")
+	latency.Observe(0.1, "/data")
+	latency.Observe(3, "/data")
+
+	var b strings.Builder
+	r.WriteText(&b)
+	want := `# HELP requests_total Requests by route.
+# TYPE requests_total counter
+requests_total{route="/data",code="200"} 2
+requests_total{route="/node/\"x\"",code="404"} 0.5
+# HELP saves_total Saves.
+# TYPE saves_total counter
+saves_total 1
+# HELP latency_seconds Latency of\nrequests.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/data",le="0.1"} 2
+latency_seconds_bucket{route="/data",le="1"} 2
+latency_seconds_bucket{route="/data",le="+Inf"} 3
+latency_seconds_sum{route="/data"} 3.15
+latency_seconds_count{route="/data"} 3
+# HELP cache_bytes Size of the cache.
+# TYPE cache_bytes gauge
+cache_bytes 2048
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("saves_total", "Saves.").Inc()
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text format", ct)
+	}
+	if !strings.Contains(w.Body.String(), "saves_total 1\n") {
+		t.Errorf("got %s", w.Body)
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	c := NewRegistry().Counter("requests_total", "Requests.", "route")
+	defer func() {
+		if recover() == nil {
+			t.Error("a series with a missing label value was accepted")
+		}
+	}()
+	c.Inc()
+}
@@ -0,0 +1,55 @@
+// metrics/transport.go
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transport times the requests going through it, up to the response headers,
+// into a histogram labelled by endpoint and status code, "error" when no
+// response came back.
+type Transport struct {
+	Base      http.RoundTripper // http.DefaultTransport when nil
+	Histogram *Histogram
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	t.Histogram.Observe(time.Since(start).Seconds(), Endpoint(req), status)
+	return resp, err
+}
+
+// Endpoint is the host and path of a request with numeric segments such as
+// element IDs replaced by {id}, keeping a format suffix as in {id}.json, so
+// each API call is one series.
+func Endpoint(req *http.Request) string {
+	segments := strings.Split(req.URL.Path, "/")
+	for i, s := range segments {
+		id, ext, _ := strings.Cut(s, ".")
+		if id == "" || !isDigits(id) || ext != "" && isDigits(ext) {
+			// 0.6 is the API version, not an ID
+			continue
+		}
+		segments[i] = "{id}"
+		if ext != "" {
+			segments[i] += "." + ext
+		}
+	}
+	return req.URL.Host + strings.Join(segments, "/")
+}
+
+func isDigits(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
@@ -0,0 +1,62 @@
+// metrics/transport_test.go
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"https://api.openstreetmap.org/api/0.6/way/123", "api.openstreetmap.org/api/0.6/way/{id}"},
+		{"https://api.openstreetmap.org/api/0.6/way/123/4", "api.openstreetmap.org/api/0.6/way/{id}/{id}"},
+		{"https://api.openstreetmap.org/api/0.6/changeset/9/upload", "api.openstreetmap.org/api/0.6/changeset/{id}/upload"},
+		{"https://api.openstreetmap.org/api/0.6/nodes?nodes=1,2,3", "api.openstreetmap.org/api/0.6/nodes"},
+		{"https://api.openstreetmap.org/api/0.6/node/123.json", "api.openstreetmap.org/api/0.6/node/{id}.json"},
+		{"https://api.openstreetmap.org/api/0.6/user/details.json", "api.openstreetmap.org/api/0.6/user/details.json"},
+		{"http://127.0.0.1:8089/api/0.6/changeset/create", "127.0.0.1:8089/api/0.6/changeset/create"},
+	}
+	for _, tt := range tests {
+		if got := Endpoint(httptest.NewRequest("GET", tt.url, nil)); got != tt.want {
+			t.Errorf("Endpoint(%s) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/0.6/way/7" {
+			http.NotFound(w, r)
+		}
+	}))
+	r := NewRegistry()
+	client := &http.Client{Transport: &Transport{Histogram: r.Histogram("upstream_seconds", "Upstream requests.", []float64{60}, "endpoint", "code")}}
+	for _, path := range []string{"/api/0.6/way/5", "/api/0.6/way/6", "/api/0.6/way/7"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	server.Close()
+	if _, err := client.Get(server.URL + "/api/0.6/way/8"); err == nil {
+		t.Fatal("got no error from a closed server")
+	}
+
+	var b strings.Builder
+	r.WriteText(&b)
+	host := strings.TrimPrefix(server.URL, "http://")
+	for _, want := range []string{
+		`upstream_seconds_count{endpoint="` + host + `/api/0.6/way/{id}",code="200"} 2`,
+		`upstream_seconds_count{endpoint="` + host + `/api/0.6/way/{id}",code="404"} 1`,
+		`upstream_seconds_count{endpoint="` + host + `/api/0.6/way/{id}",code="error"} 1`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("got\n%s\nwant a line %s", b.String(), want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// osmchange/decode.go
+package osmchange
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"osmkit/osmxml"
+)
+
+// Action is the block an element appears in.
+type Action string
+
+const (
+	Create Action = "create"
+	Modify Action = "modify"
+	Delete Action = "delete"
+)
+
+// Change is one element of an osmChange document. Exactly one of Node, Way and
+// Relation is set. Deleted elements only carry their ID and version.
+type Change struct {
+	Action   Action
+	Node     *osmxml.Node
+	Way      *osmxml.Way
+	Relation *osmxml.Relation
+}
+
+// Decode reads an osmChange document such as a replication diff. Changes are
+// returned in document order, so applying them in turn leaves every element in
+// its last state even when it appears several times.
+func Decode(r io.Reader) ([]Change, error) {
+	dec := xml.NewDecoder(r)
+	var changes []Change
+	var action Action
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return changes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode osmChange: %v", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "create", "modify", "delete":
+				action = Action(t.Name.Local)
+				continue
+			case "osmChange":
+				continue
+			}
+			if action == "" {
+				return nil, fmt.Errorf("failed to decode osmChange: <%s> outside of a block", t.Name.Local)
+			}
+			change := Change{Action: action}
+			switch t.Name.Local {
+			case "node":
+				change.Node = &osmxml.Node{}
+				err = dec.DecodeElement(change.Node, &t)
+			case "way":
+				change.Way = &osmxml.Way{}
+				err = dec.DecodeElement(change.Way, &t)
+			case "relation":
+				change.Relation = &osmxml.Relation{}
+				err = dec.DecodeElement(change.Relation, &t)
+			default:
+				err = dec.Skip()
+				if err == nil {
+					continue
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode osmChange: %v", err)
+			}
+			changes = append(changes, change)
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "create", "modify", "delete":
+				action = ""
+			}
+		}
+	}
+}
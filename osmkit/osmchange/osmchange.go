@@ -0,0 +1,162 @@
+// osmchange/osmchange.go
+package osmchange
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"osmkit/osmxml"
+)
+
+// Block holds the elements of a <create> or <modify> block. Nodes are encoded
+// before the ways and relations that may refer to them.
+type Block struct {
+	Nodes     []osmxml.Node     `xml:"node"`
+	Ways      []osmxml.Way      `xml:"way"`
+	Relations []osmxml.Relation `xml:"relation"`
+}
+
+// deleteBlock lists relations and ways before the nodes they use, as the API
+// applies the elements of a block in document order.
+type deleteBlock struct {
+	Relations []osmxml.Relation `xml:"relation"`
+	Ways      []osmxml.Way      `xml:"way"`
+	Nodes     []osmxml.Node     `xml:"node"`
+}
+
+type document struct {
+	XMLName   xml.Name     `xml:"osmChange"`
+	Version   string       `xml:"version,attr"`
+	Generator string       `xml:"generator,attr,omitempty"`
+	Create    *Block       `xml:"create,omitempty"`
+	Modify    *Block       `xml:"modify,omitempty"`
+	Delete    *deleteBlock `xml:"delete,omitempty"`
+}
+
+// Builder collects the edits of one upload. Created elements get negative
+// placeholder IDs that can be used in ways before the real IDs are known.
+type Builder struct {
+	Generator string
+
+	create Block
+	modify Block
+	delete Block
+	lastID int64
+	count  int
+}
+
+// NewBuilder returns an empty Builder.
+func NewBuilder(generator string) *Builder {
+	return &Builder{Generator: generator}
+}
+
+func (b *Builder) placeholder() int64 {
+	b.lastID--
+	b.count++
+	return b.lastID
+}
+
+// CreateNode adds a new node and returns its placeholder ID.
+func (b *Builder) CreateNode(lat, lon float64, tags map[string]string) int64 {
+	id := b.placeholder()
+	b.create.Nodes = append(b.create.Nodes, osmxml.Node{ID: id, Lat: lat, Lon: lon, Tags: osmxml.TagsFromMap(tags)})
+	return id
+}
+
+// CreateWay adds a new way over existing node IDs or placeholders and returns its placeholder ID.
+func (b *Builder) CreateWay(nodes []int64, tags map[string]string) int64 {
+	id := b.placeholder()
+	way := osmxml.Way{ID: id, Tags: osmxml.TagsFromMap(tags)}
+	for _, ref := range nodes {
+		way.Nds = append(way.Nds, osmxml.Nd{Ref: ref})
+	}
+	b.create.Ways = append(b.create.Ways, way)
+	return id
+}
+
+// ModifyNode uploads node as its new version. It must carry the version it replaces.
+func (b *Builder) ModifyNode(node osmxml.Node) {
+	b.count++
+	b.modify.Nodes = append(b.modify.Nodes, node)
+}
+
+// ModifyWay uploads way as its new version. It must carry the version it
+// replaces and its full node list.
+func (b *Builder) ModifyWay(way osmxml.Way) {
+	b.count++
+	b.modify.Ways = append(b.modify.Ways, way)
+}
+
+// DeleteNode deletes the given version of a node.
+func (b *Builder) DeleteNode(id int64, version int) {
+	b.count++
+	b.delete.Nodes = append(b.delete.Nodes, osmxml.Node{ID: id, Version: version})
+}
+
+// DeleteWay deletes the given version of a way.
+func (b *Builder) DeleteWay(id int64, version int) {
+	b.count++
+	b.delete.Ways = append(b.delete.Ways, osmxml.Way{ID: id, Version: version})
+}
+
+// Len returns the number of elements in the upload.
+func (b *Builder) Len() int {
+	return b.count
+}
+
+// Marshal encodes the osmChange document for the given changeset.
+func (b *Builder) Marshal(changesetID int64) ([]byte, error) {
+	if b.count == 0 {
+		return nil, fmt.Errorf("osmChange is empty")
+	}
+
+	doc := document{Version: "0.6", Generator: b.Generator}
+	if create := b.create.inChangeset(changesetID); !create.empty() {
+		doc.Create = create
+	}
+	if modify := b.modify.inChangeset(changesetID); !modify.empty() {
+		doc.Modify = modify
+	}
+	if del := b.delete.inChangeset(changesetID); !del.empty() {
+		doc.Delete = &deleteBlock{Relations: del.Relations, Ways: del.Ways, Nodes: del.Nodes}
+	}
+
+	for _, block := range []*Block{doc.Create, doc.Modify} {
+		if block == nil {
+			continue
+		}
+		if err := (&osmxml.OSM{Nodes: block.Nodes, Ways: block.Ways, Relations: block.Relations}).Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inChangeset returns a copy of the block with every element assigned to the changeset.
+func (blk Block) inChangeset(changesetID int64) *Block {
+	out := &Block{
+		Nodes:     append([]osmxml.Node(nil), blk.Nodes...),
+		Ways:      append([]osmxml.Way(nil), blk.Ways...),
+		Relations: append([]osmxml.Relation(nil), blk.Relations...),
+	}
+	for i := range out.Nodes {
+		out.Nodes[i].Changeset = changesetID
+	}
+	for i := range out.Ways {
+		out.Ways[i].Changeset = changesetID
+	}
+	for i := range out.Relations {
+		out.Relations[i].Changeset = changesetID
+	}
+	return out
+}
+
+func (blk *Block) empty() bool {
+	return len(blk.Nodes)+len(blk.Ways)+len(blk.Relations) == 0
+}
@@ -0,0 +1,204 @@
+// osmchange/split.go
+package osmchange
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"osmkit/osmxml"
+)
+
+// Split divides the edits into builders of at most max elements each, keeping
+// their order. Ways that use nodes created in the same upload stay in the
+// builder that creates those nodes, since placeholder IDs do not carry over to
+// another upload; such a group can make a builder exceed max.
+func (b *Builder) Split(max int) []*Builder {
+	if max <= 0 || b.count <= max {
+		return []*Builder{b}
+	}
+
+	units := b.units()
+	var chunks []*Builder
+	current := &Builder{Generator: b.Generator, lastID: b.lastID}
+	for _, u := range units {
+		if current.count > 0 && current.count+u.count > max {
+			chunks = append(chunks, current)
+			current = &Builder{Generator: b.Generator, lastID: b.lastID}
+		}
+		current.add(u)
+	}
+	if current.count > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// units groups the edits into the smallest pieces that can be uploaded on their own.
+func (b *Builder) units() []*Builder {
+	var units []*Builder
+	newUnit := func() *Builder {
+		u := &Builder{}
+		units = append(units, u)
+		return u
+	}
+	// unitOf maps created node placeholders to the unit that creates them
+	unitOf := map[int64]*Builder{}
+
+	for _, n := range b.create.Nodes {
+		u := newUnit()
+		u.create.Nodes = append(u.create.Nodes, n)
+		u.count++
+		unitOf[n.ID] = u
+	}
+
+	// A way joins the unit of the first placeholder node it uses; units of
+	// other placeholder nodes it uses are merged into that one.
+	placeWay := func(w wayEdit) {
+		var target *Builder
+		for _, nd := range w.way.Nds {
+			u, ok := unitOf[nd.Ref]
+			if !ok || u == target {
+				continue
+			}
+			if target == nil {
+				target = u
+				continue
+			}
+			target.add(u)
+			*u = Builder{}
+			for ref, owner := range unitOf {
+				if owner == u {
+					unitOf[ref] = target
+				}
+			}
+		}
+		if target == nil {
+			target = newUnit()
+		}
+		if w.modify {
+			target.modify.Ways = append(target.modify.Ways, w.way)
+		} else {
+			target.create.Ways = append(target.create.Ways, w.way)
+		}
+		target.count++
+	}
+	for _, w := range b.create.Ways {
+		placeWay(wayEdit{way: w})
+	}
+	for _, n := range b.modify.Nodes {
+		u := newUnit()
+		u.modify.Nodes = append(u.modify.Nodes, n)
+		u.count++
+	}
+	for _, w := range b.modify.Ways {
+		placeWay(wayEdit{way: w, modify: true})
+	}
+	for _, r := range b.create.Relations {
+		u := newUnit()
+		u.create.Relations = append(u.create.Relations, r)
+		u.count++
+	}
+	for _, r := range b.modify.Relations {
+		u := newUnit()
+		u.modify.Relations = append(u.modify.Relations, r)
+		u.count++
+	}
+
+	// Deletes come last, relations and ways before the nodes they use
+	for _, r := range b.delete.Relations {
+		u := newUnit()
+		u.delete.Relations = append(u.delete.Relations, r)
+		u.count++
+	}
+	for _, w := range b.delete.Ways {
+		u := newUnit()
+		u.delete.Ways = append(u.delete.Ways, w)
+		u.count++
+	}
+	for _, n := range b.delete.Nodes {
+		u := newUnit()
+		u.delete.Nodes = append(u.delete.Nodes, n)
+		u.count++
+	}
+
+	nonEmpty := units[:0]
+	for _, u := range units {
+		if u.count > 0 {
+			nonEmpty = append(nonEmpty, u)
+		}
+	}
+	return nonEmpty
+}
+
+type wayEdit struct {
+	way    osmxml.Way
+	modify bool
+}
+
+// add appends the edits of other to b.
+func (b *Builder) add(other *Builder) {
+	for _, pair := range [][2]*Block{{&b.create, &other.create}, {&b.modify, &other.modify}, {&b.delete, &other.delete}} {
+		dst, src := pair[0], pair[1]
+		dst.Nodes = append(dst.Nodes, src.Nodes...)
+		dst.Ways = append(dst.Ways, src.Ways...)
+		dst.Relations = append(dst.Relations, src.Relations...)
+	}
+	b.count += other.count
+}
+
+// Chunk statuses reported by UploadChunks.
+const (
+	ChunkUploaded = "uploaded"
+	ChunkFailed   = "failed"
+	ChunkSkipped  = "skipped"
+)
+
+// ChunkResult reports what happened to one chunk of a split upload.
+type ChunkResult struct {
+	Changeset int64       `json:"changeset,omitempty"`
+	Elements  int         `json:"elements"`
+	Status    string      `json:"status"`
+	Error     string      `json:"error,omitempty"`
+	Diff      *DiffResult `json:"-"`
+}
+
+// UploadChunks uploads the chunks one after the other. changesetFor returns
+// the open changeset a chunk of n elements goes to, and done is called after
+// each chunk so the caller can record it, report progress or close the
+// changeset. The first failure stops the upload: the API applies a chunk
+// entirely or not at all, so earlier chunks stay saved and later ones are
+// reported as skipped. ctx only carries the values of the logs: a cancelled
+// request could leave the upload applied without us knowing.
+func UploadChunks(ctx context.Context, client *http.Client, apiBase string, chunks []*Builder,
+	changesetFor func(n int) (int64, error), done func(i int, result ChunkResult)) ([]ChunkResult, error) {
+	results := make([]ChunkResult, len(chunks))
+	for i, chunk := range chunks {
+		results[i] = ChunkResult{Elements: chunk.Len(), Status: ChunkSkipped}
+	}
+
+	for i, chunk := range chunks {
+		result := &results[i]
+		changesetID, err := changesetFor(chunk.Len())
+		if err != nil {
+			result.Status, result.Error = ChunkFailed, err.Error()
+			return results, fmt.Errorf("chunk %d/%d: failed to open changeset: %w", i+1, len(chunks), err)
+		}
+		result.Changeset = changesetID
+
+		diff, err := Upload(client, apiBase, changesetID, chunk)
+		if err != nil {
+			result.Status, result.Error = ChunkFailed, err.Error()
+			if done != nil {
+				done(i, *result)
+			}
+			return results, fmt.Errorf("chunk %d/%d: %w", i+1, len(chunks), err)
+		}
+		result.Status, result.Diff = ChunkUploaded, diff
+		slog.InfoContext(ctx, "Uploaded chunk", "chunk", i+1, "chunks", len(chunks), "elements", chunk.Len(), "changeset", changesetID)
+		if done != nil {
+			done(i, *result)
+		}
+	}
+	return results, nil
+}
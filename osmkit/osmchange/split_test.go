@@ -0,0 +1,121 @@
+// osmchange/split_test.go
+package osmchange
+
+import (
+	"osmkit/osmxml"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *Builder)
+		max   int
+		want  []int // elements per chunk
+	}{
+		{
+			name:  "fits",
+			build: func(b *Builder) { createNodes(b, 3) },
+			max:   3,
+			want:  []int{3},
+		},
+		{
+			name:  "no limit",
+			build: func(b *Builder) { createNodes(b, 3) },
+			max:   0,
+			want:  []int{3},
+		},
+		{
+			name:  "nodes",
+			build: func(b *Builder) { createNodes(b, 5) },
+			max:   2,
+			want:  []int{2, 2, 1},
+		},
+		{
+			name: "way stays with its new nodes",
+			build: func(b *Builder) {
+				b.CreateWay(createNodes(b, 3), nil)
+				createNodes(b, 1)
+			},
+			max:  2,
+			want: []int{4, 1},
+		},
+		{
+			name: "way over existing nodes",
+			build: func(b *Builder) {
+				createNodes(b, 2)
+				b.CreateWay([]int64{1, 2}, nil)
+			},
+			max:  2,
+			want: []int{2, 1},
+		},
+		{
+			name: "way joins the groups of its nodes",
+			build: func(b *Builder) {
+				first := createNodes(b, 2)
+				second := createNodes(b, 2)
+				b.CreateWay(first, nil)
+				b.CreateWay(append(first[1:], second...), nil)
+			},
+			max:  3,
+			want: []int{6},
+		},
+		{
+			name: "modify and delete",
+			build: func(b *Builder) {
+				b.ModifyWay(osmxml.Way{ID: 100, Version: 2, Nds: []osmxml.Nd{{Ref: 1}, {Ref: 2}}})
+				b.ModifyNode(osmxml.Node{ID: 1, Version: 1})
+				b.DeleteWay(101, 1)
+				b.DeleteNode(3, 1)
+			},
+			max:  3,
+			want: []int{3, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuilder("test")
+			tt.build(b)
+			chunks := b.Split(tt.max)
+
+			var sizes []int
+			total := 0
+			for _, chunk := range chunks {
+				sizes = append(sizes, chunk.Len())
+				total += chunk.Len()
+				checkPlaceholders(t, chunk)
+			}
+			if !reflect.DeepEqual(sizes, tt.want) {
+				t.Errorf("chunk sizes = %v, want %v", sizes, tt.want)
+			}
+			if total != b.Len() {
+				t.Errorf("chunks hold %d elements, want %d", total, b.Len())
+			}
+		})
+	}
+}
+
+func createNodes(b *Builder, n int) []int64 {
+	var ids []int64
+	for i := 0; i < n; i++ {
+		ids = append(ids, b.CreateNode(44.43+float64(i)/1000, 26.10, nil))
+	}
+	return ids
+}
+
+// checkPlaceholders fails when a chunk uses a placeholder node it does not create.
+func checkPlaceholders(t *testing.T, chunk *Builder) {
+	t.Helper()
+	created := map[int64]bool{}
+	for _, n := range chunk.create.Nodes {
+		created[n.ID] = true
+	}
+	for _, w := range append(chunk.create.Ways, chunk.modify.Ways...) {
+		for _, nd := range w.Nds {
+			if nd.Ref < 0 && !created[nd.Ref] {
+				t.Errorf("way %d uses node %d created in another chunk", w.ID, nd.Ref)
+			}
+		}
+	}
+}
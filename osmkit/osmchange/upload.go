@@ -0,0 +1,88 @@
+// osmchange/upload.go
+package osmchange
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"osmkit/apperr"
+)
+
+// Result is one element of the <diffResult> returned by an upload. NewID and
+// NewVersion are zero for deleted elements.
+type Result struct {
+	OldID      int64 `xml:"old_id,attr"`
+	NewID      int64 `xml:"new_id,attr,omitempty"`
+	NewVersion int   `xml:"new_version,attr,omitempty"`
+}
+
+// DiffResult maps the IDs sent in an upload to the IDs and versions the API assigned.
+type DiffResult struct {
+	XMLName   xml.Name `xml:"diffResult"`
+	Nodes     []Result `xml:"node"`
+	Ways      []Result `xml:"way"`
+	Relations []Result `xml:"relation"`
+}
+
+// Lookup returns the result for an element of the upload by its type and the
+// ID it was sent with, which is the placeholder for created elements.
+func (d *DiffResult) Lookup(elemType string, oldID int64) (Result, bool) {
+	var results []Result
+	switch elemType {
+	case "node":
+		results = d.Nodes
+	case "way":
+		results = d.Ways
+	case "relation":
+		results = d.Relations
+	}
+	for _, r := range results {
+		if r.OldID == oldID {
+			return r, true
+		}
+	}
+	return Result{}, false
+}
+
+// Upload sends the builder's edits to an open changeset in one request. The
+// API applies all of them or none. client is the OAuth client of the user,
+// which authenticates the request; the generator of the builder is sent as
+// the User-Agent.
+func Upload(client *http.Client, apiBase string, changesetID int64, b *Builder) (*DiffResult, error) {
+	body, err := b.Marshal(changesetID)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Validation, err, "failed to build osmChange")
+	}
+
+	url := fmt.Sprintf("%s/changeset/%d/upload", apiBase, changesetID)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if b.Generator != "" {
+		req.Header.Set("User-Agent", b.Generator)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "upload to changeset %d failed", changesetID)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "failed to read upload response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, apperr.FromStatus(resp.StatusCode, string(respBody), "upload to changeset %d failed", changesetID)
+	}
+
+	var result DiffResult
+	if err := xml.Unmarshal(respBody, &result); err != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "failed to parse diffResult")
+	}
+	return &result, nil
+}
@@ -0,0 +1,257 @@
+// osmchange/upload_test.go
+package osmchange_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"osmkit/fakeosm"
+	"osmkit/osmchange"
+	"osmkit/osmxml"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// bearer authenticates requests to fakeosm, which accepts any token.
+type bearer string
+
+func (b bearer) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+string(b))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestAPI returns the API base of a fakeosm server and a client for it.
+func newTestAPI(t *testing.T) (string, *http.Client) {
+	t.Helper()
+	api := fakeosm.New()
+	err := api.LoadFixture(strings.NewReader(`<osm version="0.6">
+ <node id="1" version="1" lat="44.43" lon="26.10"><tag k="amenity" v="bench"/></node>
+</osm>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	return server.URL + "/api/0.6", &http.Client{Transport: bearer("test")}
+}
+
+// openChangeset opens a new changeset and returns its ID.
+func openChangeset(t *testing.T, client *http.Client, apiBase string) int64 {
+	t.Helper()
+	body, err := osmxml.NewChangeset(map[string]string{"comment": "test"}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("PUT", apiBase+"/changeset/create", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: %s", resp.Status, raw)
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// changesetFor returns a changesetFor for UploadChunks that opens a new
+// changeset for each chunk.
+func changesetFor(t *testing.T, client *http.Client, apiBase string) func(n int) (int64, error) {
+	return func(n int) (int64, error) {
+		return openChangeset(t, client, apiBase), nil
+	}
+}
+
+// nodeVersion reads the current version of a node, 0 when it is gone.
+func nodeVersion(t *testing.T, client *http.Client, apiBase string, id int64) int {
+	t.Helper()
+	resp, err := client.Get(apiBase + "/node/" + strconv.FormatInt(id, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0
+	}
+	doc, err := osmxml.Decode(resp.Body)
+	if err != nil || len(doc.Nodes) != 1 {
+		t.Fatalf("reading node %d: %v", id, err)
+	}
+	return doc.Nodes[0].Version
+}
+
+func TestUpload(t *testing.T) {
+	apiBase, client := newTestAPI(t)
+	changesetID := openChangeset(t, client, apiBase)
+	b := osmchange.NewBuilder("test")
+	nodes := createNodes(b, 2)
+	way := b.CreateWay(nodes, map[string]string{"highway": "footway"})
+	b.ModifyNode(osmxml.Node{ID: 1, Version: 1, Lat: 44.43, Lon: 26.10, Tags: osmxml.TagsFromMap(map[string]string{"amenity": "bench", "backrest": "yes"})})
+
+	diff, err := osmchange.Upload(client, apiBase, changesetID, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range nodes {
+		if r, ok := diff.Lookup("node", id); !ok || r.NewID <= 0 || r.NewVersion != 1 {
+			t.Errorf("got node %d result %+v, %v, want a new node at version 1", id, r, ok)
+		}
+	}
+	if r, ok := diff.Lookup("way", way); !ok || r.NewID <= 0 || r.NewVersion != 1 {
+		t.Errorf("got way result %+v, %v, want a new way at version 1", r, ok)
+	}
+	if r, ok := diff.Lookup("node", 1); !ok || r.NewID != 1 || r.NewVersion != 2 {
+		t.Errorf("got node 1 result %+v, %v, want version 2", r, ok)
+	}
+	if v := nodeVersion(t, client, apiBase, 1); v != 2 {
+		t.Errorf("node 1 is at version %d, want 2", v)
+	}
+}
+
+func TestUploadAllOrNothing(t *testing.T) {
+	apiBase, client := newTestAPI(t)
+	changesetID := openChangeset(t, client, apiBase)
+	b := osmchange.NewBuilder("test")
+	createNodes(b, 1)
+	b.ModifyNode(osmxml.Node{ID: 1, Version: 5, Lat: 44.43, Lon: 26.10}) // stale version
+
+	diff, err := osmchange.Upload(client, apiBase, changesetID, b)
+	if err == nil {
+		t.Fatalf("got %+v, want the stale node to fail the upload", diff)
+	}
+	if !strings.Contains(err.Error(), "409") {
+		t.Errorf("got error %v, want a version conflict", err)
+	}
+	if v := nodeVersion(t, client, apiBase, 1); v != 1 {
+		t.Errorf("node 1 is at version %d, want it unchanged", v)
+	}
+
+	// The node created along with the stale edit was rolled back, so the
+	// first node created now gets the first new ID
+	b = osmchange.NewBuilder("test")
+	first := createNodes(b, 1)[0]
+	diff, err = osmchange.Upload(client, apiBase, changesetID, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := diff.Lookup("node", first); !ok || nodeVersion(t, client, apiBase, r.NewID-1) != 0 || nodeVersion(t, client, apiBase, r.NewID) != 1 {
+		t.Errorf("got %+v, %v, want the node created right after the rolled back one", r, ok)
+	}
+}
+
+func TestUploadDelete(t *testing.T) {
+	apiBase, client := newTestAPI(t)
+	changesetID := openChangeset(t, client, apiBase)
+	b := osmchange.NewBuilder("test")
+	b.DeleteNode(1, 1)
+
+	diff, err := osmchange.Upload(client, apiBase, changesetID, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := diff.Lookup("node", 1); !ok || r.NewID != 0 || r.NewVersion != 0 {
+		t.Errorf("got %+v, %v, want a deleted node without a new ID", r, ok)
+	}
+	if v := nodeVersion(t, client, apiBase, 1); v != 0 {
+		t.Errorf("node 1 is still served at version %d", v)
+	}
+}
+
+func TestUploadUserAgent(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		io.WriteString(w, `<diffResult version="0.6"/>`)
+	}))
+	defer server.Close()
+
+	b := osmchange.NewBuilder("OSM Toilet Map")
+	b.DeleteNode(1, 1)
+	if _, err := osmchange.Upload(server.Client(), server.URL+"/api/0.6", 7, b); err != nil {
+		t.Fatal(err)
+	}
+	if userAgent != "OSM Toilet Map" {
+		t.Errorf("User-Agent = %q, want the generator", userAgent)
+	}
+}
+
+func TestUploadChunks(t *testing.T) {
+	apiBase, client := newTestAPI(t)
+	b := osmchange.NewBuilder("test")
+	nodes := createNodes(b, 3)
+	way := b.CreateWay(nodes, map[string]string{"highway": "footway"})
+	b.ModifyNode(osmxml.Node{ID: 1, Version: 1, Lat: 44.43, Lon: 26.10, Tags: osmxml.TagsFromMap(map[string]string{"amenity": "bench", "backrest": "yes"})})
+
+	var done []int
+	results, err := osmchange.UploadChunks(context.Background(), client, apiBase, b.Split(4), changesetFor(t, client, apiBase),
+		func(i int, result osmchange.ChunkResult) { done = append(done, i) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || !reflect.DeepEqual(done, []int{0, 1}) {
+		t.Fatalf("got %d results, done called for %v, want 2 chunks", len(results), done)
+	}
+	for i, result := range results {
+		if result.Status != osmchange.ChunkUploaded || result.Diff == nil {
+			t.Errorf("chunk %d: status %s, error %q, want uploaded", i, result.Status, result.Error)
+		}
+	}
+	if results[0].Changeset == results[1].Changeset {
+		t.Errorf("both chunks went to changeset %d", results[0].Changeset)
+	}
+	if r, ok := results[0].Diff.Lookup("way", way); !ok || r.NewID <= 0 || r.NewVersion != 1 {
+		t.Errorf("got way result %+v, %v, want a new way at version 1", r, ok)
+	}
+	if r, ok := results[1].Diff.Lookup("node", 1); !ok || r.NewID != 1 || r.NewVersion != 2 {
+		t.Errorf("got node result %+v, %v, want node 1 at version 2", r, ok)
+	}
+}
+
+func TestUploadChunksStopsAtFailure(t *testing.T) {
+	apiBase, client := newTestAPI(t)
+	b := osmchange.NewBuilder("test")
+	createNodes(b, 1)
+	b.ModifyNode(osmxml.Node{ID: 1, Version: 5, Lat: 44.43, Lon: 26.10}) // stale version
+	b.DeleteNode(1, 1)
+
+	var done []osmchange.ChunkResult
+	results, err := osmchange.UploadChunks(context.Background(), client, apiBase, b.Split(1), changesetFor(t, client, apiBase),
+		func(i int, result osmchange.ChunkResult) { done = append(done, result) })
+	if err == nil {
+		t.Fatal("got no error, want the stale node to fail")
+	}
+	var statuses []string
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	if want := []string{osmchange.ChunkUploaded, osmchange.ChunkFailed, osmchange.ChunkSkipped}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if results[1].Error == "" {
+		t.Error("the failed chunk has no error")
+	}
+	if len(done) != 2 || done[1].Status != osmchange.ChunkFailed {
+		t.Errorf("done called with %+v, want the uploaded and the failed chunk", done)
+	}
+}
+
+func createNodes(b *osmchange.Builder, n int) []int64 {
+	var ids []int64
+	for i := 0; i < n; i++ {
+		ids = append(ids, b.CreateNode(44.43+float64(i)/1000, 26.10, nil))
+	}
+	return ids
+}
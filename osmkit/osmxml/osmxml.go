@@ -0,0 +1,196 @@
+// osmxml/osmxml.go
+package osmxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// MaxTagLength is the maximum number of characters the OSM API accepts in a tag key or value.
+const MaxTagLength = 255
+
+// OSM is the <osm> document exchanged with the OSM API v0.6.
+type OSM struct {
+	XMLName    xml.Name    `xml:"osm"`
+	Version    string      `xml:"version,attr,omitempty"`
+	Generator  string      `xml:"generator,attr,omitempty"`
+	Changesets []Changeset `xml:"changeset"`
+	Nodes      []Node      `xml:"node"`
+	Ways       []Way       `xml:"way"`
+	Relations  []Relation  `xml:"relation"`
+}
+
+// Changeset is a <changeset> element. Only Tags are sent when creating one,
+// the other attributes are filled in when reading it back from the API.
+type Changeset struct {
+	ID           int64  `xml:"id,attr,omitempty"`
+	User         string `xml:"user,attr,omitempty"`
+	UID          int64  `xml:"uid,attr,omitempty"`
+	CreatedAt    string `xml:"created_at,attr,omitempty"`
+	ClosedAt     string `xml:"closed_at,attr,omitempty"`
+	Open         string `xml:"open,attr,omitempty"` // "true" or "false"
+	ChangesCount int    `xml:"changes_count,attr,omitempty"`
+	Tags         Tags   `xml:"tag"`
+}
+
+// IsOpen reports whether the API marked the changeset as open.
+func (c Changeset) IsOpen() bool {
+	return c.Open == "true"
+}
+
+// Node is a <node> element.
+type Node struct {
+	ID        int64   `xml:"id,attr,omitempty"`
+	Version   int     `xml:"version,attr,omitempty"`
+	Changeset int64   `xml:"changeset,attr,omitempty"`
+	Lat       float64 `xml:"lat,attr"`
+	Lon       float64 `xml:"lon,attr"`
+	Tags      Tags    `xml:"tag"`
+}
+
+// Way is a <way> element with its ordered node references.
+type Way struct {
+	ID        int64 `xml:"id,attr,omitempty"`
+	Version   int   `xml:"version,attr,omitempty"`
+	Changeset int64 `xml:"changeset,attr,omitempty"`
+	Nds       []Nd  `xml:"nd"`
+	Tags      Tags  `xml:"tag"`
+}
+
+// Nd is a node reference inside a way.
+type Nd struct {
+	Ref int64 `xml:"ref,attr"`
+}
+
+// Relation is a <relation> element.
+type Relation struct {
+	ID        int64    `xml:"id,attr,omitempty"`
+	Version   int      `xml:"version,attr,omitempty"`
+	Changeset int64    `xml:"changeset,attr,omitempty"`
+	Members   []Member `xml:"member"`
+	Tags      Tags     `xml:"tag"`
+}
+
+// Member is a relation member.
+type Member struct {
+	Type string `xml:"type,attr"`
+	Ref  int64  `xml:"ref,attr"`
+	Role string `xml:"role,attr"`
+}
+
+// Tag is a single k/v pair.
+type Tag struct {
+	Key   string `xml:"k,attr"`
+	Value string `xml:"v,attr"`
+}
+
+// Tags is an ordered list of tags.
+type Tags []Tag
+
+// TagError reports a tag the OSM API would reject.
+type TagError struct {
+	Key    string
+	Reason string
+}
+
+func (e *TagError) Error() string {
+	return fmt.Sprintf("invalid tag %q: %s", e.Key, e.Reason)
+}
+
+// TagsFromMap converts a tag map into Tags sorted by key, so the same map always
+// produces the same XML.
+func TagsFromMap(m map[string]string) Tags {
+	tags := make(Tags, 0, len(m))
+	for key, value := range m {
+		tags = append(tags, Tag{Key: key, Value: value})
+	}
+	tags.Sort()
+	return tags
+}
+
+// Map returns the tags as a map.
+func (t Tags) Map() map[string]string {
+	m := make(map[string]string, len(t))
+	for _, tag := range t {
+		m[tag.Key] = tag.Value
+	}
+	return m
+}
+
+// Sort orders the tags by key.
+func (t Tags) Sort() {
+	sort.Slice(t, func(i, j int) bool { return t[i].Key < t[j].Key })
+}
+
+// Validate checks every tag against the OSM API limits.
+func (t Tags) Validate() error {
+	for _, tag := range t {
+		if tag.Key == "" {
+			return &TagError{Key: tag.Key, Reason: "key is empty"}
+		}
+		if utf8.RuneCountInString(tag.Key) > MaxTagLength {
+			return &TagError{Key: tag.Key, Reason: fmt.Sprintf("key is longer than %d characters", MaxTagLength)}
+		}
+		if utf8.RuneCountInString(tag.Value) > MaxTagLength {
+			return &TagError{Key: tag.Key, Reason: fmt.Sprintf("value is longer than %d characters", MaxTagLength)}
+		}
+	}
+	return nil
+}
+
+// Validate checks the tags of every element in the document.
+func (o *OSM) Validate() error {
+	for _, c := range o.Changesets {
+		if err := c.Tags.Validate(); err != nil {
+			return fmt.Errorf("changeset: %w", err)
+		}
+	}
+	for _, n := range o.Nodes {
+		if err := n.Tags.Validate(); err != nil {
+			return fmt.Errorf("node %d: %w", n.ID, err)
+		}
+	}
+	for _, w := range o.Ways {
+		if err := w.Tags.Validate(); err != nil {
+			return fmt.Errorf("way %d: %w", w.ID, err)
+		}
+	}
+	for _, r := range o.Relations {
+		if err := r.Tags.Validate(); err != nil {
+			return fmt.Errorf("relation %d: %w", r.ID, err)
+		}
+	}
+	return nil
+}
+
+// Marshal validates the document and encodes it as an XML request body.
+func (o *OSM) Marshal() ([]byte, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(o); err != nil {
+		return nil, fmt.Errorf("failed to encode osm document: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode reads an <osm> document such as the response of GET /api/0.6/way/{id}.
+func Decode(r io.Reader) (*OSM, error) {
+	var o OSM
+	if err := xml.NewDecoder(r).Decode(&o); err != nil {
+		return nil, fmt.Errorf("failed to decode osm document: %v", err)
+	}
+	return &o, nil
+}
+
+// NewChangeset builds the document for PUT /api/0.6/changeset/create.
+func NewChangeset(tags map[string]string) *OSM {
+	return &OSM{Changesets: []Changeset{{Tags: TagsFromMap(tags)}}}
+}
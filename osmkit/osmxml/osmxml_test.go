@@ -0,0 +1,130 @@
+// osmxml/osmxml_test.go
+package osmxml
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"quotes", `Bistro "La Mama"`},
+		{"apostrophe", `Moara lui Călin's`},
+		{"ampersand", "Fish & Chips"},
+		{"angle brackets", "<b>not html</b>"},
+		{"entity lookalike", "&amp; &lt;"},
+		{"newline and tab", "line one\nline two\tend"},
+		{"diacritics", "Strada Ştefan cel Mare şi Sfânt"},
+		{"attribute breakout", `x" uid="1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &OSM{Nodes: []Node{{ID: -1, Changeset: 7, Lat: 44.43, Lon: 26.1, Tags: TagsFromMap(map[string]string{
+				"name":   tt.value,
+				tt.value: "as a key",
+			})}}}
+			body, err := doc.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(body, []byte("<?xml")) {
+				t.Errorf("body does not start with the XML header: %s", body)
+			}
+			for _, raw := range []string{`"La`, "& ", "<b>", `" uid=`} {
+				if strings.Contains(tt.value, raw) && bytes.Contains(body, []byte(raw)) {
+					t.Errorf("%q is not escaped in %s", raw, body)
+				}
+			}
+
+			decoded, err := Decode(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded.Nodes) != 1 {
+				t.Fatalf("got %d nodes back, want 1", len(decoded.Nodes))
+			}
+			if got, want := decoded.Nodes[0].Tags.Map(), doc.Nodes[0].Tags.Map(); !reflect.DeepEqual(got, want) {
+				t.Errorf("tags came back as %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestTagLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		key, value string
+		wantErr    bool
+	}{
+		{name: "longest key", key: strings.Repeat("k", MaxTagLength), value: "v"},
+		{name: "longest value", key: "name", value: strings.Repeat("v", MaxTagLength)},
+		{name: "longest value in diacritics", key: "name", value: strings.Repeat("ă", MaxTagLength)},
+		{name: "key too long", key: strings.Repeat("k", MaxTagLength+1), value: "v", wantErr: true},
+		{name: "value too long", key: "name", value: strings.Repeat("v", MaxTagLength+1), wantErr: true},
+		{name: "value too long in diacritics", key: "name", value: strings.Repeat("ă", MaxTagLength+1), wantErr: true},
+		{name: "empty key", key: "", value: "v", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &OSM{Ways: []Way{{ID: 100, Version: 1, Nds: []Nd{{Ref: 1}, {Ref: 2}}, Tags: Tags{{Key: tt.key, Value: tt.value}}}}}
+			body, err := doc.Marshal()
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var tagErr *TagError
+			if !errors.As(err, &tagErr) {
+				t.Fatalf("got error %v, want a *TagError", err)
+			}
+			if body != nil {
+				t.Errorf("got a body along with the error")
+			}
+		})
+	}
+}
+
+func TestDecodeWay(t *testing.T) {
+	const recorded = `<?xml version="1.0" encoding="UTF-8"?>
+<osm version="0.6" generator="openstreetmap-cgimap 2.0.1" copyright="OpenStreetMap and contributors">
+ <way id="100" visible="true" version="4" changeset="11" timestamp="2024-04-02T08:30:00Z" user="mapper" uid="7">
+  <nd ref="3"/>
+  <nd ref="1"/>
+  <nd ref="2"/>
+  <tag k="highway" v="residential"/>
+  <tag k="name" v="Strada &quot;Test&quot; &amp; Co"/>
+ </way>
+</osm>`
+	doc, err := Decode(strings.NewReader(recorded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Ways) != 1 {
+		t.Fatalf("got %d ways, want 1", len(doc.Ways))
+	}
+	way := doc.Ways[0]
+	if way.ID != 100 || way.Version != 4 || way.Changeset != 11 {
+		t.Errorf("got way %d version %d changeset %d, want way 100 version 4 changeset 11", way.ID, way.Version, way.Changeset)
+	}
+	if want := []Nd{{Ref: 3}, {Ref: 1}, {Ref: 2}}; !reflect.DeepEqual(way.Nds, want) {
+		t.Errorf("node refs = %v, want %v", way.Nds, want)
+	}
+	if name := way.Tags.Map()["name"]; name != `Strada "Test" & Co` {
+		t.Errorf("name = %q", name)
+	}
+}
+
+func TestTagsFromMap(t *testing.T) {
+	got := TagsFromMap(map[string]string{"name": "a", "highway": "b", "addr:street": "c"})
+	want := Tags{{Key: "addr:street", Value: "c"}, {Key: "highway", Value: "b"}, {Key: "name", Value: "a"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
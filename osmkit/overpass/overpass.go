@@ -0,0 +1,465 @@
+// overpass/overpass.go
+package overpass
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"osmkit/apperr"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// DefaultTimeout bounds a whole query, including retries and failover.
+	DefaultTimeout = 60 * time.Second
+	// DefaultAttempts is how often a query is sent to one mirror before
+	// moving on to the next.
+	DefaultAttempts = 3
+	// DefaultBackoff is the first retry delay; it doubles on every attempt.
+	DefaultBackoff = 500 * time.Millisecond
+	// DefaultMaxWait is the longest we wait for a rate limit slot of a mirror
+	// before trying another one instead.
+	DefaultMaxWait = 15 * time.Second
+	// DefaultCooldown is how long a failing mirror is tried last.
+	DefaultCooldown = time.Minute
+)
+
+// Client sends queries to a list of Overpass interpreter URLs. Mirrors are
+// tried in order; one that failed recently is tried after the healthy ones.
+// Identical queries running at the same time share one upstream call. It is
+// safe for concurrent use.
+type Client struct {
+	Mirrors    []string
+	HTTPClient *http.Client
+	UserAgent  string
+	Timeout    time.Duration
+	Attempts   int
+	Backoff    time.Duration
+	MaxWait    time.Duration
+	Cooldown   time.Duration
+
+	mu     sync.Mutex
+	failed map[string]time.Time // mirror -> time of its last failure
+	calls  map[string]*call     // normalised query -> call in flight
+}
+
+// call is an upstream query that concurrent callers wait on together.
+type call struct {
+	done   chan struct{}
+	result *Result
+	err    error
+}
+
+// New returns a Client using the given interpreter URLs and the defaults above.
+func New(mirrors ...string) *Client {
+	return &Client{
+		Mirrors:    mirrors,
+		HTTPClient: &http.Client{},
+		Timeout:    DefaultTimeout,
+		Attempts:   DefaultAttempts,
+		Backoff:    DefaultBackoff,
+		MaxWait:    DefaultMaxWait,
+		Cooldown:   DefaultCooldown,
+		failed:     make(map[string]time.Time),
+		calls:      make(map[string]*call),
+	}
+}
+
+// Result is the raw JSON answer to a query and where it came from.
+type Result struct {
+	Body []byte
+	// Mirror is the interpreter URL that served the result.
+	Mirror   string
+	Attempts int
+	Duration time.Duration
+	// Shared is set when the answer came from a call another caller started.
+	Shared bool
+}
+
+// Query runs an Overpass QL query and decodes the JSON answer into v. It
+// returns which mirror served it.
+func (c *Client) Query(ctx context.Context, query string, v interface{}) (*Result, error) {
+	result, err := c.Do(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(result.Body, v); err != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "error parsing Overpass response from %s", result.Mirror)
+	}
+	return result, nil
+}
+
+// Do runs an Overpass QL query and returns the raw JSON answer. Rate limited
+// and overloaded mirrors are retried with jittered backoff, then the next
+// mirror is tried, until one answers or the deadline passes.
+//
+// A caller asking for a query that is already running waits for that call
+// instead of starting another. The call is not cancelled when the caller that
+// started it gives up, since others may still be waiting; Timeout bounds it.
+func (c *Client) Do(ctx context.Context, query string) (*Result, error) {
+	key := normalize(query)
+	c.mu.Lock()
+	if c.calls == nil {
+		c.calls = make(map[string]*call)
+	}
+	cl, shared := c.calls[key]
+	if !shared {
+		cl = &call{done: make(chan struct{})}
+		c.calls[key] = cl
+		go func() {
+			cl.result, cl.err = c.do(context.WithoutCancel(ctx), query)
+			c.mu.Lock()
+			delete(c.calls, key)
+			c.mu.Unlock()
+			close(cl.done)
+		}()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+	case <-ctx.Done():
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, ctx.Err(), "Overpass query cancelled")
+	}
+	if cl.err != nil {
+		return nil, cl.err
+	}
+	result := *cl.result
+	result.Shared = shared
+	return &result, nil
+}
+
+// normalize returns the key identical queries share: the query without the
+// whitespace outside quoted strings, except single spaces between words.
+func normalize(query string) string {
+	var b strings.Builder
+	var quote, last rune
+	space := false
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		}
+		if space && isWord(last) && isWord(r) {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+		last = r
+	}
+	return b.String()
+}
+
+func isWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (c *Client) do(ctx context.Context, query string) (*Result, error) {
+	if len(c.Mirrors) == 0 {
+		return nil, apperr.New(apperr.Internal, "no Overpass mirror configured")
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	attempts := 0
+	var lastErr error
+	for _, mirror := range c.ordered() {
+		for attempt := 0; attempt < c.attempts(); attempt++ {
+			attempts++
+			body, err := c.post(ctx, mirror, query)
+			if err == nil {
+				c.markHealthy(mirror)
+				return &Result{Body: body, Mirror: mirror, Attempts: attempts, Duration: time.Since(start)}, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				return nil, apperr.Wrap(apperr.UpstreamUnavailable, lastErr, "Overpass query timed out after %d attempts", attempts)
+			}
+
+			var retry *retryError
+			if !errors.As(err, &retry) {
+				// The query itself is wrong, another mirror won't help
+				return nil, err
+			}
+			wait := retry.after
+			if wait < 0 {
+				slog.WarnContext(ctx, "Overpass mirror failed, trying the next one", "mirror", mirror, "error", err)
+				break
+			}
+			if wait == 0 {
+				wait = c.backoff(attempt)
+			}
+			slog.WarnContext(ctx, "Overpass mirror failed, retrying", "mirror", mirror, "attempt", attempt+1, "retry_in", wait.Round(time.Millisecond).String(), "error", err)
+			if !sleep(ctx, wait) {
+				return nil, apperr.Wrap(apperr.UpstreamUnavailable, lastErr, "Overpass query timed out after %d attempts", attempts)
+			}
+		}
+		c.markFailed(mirror)
+	}
+	return nil, fmt.Errorf("all Overpass mirrors failed: %w", lastErr)
+}
+
+// retryError marks a failure worth sending the query again for. after is the
+// delay the mirror asked for, 0 to use our backoff and negative to move on to
+// the next mirror straight away.
+type retryError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryError) Error() string { return e.err.Error() }
+func (e *retryError) Unwrap() error { return e.err }
+
+func (c *Client) post(ctx context.Context, mirror, query string) ([]byte, error) {
+	form := url.Values{"data": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, "POST", mirror, strings.NewReader(form))
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Internal, err, "invalid Overpass URL %s", mirror)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, &retryError{err: apperr.Wrap(apperr.UpstreamUnavailable, err, "error fetching data from %s", mirror)}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &retryError{err: apperr.Wrap(apperr.UpstreamUnavailable, err, "error reading response from %s", mirror)}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusBadRequest:
+		return nil, apperr.New(apperr.Validation, "Overpass rejected the query: %s", errorText(body))
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusGatewayTimeout:
+		// Too many queries from us, or the server is too busy: ask when a slot frees up
+		return nil, &retryError{
+			err:   apperr.FromStatus(resp.StatusCode, errorText(body), "Overpass mirror %s is busy", mirror),
+			after: c.slotWait(ctx, mirror, resp.Header.Get("Retry-After")),
+		}
+	default:
+		return nil, &retryError{err: apperr.FromStatus(resp.StatusCode, errorText(body), "error fetching data from %s", mirror)}
+	}
+
+	// Overpass answers errors with an HTML page, and runtime errors such as a
+	// query timeout with a remark next to incomplete data
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, &retryError{err: apperr.New(apperr.UpstreamUnavailable, "%s did not answer with JSON: %s", mirror, errorText(body))}
+	}
+	var remark struct {
+		Remark string `json:"remark"`
+	}
+	if json.Unmarshal(body, &remark) == nil && strings.Contains(remark.Remark, "error") {
+		return nil, &retryError{err: apperr.New(apperr.UpstreamUnavailable, "%s: %s", mirror, remark.Remark)}
+	}
+	return body, nil
+}
+
+// slotWait works out how long to wait before querying a rate limited mirror
+// again, from its Retry-After header or its /api/status page. It returns a
+// negative duration when the wait is longer than MaxWait.
+func (c *Client) slotWait(ctx context.Context, mirror, retryAfter string) time.Duration {
+	wait := time.Duration(0)
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if status, err := c.Status(ctx, mirror); err == nil {
+		wait = status.Wait()
+	}
+	if wait > c.maxWait() {
+		return -1
+	}
+	return wait
+}
+
+// Status is the slot information of a mirror's /api/status page.
+type Status struct {
+	RateLimit int
+	// SlotsAvailable is the number of queries we may start right now.
+	SlotsAvailable int
+	// NextSlot is when the next slot frees up if none is available.
+	NextSlot time.Duration
+}
+
+// Wait returns how long to wait before the next query may start.
+func (s Status) Wait() time.Duration {
+	if s.RateLimit == 0 || s.SlotsAvailable > 0 {
+		return 0
+	}
+	return s.NextSlot
+}
+
+// Status fetches the /api/status page that belongs to an interpreter URL.
+func (c *Client) Status(ctx context.Context, mirror string) (Status, error) {
+	statusURL := strings.TrimSuffix(mirror, "/interpreter") + "/status"
+	req, err := http.NewRequestWithContext(ctx, "GET", statusURL, nil)
+	if err != nil {
+		return Status{}, err
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return Status{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Status{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Status{}, fmt.Errorf("%s: status code %d", statusURL, resp.StatusCode)
+	}
+	return ParseStatus(string(body)), nil
+}
+
+// ParseStatus reads the lines of an /api/status page we care about:
+//
+//	Rate limit: 2
+//	1 slots available now.
+//	Slot available after: 2024-05-01T10:00:12Z, in 12 seconds.
+func ParseStatus(text string) Status {
+	var s Status
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Rate limit:"):
+			s.RateLimit, _ = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Rate limit:")))
+		case strings.HasSuffix(line, "slots available now."), strings.HasSuffix(line, "slot available now."):
+			s.SlotsAvailable, _ = strconv.Atoi(strings.Fields(line)[0])
+		case strings.HasPrefix(line, "Slot available after:"):
+			_, after, ok := strings.Cut(line, ", in ")
+			if !ok {
+				continue
+			}
+			seconds, err := strconv.Atoi(strings.Fields(after)[0])
+			if err != nil {
+				continue
+			}
+			if wait := time.Duration(seconds) * time.Second; s.NextSlot == 0 || wait < s.NextSlot {
+				s.NextSlot = wait
+			}
+		}
+	}
+	return s
+}
+
+// ordered returns the mirrors with the ones that failed within Cooldown last.
+func (c *Client) ordered() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var healthy, cooling []string
+	for _, m := range c.Mirrors {
+		if at, ok := c.failed[m]; ok && time.Since(at) < c.Cooldown {
+			cooling = append(cooling, m)
+		} else {
+			healthy = append(healthy, m)
+		}
+	}
+	return append(healthy, cooling...)
+}
+
+func (c *Client) markFailed(mirror string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failed == nil {
+		c.failed = make(map[string]time.Time)
+	}
+	c.failed[mirror] = time.Now()
+}
+
+func (c *Client) markHealthy(mirror string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.failed, mirror)
+}
+
+// backoff returns the delay before retry number attempt+1: Backoff doubled per
+// attempt, with half of it randomised so clients don't retry in lockstep.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.Backoff << attempt
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (c *Client) attempts() int {
+	if c.Attempts < 1 {
+		return 1
+	}
+	return c.Attempts
+}
+
+func (c *Client) maxWait() time.Duration {
+	if c.MaxWait <= 0 {
+		return DefaultMaxWait
+	}
+	return c.MaxWait
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// sleep waits for d or until ctx is done, reporting whether the full wait passed.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// errorText shortens an error page to something fit for a log line.
+func errorText(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if len(text) > 300 {
+		text = text[:300] + "..."
+	}
+	return text
+}
+
+// ParseMirrors splits a comma separated list of interpreter URLs, as found in
+// the OVERPASS_URL setting of the maps.
+func ParseMirrors(list string) []string {
+	var mirrors []string
+	for _, m := range strings.Split(list, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			mirrors = append(mirrors, m)
+		}
+	}
+	return mirrors
+}
@@ -0,0 +1,325 @@
+// overpass/overpass_test.go
+package overpass
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"osmkit/apperr"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Status
+	}{
+		{
+			name: "slots available",
+			text: `Connected as: 1234567890
+Current time: 2024-05-01T10:00:00Z
+Announced endpoint: gall.openstreetmap.de/
+Rate limit: 2
+2 slots available now.
+Currently running queries (pid, space limit, time limit, start time):
+`,
+			want: Status{RateLimit: 2, SlotsAvailable: 2},
+		},
+		{
+			name: "one slot",
+			text: "Rate limit: 2\n1 slot available now.\nSlot available after: 2024-05-01T10:00:12Z, in 12 seconds.\n",
+			want: Status{RateLimit: 2, SlotsAvailable: 1, NextSlot: 12 * time.Second},
+		},
+		{
+			name: "busy, earliest slot wins",
+			text: `Rate limit: 2
+Slot available after: 2024-05-01T10:00:40Z, in 40 seconds.
+Slot available after: 2024-05-01T10:00:07Z, in 7 seconds.
+Currently running queries (pid, space limit, time limit, start time):
+`,
+			want: Status{RateLimit: 2, NextSlot: 7 * time.Second},
+		},
+		{
+			name: "no rate limit",
+			text: "Rate limit: 0\n",
+			want: Status{},
+		},
+		{
+			name: "windows line endings",
+			text: "Rate limit: 3\r\n0 slots available now.\r\nSlot available after: 2024-05-01T10:00:03Z, in 3 seconds.\r\n",
+			want: Status{RateLimit: 3, NextSlot: 3 * time.Second},
+		},
+		{
+			name: "unexpected slot line",
+			text: "Rate limit: 2\nSlot available after: soon\nSlot available after: 2024-05-01T10:00:03Z, in a while.\n",
+			want: Status{RateLimit: 2},
+		},
+		{
+			name: "not a status page",
+			text: "<html><body>502 Bad Gateway</body></html>",
+			want: Status{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseStatus(tt.text); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusWait(t *testing.T) {
+	tests := []struct {
+		status Status
+		want   time.Duration
+	}{
+		{Status{}, 0},
+		{Status{RateLimit: 2, SlotsAvailable: 1, NextSlot: 12 * time.Second}, 0},
+		{Status{RateLimit: 2, NextSlot: 12 * time.Second}, 12 * time.Second},
+		{Status{NextSlot: 12 * time.Second}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.status.Wait(); got != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"[out:json];\n  node[\"amenity\"](1,2,3,4);\n  out body;", `[out:json];node["amenity"](1,2,3,4);out body;`},
+		{"out   body ;", "out body;"},
+		{`node["name"="Strada  Mare"];`, `node["name"="Strada  Mare"];`},
+		{"node['name'='a  b'] ;", "node['name'='a  b'];"},
+	}
+	for _, tt := range tests {
+		if got := normalize(tt.query); got != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseMirrors(t *testing.T) {
+	got := ParseMirrors(" https://a.example/api/interpreter,,https://b.example/api/interpreter ")
+	want := []string{"https://a.example/api/interpreter", "https://b.example/api/interpreter"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := ParseMirrors(""); got != nil {
+		t.Errorf("got %q for an empty list, want nil", got)
+	}
+}
+
+func TestClientStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/status" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "Rate limit: 2\nSlot available after: 2024-05-01T10:00:05Z, in 5 seconds.\n")
+	}))
+	defer server.Close()
+
+	status, err := New().Status(context.Background(), server.URL+"/api/interpreter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Status{RateLimit: 2, NextSlot: 5 * time.Second}); status != want {
+		t.Errorf("got %+v, want %+v", status, want)
+	}
+}
+
+// mirror answers every query with status and body, counting the queries.
+type mirror struct {
+	status int
+	header map[string]string
+	body   string
+	calls  atomic.Int32
+}
+
+func (m *mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.calls.Add(1)
+	for key, value := range m.header {
+		w.Header().Set(key, value)
+	}
+	w.WriteHeader(m.status)
+	fmt.Fprint(w, m.body)
+}
+
+func TestDo(t *testing.T) {
+	const answer = `{"version":0.6,"elements":[]}`
+	tests := []struct {
+		name       string
+		first      *mirror
+		wantMirror int // index of the mirror that answers, -1 for an error
+		wantCalls  int32
+		wantKind   apperr.Kind
+	}{
+		{
+			name:       "first mirror answers",
+			first:      &mirror{status: http.StatusOK, body: answer},
+			wantMirror: 0,
+			wantCalls:  1,
+		},
+		{
+			name:       "overloaded mirror is retried, then skipped",
+			first:      &mirror{status: http.StatusServiceUnavailable, body: "<html>overloaded</html>"},
+			wantMirror: 1,
+			wantCalls:  2,
+		},
+		{
+			name:       "runtime error remark",
+			first:      &mirror{status: http.StatusOK, body: `{"elements":[],"remark":"runtime error: Query timed out"}`},
+			wantMirror: 1,
+			wantCalls:  2,
+		},
+		{
+			name:       "rate limited for longer than MaxWait",
+			first:      &mirror{status: http.StatusTooManyRequests, header: map[string]string{"Retry-After": "120"}},
+			wantMirror: 1,
+			wantCalls:  1,
+		},
+		{
+			name:       "bad query",
+			first:      &mirror{status: http.StatusBadRequest, body: "Error: line 1: parse error"},
+			wantMirror: -1,
+			wantCalls:  1,
+			wantKind:   apperr.Validation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := httptest.NewServer(tt.first)
+			defer first.Close()
+			second := httptest.NewServer(&mirror{status: http.StatusOK, body: answer})
+			defer second.Close()
+			mirrors := []string{first.URL + "/api/interpreter", second.URL + "/api/interpreter"}
+
+			c := New(mirrors...)
+			c.Attempts = 2
+			c.Backoff = time.Millisecond
+			result, err := c.Do(context.Background(), "[out:json];node(1);out;")
+			if tt.wantMirror < 0 {
+				if !apperr.Is(err, tt.wantKind) {
+					t.Fatalf("got error %v, want %s", err, tt.wantKind)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Mirror != mirrors[tt.wantMirror] || string(result.Body) != answer {
+					t.Errorf("got %s from %s, want the answer of mirror %d", result.Body, result.Mirror, tt.wantMirror)
+				}
+			}
+			if calls := tt.first.calls.Load(); calls != tt.wantCalls {
+				t.Errorf("first mirror got %d queries, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoShared(t *testing.T) {
+	const answer = `{"version":0.6,"elements":[]}`
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		started <- struct{}{}
+		<-release
+		fmt.Fprint(w, answer)
+	}))
+	defer server.Close()
+	c := New(server.URL + "/api/interpreter")
+
+	queries := []string{
+		"[out:json];node(1);out;",
+		"[out:json];\n  node(1);\n  out;",
+		"[out:json]; node(1) ; out ;",
+	}
+	results := make([]*Result, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	run := func(i int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = c.Do(context.Background(), queries[i])
+		}()
+	}
+
+	// The first query is held by the server while the others arrive
+	run(0)
+	<-started
+	for i := 1; i < len(queries); i++ {
+		run(i)
+	}
+	// Give the others time to find the call in flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("the server got %d queries, want 1", n)
+	}
+	shared := 0
+	for i, result := range results {
+		if errs[i] != nil {
+			t.Fatalf("query %d: %v", i, errs[i])
+		}
+		if string(result.Body) != answer {
+			t.Errorf("query %d got %s", i, result.Body)
+		}
+		if result.Shared {
+			shared++
+		}
+	}
+	if shared != len(queries)-1 {
+		t.Errorf("%d results were shared, want %d", shared, len(queries)-1)
+	}
+}
+
+func TestDoWaiterGivesUp(t *testing.T) {
+	const answer = `{"version":0.6,"elements":[]}`
+	release := make(chan struct{})
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		fmt.Fprint(w, answer)
+	}))
+	defer server.Close()
+	c := New(server.URL + "/api/interpreter")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Do(ctx, "[out:json];node(1);out;"); !apperr.Is(err, apperr.UpstreamUnavailable) {
+		t.Errorf("got error %v from a cancelled caller, want upstream unavailable", err)
+	}
+
+	// The call the cancelled caller started keeps running for the next one
+	done := make(chan *Result)
+	go func() {
+		result, err := c.Do(context.Background(), "[out:json];node(1);out;")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- result
+	}()
+	close(release)
+	if result := <-done; result == nil || string(result.Body) != answer {
+		t.Errorf("got %+v, want the answer", result)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("the server got %d queries, want 1", n)
+	}
+}
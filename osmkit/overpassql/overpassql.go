@@ -0,0 +1,536 @@
+// overpassql/overpassql.go
+package overpassql
+
+import (
+	"fmt"
+	"osmkit/apperr"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StatementKind identifies what a top-level statement does.
+type StatementKind int
+
+const (
+	Select  StatementKind = iota // node[...](...) / way[...](...) / area[...]
+	Union                        // ( ...; ...; )
+	Out                          // out body / out skel / out geom ...
+	Recurse                      // > / >> / < / <<
+)
+
+// Query is a parsed Overpass QL query. Only the subset used by the maps is
+// understood: settings, tag filters, bbox and area filters, unions, recursion
+// and out statements.
+type Query struct {
+	Settings   map[string]string
+	Statements []Statement
+}
+
+// Statement is one ';'-terminated statement.
+type Statement struct {
+	Kind     StatementKind
+	Selector *Selector  // Select
+	Union    []Selector // Union
+	Out      []string   // Out: verbosity and modifiers, e.g. ["skel", "qt"]
+	Recurse  string     // Recurse: the operator
+	Into     string     // ->.name, empty for the default set
+}
+
+// Selector is a single query clause such as node["amenity"="toilets"](bbox).
+type Selector struct {
+	Type    string // node, way, relation, nwr or area
+	Filters []Filter
+	BBox    *BBox
+	Area    string // name of the area set used as spatial filter
+}
+
+// Filter is a tag filter inside square brackets.
+type Filter struct {
+	Key             string
+	Op              string // "", "!", "=", "!=", "~", "!~"
+	Value           string
+	CaseInsensitive bool // the ",i" flag of regular expression filters
+	regexp          *regexp.Regexp
+}
+
+// BBox is an Overpass bounding box (south, west, north, east).
+type BBox struct {
+	South, West, North, East float64
+}
+
+// ParseBBox parses the "south,west,north,east" form used by Overpass and the /data endpoints.
+// A box with south above north or west east of east, or outside the valid
+// latitudes and longitudes, is a Validation error.
+func ParseBBox(s string) (BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BBox{}, apperr.New(apperr.Validation, "bbox %q must have 4 comma separated values", s)
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return BBox{}, apperr.Wrap(apperr.Validation, err, "bbox %q must be 4 numbers", s)
+		}
+		v[i] = f
+	}
+	b := BBox{South: v[0], West: v[1], North: v[2], East: v[3]}
+	switch {
+	case !within(b.South, 90) || !within(b.North, 90):
+		return BBox{}, apperr.New(apperr.Validation, "bbox %q: latitudes must be from -90 to 90", s)
+	case !within(b.West, 180) || !within(b.East, 180):
+		return BBox{}, apperr.New(apperr.Validation, "bbox %q: longitudes must be from -180 to 180", s)
+	case b.South > b.North:
+		return BBox{}, apperr.New(apperr.Validation, "bbox %q: south %g is north of north %g", s, b.South, b.North)
+	case b.West > b.East:
+		return BBox{}, apperr.New(apperr.Validation, "bbox %q: west %g is east of east %g", s, b.West, b.East)
+	}
+	return b, nil
+}
+
+// within reports whether v is from -limit to limit, false for NaN.
+func within(v, limit float64) bool {
+	return v >= -limit && v <= limit
+}
+
+// Contains reports whether the point lies inside the box.
+func (b BBox) Contains(lat, lon float64) bool {
+	return lat >= b.South && lat <= b.North && lon >= b.West && lon <= b.East
+}
+
+// String formats the box the way Overpass expects it.
+func (b BBox) String() string {
+	return fmt.Sprintf("%g,%g,%g,%g", b.South, b.West, b.North, b.East)
+}
+
+// MarshalText and UnmarshalText read and write the box in the form of
+// ParseBBox, as in configuration files.
+func (b BBox) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *BBox) UnmarshalText(text []byte) error {
+	parsed, err := ParseBBox(string(text))
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
+
+// Match reports whether the tags satisfy the filter.
+func (f Filter) Match(tags map[string]string) bool {
+	value, ok := tags[f.Key]
+	switch f.Op {
+	case "":
+		return ok
+	case "!":
+		return !ok
+	case "=":
+		return ok && value == f.Value
+	case "!=":
+		return !ok || value != f.Value
+	case "~":
+		return ok && f.regexp.MatchString(value)
+	case "!~":
+		return !ok || !f.regexp.MatchString(value)
+	}
+	return false
+}
+
+// String formats the filter as Overpass QL, e.g. ["amenity"="toilets"].
+func (f Filter) String() string {
+	switch f.Op {
+	case "":
+		return "[" + quote(f.Key) + "]"
+	case "!":
+		return "[!" + quote(f.Key) + "]"
+	}
+	flag := ""
+	if f.CaseInsensitive {
+		flag = ",i"
+	}
+	return "[" + quote(f.Key) + f.Op + quote(f.Value) + flag + "]"
+}
+
+// String formats the selector as Overpass QL, without the trailing ';'.
+func (s Selector) String() string {
+	var b strings.Builder
+	b.WriteString(s.Type)
+	for _, f := range s.Filters {
+		b.WriteString(f.String())
+	}
+	switch {
+	case s.BBox != nil:
+		b.WriteString("(" + s.BBox.String() + ")")
+	case s.Area == "_":
+		b.WriteString("(area)")
+	case s.Area != "":
+		b.WriteString("(area." + s.Area + ")")
+	}
+	return b.String()
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// MatchTags reports whether all tag filters of the selector match.
+func (s Selector) MatchTags(tags map[string]string) bool {
+	for _, f := range s.Filters {
+		if !f.Match(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchType reports whether the selector applies to the given element type.
+func (s Selector) MatchType(elemType string) bool {
+	return s.Type == elemType || (s.Type == "nwr" && elemType != "area")
+}
+
+// Selectors returns every node/way/relation selector of the query, including
+// those inside unions. Area definitions are left out.
+func (q *Query) Selectors() []Selector {
+	var selectors []Selector
+	for _, st := range q.Statements {
+		switch st.Kind {
+		case Select:
+			if st.Selector.Type != "area" {
+				selectors = append(selectors, *st.Selector)
+			}
+		case Union:
+			for _, s := range st.Union {
+				if s.Type != "area" {
+					selectors = append(selectors, s)
+				}
+			}
+		}
+	}
+	return selectors
+}
+
+// Match reports whether an element with the given type and tags is selected
+// by any clause of the query, ignoring spatial filters.
+func (q *Query) Match(elemType string, tags map[string]string) bool {
+	for _, s := range q.Selectors() {
+		if s.MatchType(elemType) && s.MatchTags(tags) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses an Overpass QL query.
+func Parse(query string) (*Query, error) {
+	p := &parser{src: query}
+	q := &Query{Settings: map[string]string{}}
+
+	p.skipSpace()
+	for p.peek() == '[' {
+		key, value, err := p.setting()
+		if err != nil {
+			return nil, err
+		}
+		q.Settings[key] = value
+		p.skipSpace()
+	}
+	if p.peek() == ';' {
+		p.pos++
+	}
+
+	for {
+		p.skipSpace()
+		if p.eof() {
+			break
+		}
+		st, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		q.Statements = append(q.Statements, st)
+	}
+	return q, nil
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("overpassql: at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// setting parses [key:value].
+func (p *parser) setting() (string, string, error) {
+	end := strings.IndexByte(p.src[p.pos:], ']')
+	if end < 0 {
+		return "", "", p.errorf("unterminated setting")
+	}
+	body := p.src[p.pos+1 : p.pos+end]
+	p.pos += end + 1
+	key, value, _ := strings.Cut(body, ":")
+	return strings.TrimSpace(key), strings.TrimSpace(value), nil
+}
+
+func (p *parser) word() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.src[p.pos]
+		if c == '_' || c == ':' || c == '-' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) statement() (Statement, error) {
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		var union []Selector
+		for {
+			p.skipSpace()
+			if p.peek() == ')' {
+				p.pos++
+				break
+			}
+			if p.eof() {
+				return Statement{}, p.errorf("unterminated union")
+			}
+			sel, err := p.selector()
+			if err != nil {
+				return Statement{}, err
+			}
+			if err := p.expect(';'); err != nil {
+				return Statement{}, err
+			}
+			union = append(union, *sel)
+		}
+		into := p.into()
+		return Statement{Kind: Union, Union: union, Into: into}, p.expect(';')
+	case c == '>' || c == '<':
+		start := p.pos
+		for p.peek() == '>' || p.peek() == '<' {
+			p.pos++
+		}
+		op := p.src[start:p.pos]
+		into := p.into()
+		return Statement{Kind: Recurse, Recurse: op, Into: into}, p.expect(';')
+	}
+
+	start := p.pos
+	if p.word() == "out" {
+		end := strings.IndexByte(p.src[p.pos:], ';')
+		if end < 0 {
+			end = len(p.src) - p.pos
+		}
+		fields := strings.Fields(p.src[p.pos : p.pos+end])
+		p.pos += end
+		if !p.eof() {
+			p.pos++
+		}
+		return Statement{Kind: Out, Out: fields}, nil
+	}
+	p.pos = start
+
+	sel, err := p.selector()
+	if err != nil {
+		return Statement{}, err
+	}
+	into := p.into()
+	return Statement{Kind: Select, Selector: sel, Into: into}, p.expect(';')
+}
+
+func (p *parser) into() string {
+	p.skipSpace()
+	if !strings.HasPrefix(p.src[p.pos:], "->") {
+		return ""
+	}
+	p.pos += 2
+	p.skipSpace()
+	if p.peek() == '.' {
+		p.pos++
+	}
+	return p.word()
+}
+
+func (p *parser) selector() (*Selector, error) {
+	p.skipSpace()
+	typ := p.word()
+	switch typ {
+	case "node", "way", "relation", "nwr", "area":
+	case "rel":
+		typ = "relation"
+	default:
+		return nil, p.errorf("unsupported statement %q", typ)
+	}
+
+	sel := &Selector{Type: typ}
+	for {
+		p.skipSpace()
+		switch p.peek() {
+		case '[':
+			f, err := p.filter()
+			if err != nil {
+				return nil, err
+			}
+			sel.Filters = append(sel.Filters, f)
+		case '(':
+			if err := p.spatial(sel); err != nil {
+				return nil, err
+			}
+		default:
+			return sel, nil
+		}
+	}
+}
+
+func (p *parser) quotedOrBare(stop string) (string, error) {
+	p.skipSpace()
+	if q := p.peek(); q == '"' || q == '\'' {
+		p.pos++
+		var b strings.Builder
+		for !p.eof() && p.src[p.pos] != q {
+			if p.src[p.pos] == '\\' && p.pos+1 < len(p.src) {
+				p.pos++
+			}
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+		}
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		p.pos++
+		return b.String(), nil
+	}
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(stop, rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return strings.TrimSpace(p.src[start:p.pos]), nil
+}
+
+// filter parses ["key"], [!key], ["key"="value"], ["key"~"regex",i] and friends.
+func (p *parser) filter() (Filter, error) {
+	p.pos++ // [
+	p.skipSpace()
+	var f Filter
+	negated := p.peek() == '!'
+	if negated {
+		p.pos++
+	}
+	key, err := p.quotedOrBare("=!~]")
+	if err != nil {
+		return f, err
+	}
+	f.Key = key
+
+	p.skipSpace()
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "!="):
+		f.Op = "!="
+	case strings.HasPrefix(p.src[p.pos:], "!~"):
+		f.Op = "!~"
+	case p.peek() == '=':
+		f.Op = "="
+	case p.peek() == '~':
+		f.Op = "~"
+	}
+	p.pos += len(f.Op)
+	if negated {
+		if f.Op != "" {
+			return f, p.errorf("unexpected operator after negated key %q", key)
+		}
+		f.Op = "!"
+	}
+
+	if f.Op != "" && f.Op != "!" {
+		value, err := p.quotedOrBare("],")
+		if err != nil {
+			return f, err
+		}
+		f.Value = value
+	}
+
+	p.skipSpace()
+	caseInsensitive := false
+	if p.peek() == ',' {
+		p.pos++
+		p.skipSpace()
+		caseInsensitive = p.word() == "i"
+	}
+	if err := p.expect(']'); err != nil {
+		return f, err
+	}
+
+	if f.Op == "~" || f.Op == "!~" {
+		f.CaseInsensitive = caseInsensitive
+		expr := f.Value
+		if caseInsensitive {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return f, p.errorf("invalid regular expression %q: %v", f.Value, err)
+		}
+		f.regexp = re
+	}
+	return f, nil
+}
+
+// spatial parses (south,west,north,east) and (area.name).
+func (p *parser) spatial(sel *Selector) error {
+	end := strings.IndexByte(p.src[p.pos:], ')')
+	if end < 0 {
+		return p.errorf("unterminated spatial filter")
+	}
+	body := strings.TrimSpace(p.src[p.pos+1 : p.pos+end])
+	p.pos += end + 1
+
+	switch {
+	case body == "area":
+		sel.Area = "_"
+	case strings.HasPrefix(body, "area."):
+		sel.Area = strings.TrimPrefix(body, "area.")
+	case strings.Contains(body, "{{bbox}}"):
+		return p.errorf("bbox placeholder was not substituted")
+	default:
+		bbox, err := ParseBBox(body)
+		if err != nil {
+			return p.errorf("unsupported spatial filter %q", body)
+		}
+		sel.BBox = &bbox
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// overpassql/overpassql_test.go
+package overpassql
+
+import (
+	"osmkit/apperr"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// describe formats a statement on one line, for comparing parses.
+func describe(st Statement) string {
+	var s string
+	switch st.Kind {
+	case Select:
+		s = st.Selector.String()
+	case Union:
+		var parts []string
+		for _, sel := range st.Union {
+			parts = append(parts, sel.String()+";")
+		}
+		s = "(" + strings.Join(parts, "") + ")"
+	case Recurse:
+		s = st.Recurse
+	case Out:
+		s = "out " + strings.Join(st.Out, " ")
+	}
+	if st.Into != "" {
+		s += "->." + st.Into
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		settings   map[string]string
+		statements []string
+	}{
+		{
+			name:       "bbox",
+			query:      `[out:json][timeout:25];node["amenity"="toilets"](44.3,25.9,44.6,26.3);out body;`,
+			settings:   map[string]string{"out": "json", "timeout": "25"},
+			statements: []string{`node["amenity"="toilets"](44.3,25.9,44.6,26.3)`, "out body"},
+		},
+		{
+			name:       "union",
+			query:      "[out:json];(\n  node[amenity=drinking_water](1,2,3,4);\n  way[\"highway\"](1,2,3,4);\n);\nout meta geom;",
+			settings:   map[string]string{"out": "json"},
+			statements: []string{`(node["amenity"="drinking_water"](1,2,3,4);way["highway"](1,2,3,4);)`, "out meta geom"},
+		},
+		{
+			name:     "area",
+			query:    `area["ISO3166-1"="RO"]->.ro; nwr["shop"](area.ro); out center;`,
+			settings: map[string]string{},
+			statements: []string{
+				`area["ISO3166-1"="RO"]->.ro`,
+				`nwr["shop"](area.ro)`,
+				"out center",
+			},
+		},
+		{
+			name:       "recurse",
+			query:      `way["highway"](1,2,3,4);>;out skel qt;`,
+			settings:   map[string]string{},
+			statements: []string{`way["highway"](1,2,3,4)`, ">", "out skel qt"},
+		},
+		{
+			name:       "rel and negated filters",
+			query:      `rel[!"name"]["type"!="route"](1,2,3,4);out;`,
+			settings:   map[string]string{},
+			statements: []string{`relation[!"name"]["type"!="route"](1,2,3,4)`, "out "},
+		},
+		{
+			name:       "regular expression",
+			query:      `node["name"~"^strada",i]["addr:street"!~"x"](1,2,3,4);`,
+			settings:   map[string]string{},
+			statements: []string{`node["name"~"^strada",i]["addr:street"!~"x"](1,2,3,4)`},
+		},
+		{
+			name:       "escaped quote",
+			query:      `node["name"="La \"Mama\""](1,2,3,4);`,
+			settings:   map[string]string{},
+			statements: []string{`node["name"="La \"Mama\""](1,2,3,4)`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(q.Settings, tt.settings) {
+				t.Errorf("settings = %v, want %v", q.Settings, tt.settings)
+			}
+			var got []string
+			for _, st := range q.Statements {
+				got = append(got, describe(st))
+			}
+			if !reflect.DeepEqual(got, tt.statements) {
+				t.Errorf("statements =\n%q\nwant\n%q", got, tt.statements)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"unterminated setting", `[out:json`},
+		{"unsupported statement", `foreach(1,2,3,4);`},
+		{"unterminated union", `(node(1,2,3,4);`},
+		{"missing semicolon", `node(1,2,3,4) out;`},
+		{"unterminated string", `node["amenity"="toilets](1,2,3,4);`},
+		{"bad regular expression", `node["name"~"("](1,2,3,4);`},
+		{"operator after negation", `node[!"name"="x"](1,2,3,4);`},
+		{"placeholder left", `node["amenity"]({{bbox}});`},
+		{"bad bbox", `node["amenity"](1,2,3);`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if q, err := Parse(tt.query); err == nil {
+				t.Errorf("got %d statements, want an error", len(q.Statements))
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	tags := map[string]string{"amenity": "toilets", "name": "Strada Mare"}
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`["amenity"]`, true},
+		{`["shop"]`, false},
+		{`[!"shop"]`, true},
+		{`[!"amenity"]`, false},
+		{`["amenity"="toilets"]`, true},
+		{`["amenity"="cafe"]`, false},
+		{`["amenity"!="cafe"]`, true},
+		{`["shop"!="cafe"]`, true},
+		{`["name"~"^Strada"]`, true},
+		{`["name"~"^strada"]`, false},
+		{`["name"~"^strada",i]`, true},
+		{`["name"!~"Mare$"]`, false},
+		{`["shop"!~"x"]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			q, err := Parse("node" + tt.filter + "(1,2,3,4);")
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := q.Statements[0].Selector.Filters[0]
+			if got := f.Match(tags); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	q, err := Parse(`area["name"="Bucuresti"]->.a;(node["amenity"="toilets"](area.a);nwr["toilets"="yes"](area.a););out;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		elemType string
+		tags     map[string]string
+		want     bool
+	}{
+		{"node", map[string]string{"amenity": "toilets"}, true},
+		{"way", map[string]string{"amenity": "toilets"}, false},
+		{"way", map[string]string{"toilets": "yes"}, true},
+		{"area", map[string]string{"name": "Bucuresti"}, false},
+		{"node", map[string]string{"amenity": "cafe"}, false},
+	}
+	for _, tt := range tests {
+		if got := q.Match(tt.elemType, tt.tags); got != tt.want {
+			t.Errorf("Match(%s, %v) = %v, want %v", tt.elemType, tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestParseBBox(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    BBox
+		wantErr bool
+	}{
+		{in: "44.3,25.9,44.6,26.3", want: BBox{South: 44.3, West: 25.9, North: 44.6, East: 26.3}},
+		{in: " 44.3, 25.9 ,44.6,26.3 ", want: BBox{South: 44.3, West: 25.9, North: 44.6, East: 26.3}},
+		{in: "44.3,25.9,44.6", wantErr: true},
+		{in: "44.3,25.9,44.6,east", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "-90,-180,90,180", want: BBox{South: -90, West: -180, North: 90, East: 180}},
+		{in: "44.43,26.1,44.43,26.1", want: BBox{South: 44.43, West: 26.1, North: 44.43, East: 26.1}},
+		{in: "44.6,25.9,44.3,26.3", wantErr: true}, // south above north
+		{in: "44.3,26.3,44.6,25.9", wantErr: true}, // west east of east
+		{in: "-91,25.9,44.6,26.3", wantErr: true},
+		{in: "44.3,25.9,90.5,26.3", wantErr: true},
+		{in: "44.3,-181,44.6,26.3", wantErr: true},
+		{in: "44.3,25.9,44.6,200", wantErr: true},
+		{in: "NaN,25.9,44.6,26.3", wantErr: true},
+		{in: "44.3,25.9,44.6,Inf", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBBox(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseBBox(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil && !apperr.Is(err, apperr.Validation) {
+			t.Errorf("ParseBBox(%q) error = %v, want a validation error", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseBBox(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+	if b := (BBox{South: 44.3, West: 25.9, North: 44.6, East: 26.3}); !b.Contains(44.4, 26) || b.Contains(44.7, 26) {
+		t.Errorf("Contains is wrong for %v", b)
+	}
+}
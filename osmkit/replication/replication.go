@@ -0,0 +1,159 @@
+// replication/replication.go
+package replication
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"osmkit/apperr"
+	"osmkit/osmchange"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMinutely is the minutely replication feed of openstreetmap.org.
+const DefaultMinutely = "https://planet.openstreetmap.org/replication/minute"
+
+// State is the content of a state.txt file: the sequence number of the
+// newest diff and the time of the data it brings up to.
+type State struct {
+	Sequence  int64
+	Timestamp time.Time
+}
+
+// ParseState reads a state.txt file, a Java properties file whose colons are
+// escaped.
+func ParseState(r io.Reader) (State, error) {
+	var st State
+	var haveSequence bool
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.ReplaceAll(value, `\:`, ":")
+		switch key {
+		case "sequenceNumber":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return st, fmt.Errorf("invalid sequenceNumber %q", value)
+			}
+			st.Sequence = n
+			haveSequence = true
+		case "timestamp":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return st, fmt.Errorf("invalid timestamp %q", value)
+			}
+			st.Timestamp = t
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return st, err
+	}
+	if !haveSequence {
+		return st, fmt.Errorf("state has no sequenceNumber")
+	}
+	return st, nil
+}
+
+// Path returns the location of a diff below the replication root, for example
+// 006/123/456 for sequence 6123456.
+func Path(sequence int64) string {
+	return fmt.Sprintf("%03d/%03d/%03d", sequence/1000000, sequence/1000%1000, sequence%1000)
+}
+
+// Source reads a replication feed laid out like planet.openstreetmap.org:
+// state.txt at the root and diffs at Path(sequence) + ".osc.gz". Base is an
+// http(s) URL or a local directory.
+type Source struct {
+	Base       string
+	HTTPClient *http.Client
+	UserAgent  string
+}
+
+// NewSource returns a Source for the given URL or directory.
+func NewSource(base string) *Source {
+	return &Source{Base: strings.TrimSuffix(base, "/"), HTTPClient: &http.Client{Timeout: time.Minute}}
+}
+
+// State returns the state of the newest diff.
+func (s *Source) State(ctx context.Context) (State, error) {
+	body, err := s.open(ctx, "state.txt")
+	if err != nil {
+		return State{}, err
+	}
+	defer body.Close()
+	st, err := ParseState(body)
+	if err != nil {
+		return st, fmt.Errorf("%s/state.txt: %w", s.Base, err)
+	}
+	return st, nil
+}
+
+// Diff returns the changes of the diff with the given sequence number.
+func (s *Source) Diff(ctx context.Context, sequence int64) ([]osmchange.Change, error) {
+	name := Path(sequence) + ".osc.gz"
+	body, err := s.open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %v", s.Base, name, err)
+	}
+	defer gz.Close()
+	changes, err := osmchange.Decode(gz)
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", s.Base, name, err)
+	}
+	return changes, nil
+}
+
+func (s *Source) remote() bool {
+	return strings.HasPrefix(s.Base, "http://") || strings.HasPrefix(s.Base, "https://")
+}
+
+// open returns a file below the root of the feed.
+func (s *Source) open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if !s.remote() {
+		f, err := os.Open(filepath.Join(s.Base, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			return nil, apperr.Wrap(apperr.Gone, err, "replication file missing")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Base+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.UserAgent != "" {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.UpstreamUnavailable, err, "error fetching %s", req.URL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, apperr.FromStatus(resp.StatusCode, string(body), "error fetching %s", req.URL)
+	}
+	return resp.Body, nil
+}
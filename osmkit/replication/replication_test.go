@@ -0,0 +1,127 @@
+// replication/replication_test.go
+package replication
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"osmkit/apperr"
+	"osmkit/osmchange"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseState(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    State
+		wantErr bool
+	}{
+		{
+			name: "minutely",
+			text: `#Wed May 01 10:00:02 UTC 2024
+sequenceNumber=6123456
+timestamp=2024-05-01T10\:00\:00Z
+`,
+			want: State{Sequence: 6123456, Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "unescaped and in any order",
+			text: "timestamp=2024-05-01T10:00:00Z\r\n\r\nsequenceNumber=42\r\ntxnMaxQueried=123\r\n",
+			want: State{Sequence: 42, Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "no timestamp",
+			text: "sequenceNumber=42\n",
+			want: State{Sequence: 42},
+		},
+		{name: "no sequence", text: "timestamp=2024-05-01T10\\:00\\:00Z\n", wantErr: true},
+		{name: "bad sequence", text: "sequenceNumber=forty-two\n", wantErr: true},
+		{name: "bad timestamp", text: "sequenceNumber=42\ntimestamp=yesterday\n", wantErr: true},
+		{name: "empty", text: "", wantErr: true},
+		{name: "error page", text: "<html><body>404 Not Found</body></html>", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseState(strings.NewReader(tt.text))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Sequence != tt.want.Sequence || !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		sequence int64
+		want     string
+	}{
+		{6123456, "006/123/456"},
+		{42, "000/000/042"},
+		{1000, "000/001/000"},
+		{1234567890, "1234/567/890"},
+	}
+	for _, tt := range tests {
+		if got := Path(tt.sequence); got != tt.want {
+			t.Errorf("Path(%d) = %q, want %q", tt.sequence, got, tt.want)
+		}
+	}
+}
+
+func TestDirectorySource(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "state.txt"), []byte("sequenceNumber=1000\ntimestamp=2024-05-01T10\\:00\\:00Z\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	diff := filepath.Join(dir, "000", "001", "000.osc.gz")
+	if err := os.MkdirAll(filepath.Dir(diff), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(`<osmChange version="0.6">
+ <modify><node id="1" version="2" lat="44.43" lon="26.10"><tag k="amenity" v="drinking_water"/></node></modify>
+ <delete><node id="2" version="3"/></delete>
+</osmChange>`))
+	gz.Close()
+	f.Close()
+
+	source := NewSource(dir + "/")
+	ctx := context.Background()
+	state, err := source.State(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Sequence != 1000 {
+		t.Errorf("sequence = %d, want 1000", state.Sequence)
+	}
+
+	changes, err := source.Diff(ctx, state.Sequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 ||
+		changes[0].Action != osmchange.Modify || changes[0].Node == nil || changes[0].Node.ID != 1 ||
+		changes[1].Action != osmchange.Delete || changes[1].Node == nil || changes[1].Node.ID != 2 {
+		t.Errorf("got %+v, want node 1 modified and node 2 deleted", changes)
+	}
+
+	if _, err := source.Diff(ctx, state.Sequence+1); !apperr.Is(err, apperr.Gone) {
+		t.Errorf("got error %v for a missing diff, want %s", err, apperr.Gone)
+	}
+}
@@ -0,0 +1,90 @@
+// tags/merge.go
+package tags
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Conflict is a key that was changed differently on both sides of a merge. A
+// nil value means the key is absent on that side.
+type Conflict struct {
+	Key    string  `json:"key"`
+	Base   *string `json:"base"`
+	Ours   *string `json:"ours"`
+	Theirs *string `json:"theirs"`
+}
+
+// Merge does a three-way merge of ours and theirs, both derived from base.
+// Changes made on only one side are kept; keys changed on both sides to
+// different values are reported as conflicts and keep their value from theirs.
+func Merge(base, ours, theirs map[string]string) (map[string]string, []Conflict) {
+	merged := make(map[string]string, len(theirs))
+	for key, value := range theirs {
+		merged[key] = value
+	}
+
+	keys := map[string]bool{}
+	for _, m := range []map[string]string{base, ours, theirs} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var conflicts []Conflict
+	for _, key := range sorted {
+		b, o, t := lookup(base, key), lookup(ours, key), lookup(theirs, key)
+		switch {
+		case same(o, b), same(o, t):
+			// We did not touch it, or both sides agree: theirs is already in merged
+		case same(t, b):
+			if o == nil {
+				delete(merged, key)
+			} else {
+				merged[key] = *o
+			}
+		default:
+			conflicts = append(conflicts, Conflict{Key: key, Base: b, Ours: o, Theirs: t})
+		}
+	}
+	return merged, conflicts
+}
+
+func lookup(m map[string]string, key string) *string {
+	if value, ok := m[key]; ok {
+		return &value
+	}
+	return nil
+}
+
+func same(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// ConflictError is returned when an element was edited by someone else since
+// the user loaded it and the edits could not be merged automatically.
+type ConflictError struct {
+	Type      string            `json:"type"`
+	ID        int64             `json:"id"`
+	Version   int               `json:"version"` // latest version on the server
+	Tags      map[string]string `json:"tags"`    // latest tags on the server
+	Conflicts []Conflict        `json:"conflicts"`
+}
+
+func (e *ConflictError) Error() string {
+	keys := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		keys = append(keys, c.Key)
+	}
+	return fmt.Sprintf("%s %d was changed by someone else (now version %d), conflicting keys: %s",
+		e.Type, e.ID, e.Version, strings.Join(keys, ", "))
+}
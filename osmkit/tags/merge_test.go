@@ -0,0 +1,91 @@
+// tags/merge_test.go
+package tags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	base := map[string]string{"highway": "residential", "name": "Strada Test", "surface": "asphalt"}
+	tests := []struct {
+		name      string
+		ours      map[string]string
+		theirs    map[string]string
+		want      map[string]string
+		conflicts []string
+	}{
+		{
+			name:   "only we changed",
+			ours:   map[string]string{"highway": "residential", "name": "Strada Test", "surface": "asphalt", "zoning_code": "R1"},
+			theirs: base,
+			want:   map[string]string{"highway": "residential", "name": "Strada Test", "surface": "asphalt", "zoning_code": "R1"},
+		},
+		{
+			name:   "only they changed",
+			ours:   base,
+			theirs: map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt"},
+			want:   map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt"},
+		},
+		{
+			name:   "different keys",
+			ours:   map[string]string{"highway": "residential", "name": "Strada Test", "zoning_code": "R1"},
+			theirs: map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt"},
+			want:   map[string]string{"highway": "residential", "name": "Strada Noua", "zoning_code": "R1"},
+		},
+		{
+			name:   "same change on both sides",
+			ours:   map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt"},
+			theirs: map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt"},
+			want:   map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt"},
+		},
+		{
+			name:      "both changed a key",
+			ours:      map[string]string{"highway": "residential", "name": "Strada Veche", "surface": "asphalt"},
+			theirs:    map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt"},
+			want:      map[string]string{"highway": "residential", "name": "Strada Noua", "surface": "asphalt"},
+			conflicts: []string{"name"},
+		},
+		{
+			name:      "we deleted what they changed",
+			ours:      map[string]string{"highway": "residential", "name": "Strada Test"},
+			theirs:    map[string]string{"highway": "residential", "name": "Strada Test", "surface": "paved"},
+			want:      map[string]string{"highway": "residential", "name": "Strada Test", "surface": "paved"},
+			conflicts: []string{"surface"},
+		},
+		{
+			name:      "both added a key",
+			ours:      map[string]string{"highway": "residential", "name": "Strada Test", "surface": "asphalt", "lit": "yes"},
+			theirs:    map[string]string{"highway": "residential", "name": "Strada Test", "surface": "asphalt", "lit": "no"},
+			want:      map[string]string{"highway": "residential", "name": "Strada Test", "surface": "asphalt", "lit": "no"},
+			conflicts: []string{"lit"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := Merge(base, tt.ours, tt.theirs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merged = %v, want %v", got, tt.want)
+			}
+			var keys []string
+			for _, c := range conflicts {
+				keys = append(keys, c.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.conflicts) {
+				t.Errorf("conflicts = %v, want %v", keys, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestConflictValues(t *testing.T) {
+	base := map[string]string{"surface": "asphalt"}
+	_, conflicts := Merge(base, map[string]string{}, map[string]string{"surface": "paved"})
+	if len(conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1", len(conflicts))
+	}
+	c := conflicts[0]
+	if c.Base == nil || *c.Base != "asphalt" || c.Ours != nil || c.Theirs == nil || *c.Theirs != "paved" {
+		t.Errorf("got base %v, ours %v, theirs %v, want asphalt, nil, paved", c.Base, c.Ours, c.Theirs)
+	}
+}
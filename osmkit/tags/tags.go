@@ -0,0 +1,123 @@
+// tags/tags.go
+package tags
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Patch describes a change to the tags of an element. Keys not mentioned are
+// left untouched, so a stale or partial client cannot drop unrelated tags.
+type Patch struct {
+	Set    map[string]string `json:"set"`
+	Delete []string          `json:"delete"`
+	// Version is the element version the user edited, 0 if unknown.
+	Version int `json:"version,omitempty"`
+}
+
+// DecodePatch parses a {"set": {...}, "delete": [...], "version": n} request
+// body. Bodies in the old whole-tag-set format are rejected instead of being applied.
+func DecodePatch(data []byte) (Patch, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Patch{}, err
+	}
+	for key := range raw {
+		if key != "set" && key != "delete" && key != "version" {
+			return Patch{}, fmt.Errorf(`unexpected field %q, expected {"set": {...}, "delete": [...], "version": n}`, key)
+		}
+	}
+
+	var p Patch
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Patch{}, err
+	}
+	return p, p.Validate()
+}
+
+// Validate rejects patches that are empty or contradict themselves.
+func (p Patch) Validate() error {
+	if p.IsEmpty() {
+		return fmt.Errorf("patch does not change anything")
+	}
+	for key := range p.Set {
+		if key == "" {
+			return fmt.Errorf("patch sets an empty key")
+		}
+	}
+	for _, key := range p.Delete {
+		if _, ok := p.Set[key]; ok {
+			return fmt.Errorf("patch both sets and deletes %q", key)
+		}
+	}
+	return nil
+}
+
+// IsEmpty reports whether the patch has no operations.
+func (p Patch) IsEmpty() bool {
+	return len(p.Set) == 0 && len(p.Delete) == 0
+}
+
+// Apply returns a copy of current with the patch applied.
+func (p Patch) Apply(current map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(p.Set))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range p.Set {
+		merged[key] = value
+	}
+	for _, key := range p.Delete {
+		delete(merged, key)
+	}
+	return merged
+}
+
+// Rebase applies the patch, made against the base tags, on top of the latest
+// tags. Keys both sides changed to different values are returned as conflicts
+// and keep their latest value in the result.
+func (p Patch) Rebase(base, latest map[string]string) (map[string]string, []Conflict) {
+	return Merge(base, p.Apply(base), latest)
+}
+
+// Equal reports whether two tag sets are identical.
+func Equal(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Then combines the patch with a later one, as if next was applied after p.
+// The result keeps the newer of the two versions: a user who edits the
+// element again after a conflict has seen the latest tags, so the combined
+// patch is merged against those instead of failing on the stale ones again.
+func (p Patch) Then(next Patch) Patch {
+	combined := Patch{Set: make(map[string]string), Version: max(p.Version, next.Version)}
+	deleted := map[string]bool{}
+	for key, value := range p.Set {
+		combined.Set[key] = value
+	}
+	for _, key := range p.Delete {
+		deleted[key] = true
+	}
+	for key, value := range next.Set {
+		combined.Set[key] = value
+		delete(deleted, key)
+	}
+	for _, key := range next.Delete {
+		delete(combined.Set, key)
+		deleted[key] = true
+	}
+	for key := range deleted {
+		combined.Delete = append(combined.Delete, key)
+	}
+	sort.Strings(combined.Delete)
+	return combined
+}
@@ -0,0 +1,157 @@
+// tags/tags_test.go
+package tags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    Patch
+		wantErr bool
+	}{
+		{
+			name: "set and delete",
+			body: `{"set": {"zoning_code": "R1"}, "delete": ["old_name"], "version": 3}`,
+			want: Patch{Set: map[string]string{"zoning_code": "R1"}, Delete: []string{"old_name"}, Version: 3},
+		},
+		{
+			name: "delete only",
+			body: `{"delete": ["old_name"]}`,
+			want: Patch{Delete: []string{"old_name"}},
+		},
+		{name: "whole tag set", body: `{"highway": "residential", "zoning_code": "R1"}`, wantErr: true},
+		{name: "empty", body: `{"set": {}, "delete": []}`, wantErr: true},
+		{name: "empty key", body: `{"set": {"": "R1"}}`, wantErr: true},
+		{name: "set and delete the same key", body: `{"set": {"name": "a"}, "delete": ["name"]}`, wantErr: true},
+		{name: "not JSON", body: `set=name`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodePatch([]byte(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	current := map[string]string{"highway": "residential", "name": "Strada Test", "old_name": "Strada Veche"}
+	patch := Patch{Set: map[string]string{"name": "Strada Noua", "zoning_code": "R1"}, Delete: []string{"old_name", "missing"}}
+	want := map[string]string{"highway": "residential", "name": "Strada Noua", "zoning_code": "R1"}
+	if got := patch.Apply(current); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if current["name"] != "Strada Test" || current["old_name"] != "Strada Veche" {
+		t.Errorf("Apply changed its input: %v", current)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b map[string]string
+		want bool
+	}{
+		{"same", map[string]string{"name": "a"}, map[string]string{"name": "a"}, true},
+		{"both empty", nil, map[string]string{}, true},
+		{"other value", map[string]string{"name": "a"}, map[string]string{"name": "b"}, false},
+		{"other key", map[string]string{"name": "a"}, map[string]string{"ref": "a"}, false},
+		{"empty value and missing key", map[string]string{"name": ""}, map[string]string{"ref": ""}, false},
+		{"more keys", map[string]string{"name": "a"}, map[string]string{"name": "a", "ref": "1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Equal(tt.a, tt.b); got != tt.want {
+				t.Errorf("Equal = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThen(t *testing.T) {
+	tests := []struct {
+		name        string
+		first, next Patch
+		want        Patch
+	}{
+		{
+			name:  "different keys",
+			first: Patch{Set: map[string]string{"zoning_code": "R1"}, Version: 2},
+			next:  Patch{Delete: []string{"old_name"}, Version: 2},
+			want:  Patch{Set: map[string]string{"zoning_code": "R1"}, Delete: []string{"old_name"}, Version: 2},
+		},
+		{
+			name:  "set again",
+			first: Patch{Set: map[string]string{"zoning_code": "R1"}},
+			next:  Patch{Set: map[string]string{"zoning_code": "R2"}},
+			want:  Patch{Set: map[string]string{"zoning_code": "R2"}},
+		},
+		{
+			name:  "delete what was set",
+			first: Patch{Set: map[string]string{"zoning_code": "R1", "name": "a"}},
+			next:  Patch{Delete: []string{"zoning_code"}},
+			want:  Patch{Set: map[string]string{"name": "a"}, Delete: []string{"zoning_code"}},
+		},
+		{
+			name:  "set what was deleted",
+			first: Patch{Delete: []string{"old_name", "zoning_code"}},
+			next:  Patch{Set: map[string]string{"zoning_code": "R1"}},
+			want:  Patch{Set: map[string]string{"zoning_code": "R1"}, Delete: []string{"old_name"}},
+		},
+		{
+			name:  "edited again after a conflict",
+			first: Patch{Set: map[string]string{"zoning_code": "R1"}, Version: 2},
+			next:  Patch{Set: map[string]string{"name": "a"}, Version: 4},
+			want:  Patch{Set: map[string]string{"zoning_code": "R1", "name": "a"}, Version: 4},
+		},
+		{
+			name:  "older version later",
+			first: Patch{Set: map[string]string{"zoning_code": "R1"}, Version: 4},
+			next:  Patch{Set: map[string]string{"name": "a"}, Version: 2},
+			want:  Patch{Set: map[string]string{"zoning_code": "R1", "name": "a"}, Version: 4},
+		},
+		{
+			name:  "first version unknown",
+			first: Patch{Set: map[string]string{"zoning_code": "R1"}},
+			next:  Patch{Set: map[string]string{"name": "a"}, Version: 4},
+			want:  Patch{Set: map[string]string{"zoning_code": "R1", "name": "a"}, Version: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.first.Then(tt.next); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebase(t *testing.T) {
+	base := map[string]string{"highway": "residential", "name": "Strada Test"}
+	latest := map[string]string{"highway": "residential", "name": "Strada Noua"}
+
+	merged, conflicts := Patch{Set: map[string]string{"zoning_code": "R1"}}.Rebase(base, latest)
+	want := map[string]string{"highway": "residential", "name": "Strada Noua", "zoning_code": "R1"}
+	if len(conflicts) != 0 || !reflect.DeepEqual(merged, want) {
+		t.Errorf("got %v with conflicts %v, want %v", merged, conflicts, want)
+	}
+
+	_, conflicts = Patch{Set: map[string]string{"name": "Strada Veche"}}.Rebase(base, latest)
+	if len(conflicts) != 1 || conflicts[0].Key != "name" {
+		t.Errorf("got conflicts %v, want one on name", conflicts)
+	}
+}
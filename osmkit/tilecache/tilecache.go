@@ -0,0 +1,328 @@
+// tilecache/tilecache.go
+package tilecache
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"osmkit/overpassql"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultZoom gives tiles of roughly 10km at Romania's latitude.
+	DefaultZoom = 12
+	// DefaultTTL is how long a tile is served before it is fetched again.
+	DefaultTTL = 5 * time.Minute
+	// DefaultMaxBytes bounds the estimated memory of the cached elements.
+	DefaultMaxBytes = 64 << 20
+	// DefaultMaxTiles is the largest view served through the cache; bigger
+	// ones are fetched directly rather than flooding the cache.
+	DefaultMaxTiles = 64
+)
+
+// Tile is a slippy map tile.
+type Tile struct {
+	Z, X, Y int
+}
+
+// TileAt returns the tile of zoom z containing the point.
+func TileAt(z int, lat, lon float64) Tile {
+	n := 1 << z
+	x := int(math.Floor((lon + 180) / 360 * float64(n)))
+	latRad := lat * math.Pi / 180
+	y := int(math.Floor((1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * float64(n)))
+	return Tile{Z: z, X: clamp(x, 0, n-1), Y: clamp(y, 0, n-1)}
+}
+
+// BBox returns the area covered by the tile.
+func (t Tile) BBox() overpassql.BBox {
+	n := float64(int(1) << t.Z)
+	lat := func(y int) float64 {
+		return math.Atan(math.Sinh(math.Pi*(1-2*float64(y)/n))) * 180 / math.Pi
+	}
+	return overpassql.BBox{
+		South: lat(t.Y + 1),
+		West:  float64(t.X)/n*360 - 180,
+		North: lat(t.Y),
+		East:  float64(t.X+1)/n*360 - 180,
+	}
+}
+
+// Range is a rectangle of tiles, both ends included.
+type Range struct {
+	Z                      int
+	MinX, MinY, MaxX, MaxY int
+}
+
+// Cover returns the tiles of zoom z needed to cover bbox.
+func Cover(z int, bbox overpassql.BBox) Range {
+	nw := TileAt(z, bbox.North, bbox.West)
+	se := TileAt(z, bbox.South, bbox.East)
+	return Range{Z: z, MinX: nw.X, MinY: nw.Y, MaxX: se.X, MaxY: se.Y}
+}
+
+// Len returns the number of tiles in the range, 0 when its ends are swapped.
+func (r Range) Len() int {
+	if r.MaxX < r.MinX || r.MaxY < r.MinY {
+		return 0
+	}
+	return (r.MaxX - r.MinX + 1) * (r.MaxY - r.MinY + 1)
+}
+
+// Tiles lists the tiles of the range, none when its ends are swapped.
+func (r Range) Tiles() []Tile {
+	if r.Len() == 0 {
+		return nil
+	}
+	tiles := make([]Tile, 0, r.Len())
+	for y := r.MinY; y <= r.MaxY; y++ {
+		for x := r.MinX; x <= r.MaxX; x++ {
+			tiles = append(tiles, Tile{Z: r.Z, X: x, Y: y})
+		}
+	}
+	return tiles
+}
+
+// BBox returns the area covered by the range.
+func (r Range) BBox() overpassql.BBox {
+	nw := Tile{Z: r.Z, X: r.MinX, Y: r.MinY}.BBox()
+	se := Tile{Z: r.Z, X: r.MaxX, Y: r.MaxY}.BBox()
+	return overpassql.BBox{South: se.South, West: nw.West, North: nw.North, East: se.East}
+}
+
+// Stats are the counters of a cache.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Tiles     int    `json:"tiles"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// HitRatio returns the share of tile lookups served from the cache.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Cache keeps the elements of each tile for TTL, evicting the least recently
+// used tiles once their estimated size passes MaxBytes. Bounds, ID and Size
+// describe the elements and must be set. It is safe for concurrent use.
+type Cache[V any] struct {
+	Zoom     int
+	TTL      time.Duration
+	MaxBytes int64
+	MaxTiles int
+	Now      func() time.Time
+
+	// Bounds returns the extent of an element; it is filed under every tile
+	// the extent touches.
+	Bounds func(V) overpassql.BBox
+	// ID identifies an element, so one stored in several tiles is returned once.
+	ID func(V) int64
+	// Size estimates the memory an element takes, in bytes.
+	Size func(V) int
+
+	mu      sync.Mutex
+	entries map[Tile]*list.Element
+	lru     *list.List // front is the most recently used
+	bytes   int64
+	stats   Stats
+}
+
+type entry[V any] struct {
+	tile     Tile
+	elements []V
+	size     int64
+	fetched  time.Time
+}
+
+// New returns a cache with the defaults above.
+func New[V any](bounds func(V) overpassql.BBox, id func(V) int64, size func(V) int) *Cache[V] {
+	return &Cache[V]{
+		Zoom:     DefaultZoom,
+		TTL:      DefaultTTL,
+		MaxBytes: DefaultMaxBytes,
+		MaxTiles: DefaultMaxTiles,
+		Now:      time.Now,
+		Bounds:   bounds,
+		ID:       id,
+		Size:     size,
+		entries:  make(map[Tile]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Get returns the elements of the tiles covering bbox. Missing or expired
+// tiles are fetched together with one call of fetch for the rectangle around
+// them. It reports whether every tile came from the cache.
+func (c *Cache[V]) Get(ctx context.Context, bbox overpassql.BBox, fetch func(context.Context, overpassql.BBox) ([]V, error)) ([]V, bool, error) {
+	cover := Cover(c.Zoom, bbox)
+	if cover.Len() > c.MaxTiles {
+		elements, err := fetch(ctx, bbox)
+		return elements, false, err
+	}
+
+	found := map[Tile][]V{}
+	var missing []Tile
+	c.mu.Lock()
+	for _, t := range cover.Tiles() {
+		if elements, ok := c.lookup(t); ok {
+			found[t] = elements
+		} else {
+			missing = append(missing, t)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(missing) > 0 {
+		fetchRange := rangeOf(missing)
+		elements, err := fetch(ctx, fetchRange.BBox())
+		if err != nil {
+			return nil, false, err
+		}
+		byTile := c.split(fetchRange, elements)
+		c.mu.Lock()
+		for _, t := range fetchRange.Tiles() {
+			c.store(t, byTile[t])
+		}
+		c.mu.Unlock()
+		for _, t := range missing {
+			found[t] = byTile[t]
+		}
+	}
+
+	seen := map[int64]bool{}
+	var result []V
+	for _, t := range cover.Tiles() {
+		for _, e := range found[t] {
+			if id := c.ID(e); !seen[id] {
+				seen[id] = true
+				result = append(result, e)
+			}
+		}
+	}
+	return result, len(missing) == 0, nil
+}
+
+// Invalidate drops the tiles overlapping bbox, for example after an edit there.
+func (c *Cache[V]) Invalidate(bbox overpassql.BBox) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range Cover(c.Zoom, bbox).Tiles() {
+		if el, ok := c.entries[t]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// Clear drops every tile, for example when the query filling them changed.
+func (c *Cache[V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, el := range c.entries {
+		c.remove(el)
+	}
+}
+
+// Forget drops every tile holding the element with the given ID.
+func (c *Cache[V]) Forget(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, el := range c.entries {
+		for _, e := range el.Value.(*entry[V]).elements {
+			if c.ID(e) == id {
+				c.remove(el)
+				break
+			}
+		}
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache[V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Tiles = len(c.entries)
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// lookup returns a fresh tile. Callers must hold c.mu.
+func (c *Cache[V]) lookup(t Tile) ([]V, bool) {
+	el, ok := c.entries[t]
+	if ok && c.Now().Sub(el.Value.(*entry[V]).fetched) >= c.TTL {
+		c.remove(el)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(el)
+	return el.Value.(*entry[V]).elements, true
+}
+
+// store adds or replaces a tile and evicts old ones over MaxBytes. Callers
+// must hold c.mu.
+func (c *Cache[V]) store(t Tile, elements []V) {
+	if el, ok := c.entries[t]; ok {
+		c.remove(el)
+	}
+	e := &entry[V]{tile: t, elements: elements, size: 64, fetched: c.Now()}
+	for _, v := range elements {
+		e.size += int64(c.Size(v))
+	}
+	if c.MaxBytes > 0 && e.size > c.MaxBytes {
+		return
+	}
+	c.entries[t] = c.lru.PushFront(e)
+	c.bytes += e.size
+	for c.MaxBytes > 0 && c.bytes > c.MaxBytes {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove drops a tile. Callers must hold c.mu.
+func (c *Cache[V]) remove(el *list.Element) {
+	e := el.Value.(*entry[V])
+	c.lru.Remove(el)
+	delete(c.entries, e.tile)
+	c.bytes -= e.size
+}
+
+// split files the elements under the tiles of r their extent touches.
+func (c *Cache[V]) split(r Range, elements []V) map[Tile][]V {
+	byTile := map[Tile][]V{}
+	for _, e := range elements {
+		touched := Cover(c.Zoom, c.Bounds(e))
+		for y := max(touched.MinY, r.MinY); y <= min(touched.MaxY, r.MaxY); y++ {
+			for x := max(touched.MinX, r.MinX); x <= min(touched.MaxX, r.MaxX); x++ {
+				t := Tile{Z: r.Z, X: x, Y: y}
+				byTile[t] = append(byTile[t], e)
+			}
+		}
+	}
+	return byTile
+}
+
+// rangeOf returns the smallest rectangle holding the tiles.
+func rangeOf(tiles []Tile) Range {
+	r := Range{Z: tiles[0].Z, MinX: tiles[0].X, MinY: tiles[0].Y, MaxX: tiles[0].X, MaxY: tiles[0].Y}
+	for _, t := range tiles[1:] {
+		r.MinX, r.MaxX = min(r.MinX, t.X), max(r.MaxX, t.X)
+		r.MinY, r.MaxY = min(r.MinY, t.Y), max(r.MaxY, t.Y)
+	}
+	return r
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
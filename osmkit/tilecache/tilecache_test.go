@@ -0,0 +1,301 @@
+// tilecache/tilecache_test.go
+package tilecache
+
+import (
+	"context"
+	"osmkit/overpassql"
+	"sort"
+	"testing"
+	"time"
+)
+
+type point struct {
+	id       int64
+	lat, lon float64
+}
+
+// pointSize makes every tile of one point take 164 bytes with its overhead.
+const pointSize = 100
+
+// world serves the points inside the bbox asked for and counts the calls.
+type world struct {
+	points []point
+	calls  int
+}
+
+func (w *world) fetch(ctx context.Context, bbox overpassql.BBox) ([]point, error) {
+	w.calls++
+	var inside []point
+	for _, p := range w.points {
+		if bbox.Contains(p.lat, p.lon) {
+			inside = append(inside, p)
+		}
+	}
+	return inside, nil
+}
+
+// clock is a time the tests move by hand.
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newTestCache(c *clock) *Cache[point] {
+	cache := New(
+		func(p point) overpassql.BBox {
+			return overpassql.BBox{South: p.lat, West: p.lon, North: p.lat, East: p.lon}
+		},
+		func(p point) int64 { return p.id },
+		func(p point) int { return pointSize },
+	)
+	cache.Now = c.Now
+	return cache
+}
+
+// tileArea returns an area well inside a tile of Bucharest, dx tiles east of
+// the first.
+func tileArea(dx int) overpassql.BBox {
+	t := TileAt(DefaultZoom, 44.43, 26.10)
+	t.X += dx
+	b := t.BBox()
+	latPad, lonPad := (b.North-b.South)/4, (b.East-b.West)/4
+	return overpassql.BBox{South: b.South + latPad, West: b.West + lonPad, North: b.North - latPad, East: b.East - lonPad}
+}
+
+// centerOf returns a point in the middle of the area.
+func centerOf(id int64, b overpassql.BBox) point {
+	return point{id: id, lat: (b.South + b.North) / 2, lon: (b.West + b.East) / 2}
+}
+
+func ids(points []point) []int64 {
+	var ids []int64
+	for _, p := range points {
+		ids = append(ids, p.id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		cached  bool
+		fetches int
+	}{
+		{"fresh", 0, true, 1},
+		{"just before expiry", DefaultTTL - time.Second, true, 1},
+		{"expired", DefaultTTL, false, 2},
+		{"long expired", 3 * DefaultTTL, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			area := tileArea(0)
+			w := &world{points: []point{centerOf(1, area)}}
+			c := &clock{now: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+			cache := newTestCache(c)
+			ctx := context.Background()
+
+			if _, cached, err := cache.Get(ctx, area, w.fetch); err != nil || cached {
+				t.Fatalf("first Get: cached %v, error %v, want a fetch", cached, err)
+			}
+			c.now = c.now.Add(tt.elapsed)
+			points, cached, err := cache.Get(ctx, area, w.fetch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cached != tt.cached {
+				t.Errorf("cached = %v, want %v", cached, tt.cached)
+			}
+			if w.calls != tt.fetches {
+				t.Errorf("fetched %d times, want %d", w.calls, tt.fetches)
+			}
+			if len(points) != 1 || points[0].id != 1 {
+				t.Errorf("got %v, want point 1", points)
+			}
+		})
+	}
+}
+
+func TestEviction(t *testing.T) {
+	var areas []overpassql.BBox
+	w := &world{}
+	for i := 0; i < 3; i++ {
+		area := tileArea(i)
+		areas = append(areas, area)
+		w.points = append(w.points, centerOf(int64(i+1), area))
+	}
+	cache := newTestCache(&clock{now: time.Now()})
+	cache.MaxBytes = 2 * (64 + pointSize) // two tiles of one point
+	ctx := context.Background()
+
+	// Tile 0 is used again after tile 1, so tile 1 is the one evicted for tile 2
+	for _, i := range []int{0, 1, 0, 2} {
+		if _, _, err := cache.Get(ctx, areas[i], w.fetch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := cache.Stats()
+	if stats.Tiles != 2 || stats.Evictions != 1 || stats.Bytes != cache.MaxBytes {
+		t.Errorf("got %+v, want 2 tiles, 1 eviction and %d bytes", stats, cache.MaxBytes)
+	}
+
+	tests := []struct {
+		tile   int
+		cached bool
+	}{
+		{0, true},
+		{2, true},
+		{1, false},
+	}
+	for _, tt := range tests {
+		if _, cached, _ := cache.Get(ctx, areas[tt.tile], w.fetch); cached != tt.cached {
+			t.Errorf("tile %d: cached = %v, want %v", tt.tile, cached, tt.cached)
+		}
+	}
+}
+
+func TestTooLargeForTheCache(t *testing.T) {
+	area := tileArea(0)
+	w := &world{points: []point{centerOf(1, area)}}
+	cache := newTestCache(&clock{now: time.Now()})
+	cache.MaxBytes = 100 // smaller than any tile
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, cached, _ := cache.Get(ctx, area, w.fetch); cached {
+			t.Error("a tile over MaxBytes was cached")
+		}
+	}
+	if stats := cache.Stats(); stats.Tiles != 0 || stats.Bytes != 0 {
+		t.Errorf("got %+v, want an empty cache", stats)
+	}
+}
+
+func TestLargeView(t *testing.T) {
+	first := tileArea(0)
+	last := tileArea(DefaultMaxTiles)
+	view := overpassql.BBox{South: first.South, West: first.West, North: first.North, East: last.East}
+	w := &world{points: []point{centerOf(1, first), centerOf(2, last)}}
+	cache := newTestCache(&clock{now: time.Now()})
+
+	points, cached, err := cache.Get(context.Background(), view, w.fetch)
+	if err != nil || cached || len(points) != 2 {
+		t.Fatalf("got %v, cached %v, error %v, want both points fetched", ids(points), cached, err)
+	}
+	if stats := cache.Stats(); stats.Tiles != 0 {
+		t.Errorf("a view of %d tiles filled %d tiles", Cover(DefaultZoom, view).Len(), stats.Tiles)
+	}
+}
+
+func TestInvalidateAndForget(t *testing.T) {
+	a := tileArea(0)
+	b := tileArea(1)
+	w := &world{points: []point{centerOf(1, a), centerOf(2, b)}}
+	cache := newTestCache(&clock{now: time.Now()})
+	ctx := context.Background()
+	both := overpassql.BBox{South: a.South, West: a.West, North: a.North, East: b.East}
+
+	points, _, err := cache.Get(ctx, both, w.fetch)
+	if err != nil || len(points) != 2 {
+		t.Fatalf("got %v, error %v, want both points", ids(points), err)
+	}
+
+	cache.Invalidate(a)
+	if _, cached, _ := cache.Get(ctx, b, w.fetch); !cached {
+		t.Error("Invalidate dropped a tile outside its bbox")
+	}
+	if _, cached, _ := cache.Get(ctx, a, w.fetch); cached {
+		t.Error("Invalidate kept the tile of its bbox")
+	}
+
+	cache.Forget(2)
+	if _, cached, _ := cache.Get(ctx, b, w.fetch); cached {
+		t.Error("Forget kept the tile of the element")
+	}
+	if _, cached, _ := cache.Get(ctx, a, w.fetch); !cached {
+		t.Error("Forget dropped a tile without the element")
+	}
+
+	cache.Clear()
+	if stats := cache.Stats(); stats.Tiles != 0 || stats.Bytes != 0 {
+		t.Errorf("got %+v after Clear, want an empty cache", stats)
+	}
+}
+
+func TestElementOverSeveralTiles(t *testing.T) {
+	a := tileArea(0)
+	b := tileArea(1)
+	w := &world{points: []point{centerOf(1, a)}}
+	cache := New(
+		// Element 1 stretches over both tiles
+		func(p point) overpassql.BBox {
+			return overpassql.BBox{South: a.South, West: a.West, North: a.North, East: b.East}
+		},
+		func(p point) int64 { return p.id },
+		func(p point) int { return pointSize },
+	)
+	both := overpassql.BBox{South: a.South, West: a.West, North: a.North, East: b.East}
+	ctx := context.Background()
+
+	if points, _, _ := cache.Get(ctx, both, w.fetch); len(points) != 1 {
+		t.Errorf("got %v, want the element once", ids(points))
+	}
+	if points, cached, _ := cache.Get(ctx, b, w.fetch); !cached || len(points) != 1 {
+		t.Errorf("got %v, cached %v, want the element from the second tile", ids(points), cached)
+	}
+}
+
+func TestCover(t *testing.T) {
+	tests := []struct {
+		name string
+		bbox overpassql.BBox
+		len  int
+	}{
+		{"inside one tile", tileArea(0), 1},
+		{"two tiles", func() overpassql.BBox {
+			a := tileArea(0)
+			b := tileArea(1)
+			return overpassql.BBox{South: a.South, West: a.West, North: a.North, East: b.East}
+		}(), 2},
+		{"Bucharest", overpassql.BBox{South: 44.33, West: 25.97, North: 44.54, East: 26.23}, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Cover(DefaultZoom, tt.bbox)
+			if r.Len() != tt.len || len(r.Tiles()) != tt.len {
+				t.Errorf("got %d tiles, want %d", r.Len(), tt.len)
+			}
+			covered := r.BBox()
+			if covered.South > tt.bbox.South || covered.West > tt.bbox.West || covered.North < tt.bbox.North || covered.East < tt.bbox.East {
+				t.Errorf("tiles cover %v, not all of %v", covered, tt.bbox)
+			}
+		})
+	}
+}
+
+func TestInvertedBBox(t *testing.T) {
+	bucharest := overpassql.BBox{South: 44.33, West: 25.97, North: 44.54, East: 26.23}
+	tests := []struct {
+		name string
+		bbox overpassql.BBox
+	}{
+		{"south above north", overpassql.BBox{South: bucharest.North, West: bucharest.West, North: bucharest.South, East: bucharest.East}},
+		{"west east of east", overpassql.BBox{South: bucharest.South, West: bucharest.East, North: bucharest.North, East: bucharest.West}},
+		{"both", overpassql.BBox{South: bucharest.North, West: bucharest.East, North: bucharest.South, East: bucharest.West}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Cover(DefaultZoom, tt.bbox)
+			if r.Len() != 0 || len(r.Tiles()) != 0 {
+				t.Errorf("got %d tiles %v, want none", r.Len(), r.Tiles())
+			}
+
+			w := &world{points: []point{centerOf(1, bucharest)}}
+			cache := newTestCache(&clock{now: time.Now()})
+			got, _, err := cache.Get(context.Background(), tt.bbox, w.fetch)
+			if err != nil || len(got) != 0 {
+				t.Errorf("got %v, %v, want nothing", got, err)
+			}
+		})
+	}
+}